@@ -5,6 +5,8 @@ import (
 	"github.com/astaxie/beego/config"
 	"github.com/blocktree/openwallet/log"
 	"github.com/blocktree/openwallet/openwallet"
+	"strings"
+	"time"
 )
 
 //CurveType 曲线类型
@@ -53,17 +55,43 @@ func (wm *WalletManager) LoadAssetsConfig(c config.Configer) error {
 
 	wm.Config.ServerAPI = c.String("serverAPI")
 	wm.Config.FixFees = c.String("fixFees")
+	wm.Config.FeeMultiplier = c.DefaultString("feeMultiplier", "1")
 	wm.Config.NetworkID = c.String("networkID")
+	wm.Config.MaxRollbackDepth = uint64(c.DefaultInt64("maxRollbackDepth", 20))
+	wm.Config.TokenGasLimit = uint64(c.DefaultInt64("tokenGasLimit", 50000))
+	wm.Config.FinalConfirmations = uint64(c.DefaultInt64("finalConfirmations", 10))
+	wm.Config.TrackPeriod = uint64(c.DefaultInt64("trackPeriod", 10))
+	wm.TxTracker.PeriodOfTask = time.Duration(wm.Config.TrackPeriod) * time.Second
+	wm.Config.RebroadcastAfter = uint64(c.DefaultInt64("rebroadcastAfter", 180))
+	wm.Config.MaxRebroadcast = uint64(c.DefaultInt64("maxRebroadcast", 3))
+	wm.Config.ReplaceStuckTx = c.DefaultBool("replaceStuckTx", false)
+	wm.Config.ReplaceFeeScale = c.DefaultString("replaceFeeScale", "1.5")
+	wm.Config.ExportBase64Tx = c.DefaultBool("exportBase64Tx", false)
+	wm.StuckTxService.PeriodOfTask = wm.TxTracker.PeriodOfTask
+	wm.Config.WatchContracts = make([]string, 0)
+	for _, contract := range strings.Split(c.String("watchContracts"), ",") {
+		contract = strings.TrimSpace(contract)
+		if len(contract) > 0 {
+			wm.Config.WatchContracts = append(wm.Config.WatchContracts, contract)
+		}
+	}
+	wm.Config.SharedDepositAddress = strings.TrimSpace(c.String("sharedDepositAddress"))
 	aeternity.Config.Node.URL = wm.Config.ServerAPI
 	aeternity.Config.Node.NetworkID = wm.Config.NetworkID
 
 	client := aeternity.NewNode(aeternity.Config.Node.URL, false)
 	wm.Api = client
 	wm.client = NewClient(wm.Config.ServerAPI, false)
+	wm.Config.InternalAPI = c.DefaultString("internalAPI", wm.Config.ServerAPI)
+	if len(wm.Config.InternalAPI) == 0 {
+		wm.Config.InternalAPI = wm.Config.ServerAPI
+	}
+	wm.internalClient = NewClient(wm.Config.InternalAPI, false)
 	wm.Config.DataDir = c.String("dataDir")
 
 	//数据文件夹
 	wm.Config.makeDataDir()
+
 	return nil
 }
 
@@ -0,0 +1,184 @@
+package aeternity
+
+import (
+	"github.com/aeternity/aepp-sdk-go/aeternity"
+	"github.com/blocktree/openwallet/common"
+	"github.com/blocktree/openwallet/openwallet"
+	"math/big"
+	"sort"
+	"strings"
+)
+
+//isAccountAddress 是否为有效的ak_账户地址
+func isAccountAddress(address string) bool {
+	if !strings.HasPrefix(address, string(aeternity.PrefixAccountPubkey)) {
+		return false
+	}
+	_, err := aeternity.Decode(address)
+	return err == nil
+}
+
+//CreateBatchRawTransaction 批量转账，rawTx.To可以有多个接收地址，每个接收地址创建一笔SpendTx，
+//同一个付款地址的交易单使用连续的nonce。返回的交易单顺序和接收地址按字母排序一致，
+//单个接收地址失败时记录在对应交易单的Error中，不影响其他接收地址
+//转账备注可以在ExtParam的memos中按接收地址设置，没有设置的使用ExtParam的memo
+func (decoder *TransactionDecoder) CreateBatchRawTransaction(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction) ([]*openwallet.RawTransactionWithError, error) {
+
+	var (
+		decimals  = decoder.wm.Decimal()
+		accountID = rawTx.Account.AccountID
+	)
+
+	if rawTx.Coin.IsContract {
+		return nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "batch transfer of token is not supported")
+	}
+
+	if len(rawTx.To) == 0 {
+		return nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "receiver addresses are empty")
+	}
+
+	addresses, err := wrapper.GetAddressList(0, -1, "AccountID", accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(addresses) == 0 {
+		return nil, openwallet.Errorf(openwallet.ErrAccountNotAddress, "[%s] have not addresses", accountID)
+	}
+
+	searchAddrs := make([]string, 0)
+	for _, address := range addresses {
+		searchAddrs = append(searchAddrs, address.Address)
+	}
+
+	addrBalanceArray, err := decoder.wm.Blockscanner.GetBalanceByAddress(searchAddrs...)
+	if err != nil {
+		return nil, err
+	}
+
+	//付款地址的剩余余额，按余额从大到小使用，使交易单尽量集中在同一个地址
+	fundings := make([]*AddrBalance, 0)
+	for _, addrBalance := range addrBalanceArray {
+		fundings = append(fundings, &AddrBalance{
+			Address: addrBalance.Address,
+			Balance: common.StringNumToBigIntWithExp(addrBalance.Balance, decimals),
+		})
+	}
+	sort.SliceStable(fundings, func(i, j int) bool {
+		return fundings[i].Balance.Cmp(fundings[j].Balance) > 0
+	})
+
+	destinations := make([]string, 0, len(rawTx.To))
+	for destination := range rawTx.To {
+		destinations = append(destinations, destination)
+	}
+	sort.Strings(destinations)
+
+	memo := rawTx.GetExtParam().Get("memo").String()
+	memos := rawTx.GetExtParam().Get("memos")
+
+	//付款地址的nonce状态，同一个付款地址只查询一次节点
+	nonceStates := make(map[string]*accountNonceState)
+
+	rawTxArray := make([]*openwallet.RawTransactionWithError, 0, len(destinations))
+	for _, destination := range destinations {
+
+		amountStr := rawTx.To[destination]
+		recipientMemo := memo
+		if m := memos.Get(destination); m.Exists() {
+			recipientMemo = m.String()
+		}
+
+		subRawTx := &openwallet.RawTransaction{
+			Coin:     rawTx.Coin,
+			Account:  rawTx.Account,
+			FeeRate:  rawTx.FeeRate,
+			To:       map[string]string{destination: amountStr},
+			Required: 1,
+		}
+		if len(recipientMemo) > 0 {
+			subRawTx.SetExtParam("memo", recipientMemo)
+		}
+
+		createErr := decoder.createBatchItem(wrapper, subRawTx, destination, amountStr, recipientMemo, fundings, nonceStates)
+		if createErr != nil {
+			decoder.wm.Log.Errorf("create batch transaction to %s failed: %v", destination, createErr)
+		}
+		rawTxArray = append(rawTxArray, &openwallet.RawTransactionWithError{
+			RawTx: subRawTx,
+			Error: openwallet.ConvertError(createErr),
+		})
+	}
+
+	return rawTxArray, nil
+}
+
+//selectFunding 按顺序查找剩余余额足够支付的付款地址
+func selectFunding(fundings []*AddrBalance, totalAmount *big.Int) *AddrBalance {
+	for _, f := range fundings {
+		if f.Balance.Cmp(totalAmount) >= 0 {
+			return f
+		}
+	}
+	return nil
+}
+
+//createBatchItem 创建批量转账中一个接收地址的交易单，成功后扣减付款地址的剩余余额
+func (decoder *TransactionDecoder) createBatchItem(
+	wrapper openwallet.WalletDAI,
+	rawTx *openwallet.RawTransaction,
+	destination, amountStr, memo string,
+	fundings []*AddrBalance,
+	nonceStates map[string]*accountNonceState) error {
+
+	if !isAccountAddress(destination) {
+		return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "receiver address [%s] is invalid", destination)
+	}
+
+	amount := common.StringNumToBigIntWithExp(amountStr, decoder.wm.Decimal())
+	if amount.Sign() <= 0 {
+		return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "amount [%s] of receiver address [%s] is invalid", amountStr, destination)
+	}
+
+	payload, err := ParseMemo(memo)
+	if err != nil {
+		return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "%v", err)
+	}
+
+	feeInfo, err := decoder.GetSpendFeeInfo(destination, amount, payload, rawTx.FeeRate)
+	if err != nil {
+		return err
+	}
+
+	//总消耗数量 = 转账数量 + 手续费
+	totalAmount := new(big.Int).Add(amount, feeInfo.Fee)
+
+	funding := selectFunding(fundings, totalAmount)
+	if funding == nil {
+		return openwallet.Errorf(openwallet.ErrInsufficientBalanceOfAccount, "all address's balance of account is not enough")
+	}
+
+	nonceState := nonceStates[funding.Address]
+	if nonceState == nil {
+		nonceState, err = decoder.wm.NonceManager.getAccountNonceState(funding.Address)
+		if err != nil {
+			return openwallet.Errorf(openwallet.ErrCallFullNodeAPIFailed, "get nonce of address [%s] failed: %v", funding.Address, err)
+		}
+		nonceStates[funding.Address] = nonceState
+	}
+
+	err = decoder.createRawTransaction(
+		wrapper,
+		rawTx,
+		&AddrBalance{Address: funding.Address, Balance: new(big.Int).Set(funding.Balance)},
+		feeInfo,
+		string(payload),
+		nonceState)
+	if err != nil {
+		return err
+	}
+
+	funding.Balance.Sub(funding.Balance, totalAmount)
+
+	return nil
+}
@@ -0,0 +1,161 @@
+package aeternity
+
+import (
+	"github.com/blocktree/openwallet/common"
+	"github.com/blocktree/openwallet/openwallet"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+)
+
+func TestIsAccountAddress(t *testing.T) {
+
+	tests := map[string]bool{
+		"ak_qcqXt6ySgRPvBkNwEpNMvaKWzrhPZsoBHLvgg68qg9vRht62y": true,
+		"ak_qcqXt6ySgRPvBkNwEpNMvaKWzrhPZsoBHLvgg68qg9vRht62z": false,
+		"ct_11111111111111111111111111111111273Yts":            false,
+		"": false,
+	}
+
+	for address, expect := range tests {
+		if isAccountAddress(address) != expect {
+			t.Errorf("isAccountAddress(%q) != %v", address, expect)
+		}
+	}
+}
+
+//testBatchWrapper 离线测试用的钱包，只提供地址查询
+type testBatchWrapper struct {
+	openwallet.WalletDAIBase
+}
+
+func (w *testBatchWrapper) GetAddress(address string) (*openwallet.Address, error) {
+	return &openwallet.Address{AccountID: "batch", Address: address}, nil
+}
+
+func TestSelectFunding(t *testing.T) {
+
+	fundings := []*AddrBalance{
+		{Address: "a", Balance: big.NewInt(100)},
+		{Address: "b", Balance: big.NewInt(50)},
+	}
+
+	if f := selectFunding(fundings, big.NewInt(60)); f == nil || f.Address != "a" {
+		t.Errorf("selectFunding(60) = %v", f)
+	}
+	fundings[0].Balance.SetInt64(40)
+	if f := selectFunding(fundings, big.NewInt(50)); f == nil || f.Address != "b" {
+		t.Errorf("selectFunding(50) = %v", f)
+	}
+	if f := selectFunding(fundings, big.NewInt(51)); f != nil {
+		t.Errorf("selectFunding(51) = %v", f)
+	}
+}
+
+func TestCreateBatchItem(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "batch")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	wm := NewWalletManager()
+	wm.Config.dbPath = dir
+	defer wm.CloseDB()
+	decoder := NewTransactionDecoder(wm)
+	wrapper := &testBatchWrapper{}
+
+	from1 := "ak_qcqXt6ySgRPvBkNwEpNMvaKWzrhPZsoBHLvgg68qg9vRht62y"
+	from2 := "ak_2a1j2Mk9YSmC1gioUq4PWRm3bsv887MbuRVwyv4KaUGoR1eiKi"
+	to := "ak_2iBPH7HUz3cSDVEUWiHg76MZJ6tZooVNBmmxcgVK6VV8KAE688"
+
+	fundings := []*AddrBalance{
+		{Address: from1, Balance: new(big.Int).Mul(big.NewInt(8), big.NewInt(1e18))},
+		{Address: from2, Balance: new(big.Int).Mul(big.NewInt(5), big.NewInt(1e18))},
+	}
+	//预先提供nonce状态，不查询节点
+	nonceStates := map[string]*accountNonceState{
+		from1: {Address: from1, TTL: 600, AccountNonce: 1, Height: 100},
+		from2: {Address: from2, TTL: 600, AccountNonce: 7, Height: 100},
+	}
+
+	createItem := func(amount, memo string) (*openwallet.RawTransaction, error) {
+		rawTx := &openwallet.RawTransaction{
+			Coin:    openwallet.Coin{Symbol: wm.Symbol()},
+			Account: &openwallet.AssetsAccount{AccountID: "batch"},
+			To:      map[string]string{to: amount},
+		}
+		return rawTx, decoder.createBatchItem(wrapper, rawTx, to, amount, memo, fundings, nonceStates)
+	}
+
+	//单个接收地址的错误不扣减余额
+	for _, item := range []struct {
+		destination, amount, memo string
+	}{
+		{"ak_invalid", "1", ""},
+		{to, "0", ""},
+		{to, "1", "ba_Xfbg4w=="},
+	} {
+		rawTx := &openwallet.RawTransaction{To: map[string]string{item.destination: item.amount}}
+		if err := decoder.createBatchItem(wrapper, rawTx, item.destination, item.amount, item.memo, fundings, nonceStates); err == nil {
+			t.Errorf("createBatchItem(%s, %s, %s) should fail", item.destination, item.amount, item.memo)
+		}
+	}
+	if fundings[0].Balance.String() != "8000000000000000000" || fundings[1].Balance.String() != "5000000000000000000" {
+		t.Errorf("balances changed after failed items: %s, %s", fundings[0].Balance.String(), fundings[1].Balance.String())
+	}
+
+	//第一笔从余额最大的地址扣减转账数量和手续费
+	rawTx, err := createItem("3", "")
+	if err != nil {
+		t.Fatalf("createBatchItem error: %v", err)
+	}
+	fee := rawTx.Fees
+	if rawTx.TxFrom[0] != from1+":3" || rawTx.GetExtParam().Get("nonce").Uint() != 2 {
+		t.Errorf("createBatchItem from = %v, nonce = %d", rawTx.TxFrom, rawTx.GetExtParam().Get("nonce").Uint())
+	}
+	left := big.NewInt(5e18)
+	left.Sub(left, common.StringNumToBigIntWithExp(fee, wm.Decimal()))
+	if fundings[0].Balance.Cmp(left) != 0 {
+		t.Errorf("balance of %s = %s, want %s", from1, fundings[0].Balance.String(), left.String())
+	}
+
+	//两个地址的剩余余额都不足
+	if _, err := createItem("5", ""); err == nil {
+		t.Errorf("createBatchItem with insufficient balance should fail")
+	}
+
+	//第一个地址余额仍然足够，使用下一个nonce
+	rawTx, err = createItem("4", "order:10086")
+	if err != nil {
+		t.Fatalf("createBatchItem error: %v", err)
+	}
+	if rawTx.TxFrom[0] != from1+":4" || rawTx.GetExtParam().Get("nonce").Uint() != 3 {
+		t.Errorf("createBatchItem from = %v, nonce = %d", rawTx.TxFrom, rawTx.GetExtParam().Get("nonce").Uint())
+	}
+
+	//第二个地址使用自己的nonce状态
+	rawTx, err = createItem("2", "")
+	if err != nil {
+		t.Fatalf("createBatchItem error: %v", err)
+	}
+	if rawTx.TxFrom[0] != from2+":2" || rawTx.GetExtParam().Get("nonce").Uint() != 8 {
+		t.Errorf("createBatchItem from = %v, nonce = %d", rawTx.TxFrom, rawTx.GetExtParam().Get("nonce").Uint())
+	}
+}
+
+func TestCreateRawTransactionMultipleReceivers(t *testing.T) {
+
+	decoder := NewTransactionDecoder(NewWalletManager())
+	rawTx := &openwallet.RawTransaction{
+		To: map[string]string{
+			"ak_qcqXt6ySgRPvBkNwEpNMvaKWzrhPZsoBHLvgg68qg9vRht62y":  "1",
+			"ak_2iBPH7HUz3cSDVEUWiHg76MZJ6tZooVNBmmxcgVK6VV8KAE688": "1",
+		},
+	}
+	if err := decoder.CreateRawTransaction(nil, rawTx); err == nil {
+		t.Errorf("CreateRawTransaction with multiple receivers should fail")
+	}
+}
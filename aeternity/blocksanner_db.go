@@ -2,6 +2,8 @@ package aeternity
 
 import (
 	"fmt"
+	"github.com/asdine/storm"
+	"github.com/asdine/storm/q"
 	"github.com/blocktree/openwallet/openwallet"
 )
 
@@ -104,3 +106,73 @@ func (bs *AEBlockScanner) GetUnscanRecords() ([]*openwallet.UnscanRecord, error)
 
 	return bs.BlockchainDAI.GetUnscanRecords(bs.wm.Symbol())
 }
+
+//SaveLocalMicroBlock 记录已提取的microblock
+func (bs *AEBlockScanner) SaveLocalMicroBlock(microBlock *MicroBlock) error {
+
+	db, err := bs.wm.openDB()
+	if err != nil {
+		return err
+	}
+
+	return db.Save(microBlock)
+}
+
+//DeleteLocalMicroBlock 删除microblock记录
+func (bs *AEBlockScanner) DeleteLocalMicroBlock(microBlock *MicroBlock) error {
+
+	db, err := bs.wm.openDB()
+	if err != nil {
+		return err
+	}
+
+	return db.DeleteStruct(microBlock)
+}
+
+//DeleteLocalMicroBlocksByHeight 删除指定keyblock高度下的microblock记录
+func (bs *AEBlockScanner) DeleteLocalMicroBlocksByHeight(height uint64) error {
+
+	db, err := bs.wm.openDB()
+	if err != nil {
+		return err
+	}
+
+	return db.Select(q.Eq("Height", height)).Delete(new(MicroBlock))
+}
+
+//GetLocalMicroBlocks 获取指定keyblock高度下已提取的microblock
+func (bs *AEBlockScanner) GetLocalMicroBlocks(height uint64) ([]*MicroBlock, error) {
+
+	db, err := bs.wm.openDB()
+	if err != nil {
+		return nil, err
+	}
+
+	var microBlocks []*MicroBlock
+	err = db.Find("Height", height, &microBlocks)
+	if err != nil && err != storm.ErrNotFound {
+		return nil, err
+	}
+
+	return microBlocks, nil
+}
+
+//IsMicroBlockExtracted microblock是否已提取，数据库读取失败时返回错误，不能当作未提取
+func (bs *AEBlockScanner) IsMicroBlockExtracted(hash string) (bool, error) {
+
+	db, err := bs.wm.openDB()
+	if err != nil {
+		return false, err
+	}
+
+	var microBlock MicroBlock
+	err = db.One("Hash", hash, &microBlock)
+	if err == storm.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
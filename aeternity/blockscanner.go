@@ -2,10 +2,13 @@ package aeternity
 
 import (
 	"fmt"
+	"github.com/aeternity/aepp-sdk-go/aeternity"
+	"github.com/aeternity/aepp-sdk-go/swagguard/node/client/external"
 	"github.com/aeternity/aepp-sdk-go/swagguard/node/models"
 	"github.com/blocktree/openwallet/common"
 	"github.com/blocktree/openwallet/openwallet"
 	"math/big"
+	"strings"
 	"time"
 )
 
@@ -22,7 +25,7 @@ type AEBlockScanner struct {
 	CurrentBlockHeight   uint64         //当前区块高度
 	extractingCH         chan struct{}  //扫描工作令牌
 	wm                   *WalletManager //钱包管理者
-	RescanLastBlockCount uint64         //重扫上N个区块数量
+	RescanLastBlockCount uint64         //Deprecated: 不再重扫上N个区块，按已提取的microblock记录只提取新增的microblock
 }
 
 //ExtractResult extract result
@@ -41,6 +44,23 @@ type ExtractResult struct {
 	Success      bool
 }
 
+//TxIDs 提取到相关数据的交易单ID
+func (r *ExtractResult) TxIDs() []string {
+	txIDs := make([]string, 0)
+	for _, txResult := range r.extractData {
+		if len(txResult.extractData) > 0 {
+			txIDs = append(txIDs, txResult.TxID)
+		}
+	}
+	return txIDs
+}
+
+//MicroForkNotificationObject 微分叉观测者，可选实现
+//orphans为被丢弃的microblock，其TxIDs记录了已通知过的交易单，观测者应回滚这些交易单
+type MicroForkNotificationObject interface {
+	MicroForkNotify(header *openwallet.BlockHeader, orphans []*MicroBlock) error
+}
+
 //SaveResult result
 type SaveResult struct {
 	TxID        string
@@ -58,8 +78,7 @@ func NewAEBlockScanner(wm *WalletManager) *AEBlockScanner {
 	bs.wm = wm
 
 	//AE区块链分为keyblock和microblock，keyblock记录记账权，不记录交易，microblock记录交易
-	//所以顶部的keyblock后续出的区块是动态的，不能只扫描一次，要反复地扫描 顶部 - 3 个块，保证新增的microblock
-	bs.RescanLastBlockCount = 3
+	//所以顶部的keyblock后续出的区块是动态的，扫描器记录每代已提取的microblock，只提取新增的microblock
 
 	// set task
 	bs.SetTask(bs.ScanBlockTask)
@@ -255,7 +274,8 @@ func (bs *AEBlockScanner) GetTransactionsByMicroBlockHash(hash string) ([]*model
 	gtxArray := make([]*models.GenericSignedTx, 0)
 
 	for _, tx := range txs.Array() {
-		if tx.Get("tx.type").String() == "SpendTx" {
+		txType := tx.Get("tx.type").String()
+		if txType == "SpendTx" || txType == "ContractCallTx" {
 			gtx := &models.GenericSignedTx{}
 			err := gtx.UnmarshalJSON([]byte(tx.Raw))
 			if err != nil {
@@ -265,11 +285,9 @@ func (bs *AEBlockScanner) GetTransactionsByMicroBlockHash(hash string) ([]*model
 		}
 	}
 
-
 	return gtxArray, nil
 }
 
-
 //GetTransactionsByBlockHash
 func (bs *AEBlockScanner) GetTransactionsByBlock(block *Block) ([]*models.GenericSignedTx, error) {
 
@@ -297,6 +315,9 @@ func (bs *AEBlockScanner) ScanBlockTask() {
 	currentHeight := blockHeader.Height
 	currentHash := blockHeader.Hash
 
+	//上一次循环扫描的区块，追块时用于比较上一代的microblock，不用重新获取
+	var prevBlock *Block
+
 	for {
 
 		if !bs.Scanning {
@@ -344,46 +365,36 @@ func (bs *AEBlockScanner) ScanBlockTask() {
 			bs.wm.Log.Std.Info("block height: %d local hash = %s ", currentHeight-1, currentHash)
 			bs.wm.Log.Std.Info("block height: %d mainnet hash = %s ", currentHeight-1, block.Previousblockhash)
 
-			bs.wm.Log.Std.Info("delete recharge records on block height: %d.", currentHeight-1)
-
-			//查询本地分叉的区块
-			forkBlock, _ := bs.GetLocalBlock(currentHeight - 1)
-
-			//删除上一区块链的所有充值记录
-			//bs.DeleteRechargesByHeight(currentHeight - 1)
-			//删除上一区块链的未扫记录
-			bs.DeleteUnscanRecord(currentHeight - 1)
-			currentHeight = currentHeight - 2 //倒退2个区块重新扫描
-			if currentHeight <= 0 {
-				currentHeight = 1
-			}
-
-			localBlock, err := bs.GetLocalBlock(currentHeight)
+			//回溯本地区块，找到共同祖先
+			ancestor, forkBlocks, err := bs.findCommonAncestor(currentHeight-1, currentHash)
 			if err != nil {
-				bs.wm.Log.Std.Warning("block scanner can not get local block; unexpected error: %v", err)
+				bs.wm.Log.Std.Error("block scanner can not find common ancestor; unexpected error: %v", err)
+				break
+			}
 
-				//查找core钱包的RPC
-				bs.wm.Log.Info("block scanner prev block height:", currentHeight)
+			for _, forkBlock := range forkBlocks {
 
-				localBlock, err = bs.GetBlockByHeight(currentHeight)
-				if err != nil {
-					bs.wm.Log.Std.Error("block scanner can not get prev block; unexpected error: %v", err)
-					break
-				}
+				bs.wm.Log.Std.Info("delete recharge records on block height: %d.", forkBlock.Height)
 
+				//删除分叉区块的未扫记录
+				bs.DeleteUnscanRecord(forkBlock.Height)
+				//删除分叉区块已提取的microblock记录
+				bs.DeleteLocalMicroBlocksByHeight(forkBlock.Height)
 			}
 
-			//重置当前区块的hash
-			currentHash = localBlock.Hash
+			//重置当前区块的高度和hash
+			currentHeight = ancestor.Height
+			currentHash = ancestor.Hash
 
 			bs.wm.Log.Std.Info("rescan block on height: %d, hash: %s .", currentHeight, currentHash)
 
 			//重新记录一个新扫描起点
-			bs.SaveLocalBlockHead(localBlock.Height, localBlock.Hash)
+			bs.SaveLocalBlockHead(ancestor.Height, ancestor.Hash)
 
 			isFork = true
+			prevBlock = nil
 
-			if forkBlock != nil {
+			for _, forkBlock := range forkBlocks {
 
 				//通知分叉区块给观测者，异步处理
 				bs.newBlockNotify(forkBlock, isFork)
@@ -391,7 +402,21 @@ func (bs *AEBlockScanner) ScanBlockTask() {
 
 		} else {
 
-			err = bs.BatchExtractTransaction(block)
+			//上一代的microblock已确定，处理微分叉和上次扫描后新增的microblock
+			//上一代的microblock列表不一致时不能确定微分叉，下次扫描重试该高度
+			if prevErr := bs.scanPrevGeneration(currentHeight-1, block.PrevHash, prevBlock); prevErr != nil {
+				bs.wm.Log.Std.Error("block scanner can not resolve micro blocks on height: %d; unexpected error: %v", currentHeight-1, prevErr)
+				break
+			}
+
+			//读取不到已提取记录时不能重复提取，下次扫描重试该高度
+			microBlocks, err := bs.GetUnextractedMicroBlocks(block)
+			if err != nil {
+				bs.wm.Log.Std.Error("block scanner can not get local micro blocks on height: %d; unexpected error: %v", currentHeight, err)
+				break
+			}
+
+			err = bs.BatchExtractTransaction(block, microBlocks)
 			if err != nil {
 				bs.wm.Log.Std.Info("block scanner can not extractRechargeRecords; unexpected error: %v", err)
 			}
@@ -404,6 +429,7 @@ func (bs *AEBlockScanner) ScanBlockTask() {
 			bs.SaveLocalBlock(block)
 
 			isFork = false
+			prevBlock = block
 
 			//通知新区块给观测者，异步处理
 			bs.newBlockNotify(block, isFork)
@@ -411,16 +437,62 @@ func (bs *AEBlockScanner) ScanBlockTask() {
 
 	}
 
-	//重扫前N个块，为保证记录找到
-	for i := currentHeight - bs.RescanLastBlockCount; i < currentHeight; i++ {
-		bs.scanBlock(i + 1)
-	}
+	//提取当前代新增的microblock
+	bs.scanTopMicroBlocks(currentHeight)
 
 	//重扫失败区块
 	bs.RescanFailedRecord()
 
 }
 
+//findCommonAncestor 从height开始向下回溯本地区块，与链上区块比较，找到共同祖先，headHash为本地记录的height高度的区块hash
+//返回共同祖先区块和被抛弃的本地区块，回溯深度超过MaxRollbackDepth时告警并返回错误，停止扫描等待人工处理
+func (bs *AEBlockScanner) findCommonAncestor(height uint64, headHash string) (*Block, []*Block, error) {
+
+	var (
+		forkBlocks = make([]*Block, 0)
+		maxDepth   = bs.wm.Config.MaxRollbackDepth
+	)
+
+	for depth := uint64(0); ; depth++ {
+
+		chainBlock, err := bs.GetBlockByHeight(height)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		//高度1为创世区块后的第一个区块，不再回溯
+		if height <= 1 {
+			return chainBlock, forkBlocks, nil
+		}
+
+		localBlock, err := bs.GetLocalBlock(height)
+		if err != nil {
+			if depth > 0 {
+				//本地没有更早的记录，无法继续比较，以链上区块为起点
+				bs.wm.Log.Std.Warning("block scanner can not get local block on height: %d; unexpected error: %v", height, err)
+				return chainBlock, forkBlocks, nil
+			}
+			//本地扫描起点的区块已分叉，使用扫描起点的hash
+			localBlock = &Block{Hash: headHash, Height: height}
+		}
+
+		if localBlock.Hash == chainBlock.Hash {
+			return chainBlock, forkBlocks, nil
+		}
+
+		if depth >= maxDepth {
+			bs.wm.Log.Std.Alert("block scanner rollback depth exceeds max rollback depth: %d, common ancestor not found above height: %d. Scanning is stopped, please check manually!", maxDepth, height)
+			return nil, nil, fmt.Errorf("rollback depth exceeds max rollback depth: %d", maxDepth)
+		}
+
+		bs.wm.Log.Std.Info("block height: %d local hash = %s, mainnet hash = %s ", height, localBlock.Hash, chainBlock.Hash)
+
+		forkBlocks = append(forkBlocks, localBlock)
+		height = height - 1
+	}
+}
+
 //ScanBlock 扫描指定高度区块
 func (bs *AEBlockScanner) ScanBlock(height uint64) error {
 
@@ -449,7 +521,14 @@ func (bs *AEBlockScanner) scanBlock(height uint64) (*Block, error) {
 
 	bs.wm.Log.Std.Info("block scanner rescanning height: %d ...", block.Height)
 
-	err = bs.BatchExtractTransaction(block)
+	//已提取的microblock不再提取，避免重复通知
+	microBlocks, err := bs.GetUnextractedMicroBlocks(block)
+	if err != nil {
+		bs.wm.Log.Std.Error("block scanner can not get local micro blocks on height: %d; unexpected error: %v", height, err)
+		return nil, err
+	}
+
+	err = bs.BatchExtractTransaction(block, microBlocks)
 	if err != nil {
 		bs.wm.Log.Std.Info("block scanner can not extractRechargeRecords; unexpected error: %v", err)
 		return nil, err
@@ -460,11 +539,183 @@ func (bs *AEBlockScanner) scanBlock(height uint64) (*Block, error) {
 	return block, nil
 }
 
-//rescanFailedRecord 重扫失败记录
+//scanTopMicroBlocks 通过顶部区块判断当前代是否有新的microblock，只提取未提取过的microblock
+func (bs *AEBlockScanner) scanTopMicroBlocks(currentHeight uint64) {
+
+	top, err := bs.GetTopBlock()
+	if err != nil {
+		bs.wm.Log.Std.Info("block scanner can not get top block; unexpected error: %v", err)
+		return
+	}
+
+	//顶部是keyblock，当前代还没有microblock
+	if top.MicroBlock == nil {
+		return
+	}
+
+	//只处理已扫描到的当前代
+	if *top.MicroBlock.Height != currentHeight {
+		return
+	}
+
+	extracted, err := bs.IsMicroBlockExtracted(*top.MicroBlock.Hash)
+	if err != nil {
+		bs.wm.Log.Std.Error("block scanner can not get local micro block; unexpected error: %v", err)
+		return
+	}
+	if extracted {
+		return
+	}
+
+	block, err := bs.GetBlockByHeight(currentHeight)
+	if err != nil {
+		bs.wm.Log.Std.Info("block scanner can not get new block data; unexpected error: %v", err)
+		return
+	}
+
+	microBlocks, err := bs.GetUnextractedMicroBlocks(block)
+	if err != nil {
+		bs.wm.Log.Std.Error("block scanner can not get local micro blocks; unexpected error: %v", err)
+		return
+	}
+
+	bs.wm.Log.Std.Info("block scanner scanning height: %d, new micro blocks: %d ...", currentHeight, len(microBlocks))
+
+	err = bs.BatchExtractTransaction(block, microBlocks)
+	if err != nil {
+		bs.wm.Log.Std.Info("block scanner can not extractRechargeRecords; unexpected error: %v", err)
+	}
+}
+
+//scanPrevGeneration 新keyblock出现后，上一代的microblock已确定，lastHash为新keyblock的prev_hash
+//1. 已提取但不在上一代最终列表中的microblock被微分叉丢弃，通知观测者回滚
+//2. 上次扫描后新增的microblock，补充提取
+//cached为本次任务刚扫描的上一代区块，追块时其列表已是最终列表，直接比较，只有链顶部才重新获取。
+//节点返回的上一代最后一个microblock不是lastHash时，列表还未同步，返回错误由下次扫描重试
+func (bs *AEBlockScanner) scanPrevGeneration(height uint64, lastHash string, cached *Block) error {
+
+	extracted, err := bs.GetLocalMicroBlocks(height)
+	if err != nil {
+		return err
+	}
+
+	//上一代没有microblock，也没有提取过
+	isKeyBlockHash := strings.HasPrefix(lastHash, string(aeternity.PrefixKeyBlockHash))
+	if isKeyBlockHash && len(extracted) == 0 {
+		return nil
+	}
+
+	block := cached
+	if !isFinalGeneration(cached, height, lastHash) {
+		block, err = bs.getFinalGeneration(height, lastHash)
+		if err != nil {
+			return err
+		}
+	}
+
+	finalMap := make(map[string]bool)
+	for _, mb := range block.MicroBlocks {
+		finalMap[mb] = true
+	}
+
+	orphans := make([]*MicroBlock, 0)
+	for _, mb := range extracted {
+		if !finalMap[mb.Hash] {
+			orphans = append(orphans, mb)
+		}
+	}
+
+	if len(orphans) > 0 {
+		bs.wm.Log.Std.Info("block height: %d has %d orphaned micro blocks", height, len(orphans))
+		bs.newMicroForkNotify(block, orphans)
+		for _, mb := range orphans {
+			bs.DeleteLocalMicroBlock(mb)
+		}
+	}
+
+	microBlocks, err := bs.GetUnextractedMicroBlocks(block)
+	if err != nil {
+		return err
+	}
+	if len(microBlocks) == 0 {
+		return nil
+	}
+
+	bs.wm.Log.Std.Info("block scanner scanning height: %d, late micro blocks: %d ...", height, len(microBlocks))
+
+	err = bs.BatchExtractTransaction(block, microBlocks)
+	if err != nil {
+		bs.wm.Log.Std.Info("block scanner can not extractRechargeRecords; unexpected error: %v", err)
+	}
+	return nil
+}
+
+//isFinalGeneration 区块是否为height高度的最终microblock列表，最后一个microblock是lastHash，
+//lastHash是keyblock时区块没有microblock
+func isFinalGeneration(block *Block, height uint64, lastHash string) bool {
+	if block == nil || block.Height != height {
+		return false
+	}
+	if strings.HasPrefix(lastHash, string(aeternity.PrefixKeyBlockHash)) {
+		return len(block.MicroBlocks) == 0
+	}
+	return len(block.MicroBlocks) > 0 && block.MicroBlocks[len(block.MicroBlocks)-1] == lastHash
+}
+
+//getFinalGeneration 获取上一代最终的microblock列表，最后一个microblock必须是lastHash，
+//lastHash是keyblock时上一代没有microblock，不一致时重新获取一次
+func (bs *AEBlockScanner) getFinalGeneration(height uint64, lastHash string) (*Block, error) {
+
+	for retry := 0; retry < 2; retry++ {
+
+		block, err := bs.GetBlockByHeight(height)
+		if err != nil {
+			return nil, err
+		}
+
+		if strings.HasPrefix(lastHash, string(aeternity.PrefixKeyBlockHash)) {
+			block.MicroBlocks = []string{}
+			return block, nil
+		}
+
+		if len(block.MicroBlocks) > 0 && block.MicroBlocks[len(block.MicroBlocks)-1] == lastHash {
+			return block, nil
+		}
+
+		bs.wm.Log.Std.Warning("block height: %d last micro block is not equal to prev_hash: %s", height, lastHash)
+	}
+
+	return nil, fmt.Errorf("micro blocks of height: %d are inconsistent with prev_hash: %s", height, lastHash)
+}
+
+//GetUnextractedMicroBlocks 获取区块中未提取的microblock，读取本地记录失败时返回错误，避免重复提取
+func (bs *AEBlockScanner) GetUnextractedMicroBlocks(block *Block) ([]string, error) {
+
+	extracted, err := bs.GetLocalMicroBlocks(block.Height)
+	if err != nil {
+		return nil, err
+	}
+
+	extractedMap := make(map[string]bool)
+	for _, mb := range extracted {
+		extractedMap[mb.Hash] = true
+	}
+
+	microBlocks := make([]string, 0)
+	for _, mb := range block.MicroBlocks {
+		if !extractedMap[mb] {
+			microBlocks = append(microBlocks, mb)
+		}
+	}
+
+	return microBlocks, nil
+}
+
+//rescanFailedRecord 重扫失败记录，记录了microblock的只重扫该microblock，已提取的microblock不再提取
 func (bs *AEBlockScanner) RescanFailedRecord() {
 
 	var (
-		blockMap = make(map[uint64][]models.EncodedHash)
+		blockMap = make(map[uint64]map[string]bool)
 	)
 
 	list, err := bs.GetUnscanRecords()
@@ -476,18 +727,14 @@ func (bs *AEBlockScanner) RescanFailedRecord() {
 	for _, r := range list {
 
 		if _, exist := blockMap[r.BlockHeight]; !exist {
-			blockMap[r.BlockHeight] = make([]models.EncodedHash, 0)
+			blockMap[r.BlockHeight] = make(map[string]bool)
 		}
 
-		//if len(r.MicroBlockID) > 0 {
-		//	arr := blockMap[r.BlockHeight]
-		//	arr = append(arr, models.EncodedHash(r.MicroBlockID))
-		//
-		//	blockMap[r.BlockHeight] = arr
-		//}
+		//TxID记录提取失败的microblock，为空时重扫整代
+		blockMap[r.BlockHeight][r.TxID] = true
 	}
 
-	for height, _ := range blockMap {
+	for height, targets := range blockMap {
 
 		if height == 0 {
 			continue
@@ -501,7 +748,14 @@ func (bs *AEBlockScanner) RescanFailedRecord() {
 			continue
 		}
 
-		err = bs.BatchExtractTransaction(block)
+		microBlocks, err := bs.GetUnextractedMicroBlocks(block)
+		if err != nil {
+			bs.wm.Log.Std.Error("block scanner can not get local micro blocks on height: %d; unexpected error: %v", height, err)
+			continue
+		}
+		microBlocks = filterRescanMicroBlocks(microBlocks, targets)
+
+		err = bs.BatchExtractTransaction(block, microBlocks)
 		if err != nil {
 			bs.wm.Log.Std.Info("block scanner can not extractRechargeRecords; unexpected error: %v", err)
 			continue
@@ -513,6 +767,36 @@ func (bs *AEBlockScanner) RescanFailedRecord() {
 
 }
 
+//filterRescanMicroBlocks 只保留重扫记录中的microblock，targets包含空字符串时重扫整代。
+//已被微分叉丢弃的microblock不在链上的列表中，不再重扫
+func filterRescanMicroBlocks(microBlocks []string, targets map[string]bool) []string {
+	if targets[""] {
+		return microBlocks
+	}
+	filtered := make([]string, 0)
+	for _, mb := range microBlocks {
+		if targets[mb] {
+			filtered = append(filtered, mb)
+		}
+	}
+	return filtered
+}
+
+//newMicroForkNotify 通知微分叉丢弃的microblock给观测者，只有实现MicroForkNotificationObject的观测者会收到
+func (bs *AEBlockScanner) newMicroForkNotify(block *Block, orphans []*MicroBlock) {
+	header := block.BlockHeader(bs.wm.Symbol())
+	for o, _ := range bs.Observers {
+		obj, ok := o.(MicroForkNotificationObject)
+		if !ok {
+			continue
+		}
+		err := obj.MicroForkNotify(header, orphans)
+		if err != nil {
+			bs.wm.Log.Error("MicroForkNotify unexpected error:", err)
+		}
+	}
+}
+
 //newBlockNotify 获得新区块后，通知给观测者
 func (bs *AEBlockScanner) newBlockNotify(block *Block, isFork bool) {
 	header := block.BlockHeader(bs.wm.Symbol())
@@ -520,18 +804,18 @@ func (bs *AEBlockScanner) newBlockNotify(block *Block, isFork bool) {
 	bs.NewBlockNotify(header)
 }
 
-//BatchExtractTransaction 批量提取交易单
+//BatchExtractTransaction 批量提取交易单，只提取microBlocks中的microblock
 //bitcoin 1M的区块链可以容纳3000笔交易，批量多线程处理，速度更快
-func (bs *AEBlockScanner) BatchExtractTransaction(block *Block) error {
+func (bs *AEBlockScanner) BatchExtractTransaction(block *Block, microBlocks []string) error {
 
 	var (
 		quit       = make(chan struct{})
 		done       = 0 //完成标记
 		failed     = 0
-		shouldDone = len(block.MicroBlocks) //需要完成的总数
+		shouldDone = len(microBlocks) //需要完成的总数
 	)
 
-	if len(block.MicroBlocks) == 0 {
+	if len(microBlocks) == 0 {
 		return nil
 	}
 
@@ -555,13 +839,19 @@ func (bs *AEBlockScanner) BatchExtractTransaction(block *Block) error {
 				if notifyErr != nil {
 					failed++ //标记保存失败数
 					bs.wm.Log.Std.Info("newExtractDataNotify unexpected error: %v", notifyErr)
+				} else {
+					//记录已提取的microblock
+					saveErr := bs.SaveLocalMicroBlock(NewMicroBlock(height, gets.MicroBlockID, gets.TxIDs()))
+					if saveErr != nil {
+						bs.wm.Log.Std.Error("micro block: %s, save failed. unexpected error: %v", gets.MicroBlockID, saveErr)
+					}
 				}
 
 			} else {
-				//记录未扫区块
-				unscanRecord := openwallet.NewUnscanRecord(height, "", "", bs.wm.Symbol())
+				//记录未扫区块，TxID记录提取失败的microblock，重扫时只提取该microblock
+				unscanRecord := openwallet.NewUnscanRecord(height, gets.MicroBlockID, "", bs.wm.Symbol())
 				bs.SaveUnscanRecord(unscanRecord)
-				bs.wm.Log.Std.Info("block height: %d extract failed.", height)
+				bs.wm.Log.Std.Info("block height: %d micro block: %s extract failed.", height, gets.MicroBlockID)
 				failed++ //标记保存失败数
 			}
 			//累计完成的线程数
@@ -575,7 +865,7 @@ func (bs *AEBlockScanner) BatchExtractTransaction(block *Block) error {
 
 	//提取工作
 	extractWork := func(eBlock *Block, eProducer chan ExtractResult) {
-		for _, mid := range eBlock.MicroBlocks {
+		for _, mid := range microBlocks {
 			bs.extractingCH <- struct{}{}
 			//shouldDone++
 			go func(mBlock *Block, mMid string, end chan struct{}, mProducer chan<- ExtractResult) {
@@ -705,6 +995,16 @@ func (bs *AEBlockScanner) ExtractTransaction(block *Block, microBlockID string,
 		from := *spendTxJSON.SenderID
 		to := *spendTxJSON.RecipientID
 
+		//解析payload作为转账备注，非文本内容以十六进制记录
+		memo, memoIsHex := "", false
+		if spendTxJSON.Payload != nil {
+			var memoErr error
+			memo, memoIsHex, memoErr = PayloadToMemo(*spendTxJSON.Payload)
+			if memoErr != nil {
+				bs.wm.Log.Errorf("tx [%s] payload decode failed, err: %v", txID, memoErr)
+			}
+		}
+
 		sourceKey, ok := scanTargetFunc(
 			openwallet.ScanTarget{
 				Address:          from,
@@ -740,11 +1040,7 @@ func (bs *AEBlockScanner) ExtractTransaction(block *Block, microBlockID string,
 			ed.TxInputs = append(ed.TxInputs, feeCharge)
 		}
 
-		sourceKey2, ok2 := scanTargetFunc(
-			openwallet.ScanTarget{
-				Address:          *spendTxJSON.RecipientID,
-				BalanceModelType: openwallet.BalanceModelTypeAddress,
-			})
+		sourceKey2, ok2 := bs.scanRecipient(scanTargetFunc, to, memo)
 		if ok2 {
 			output := openwallet.TxOutPut{}
 			output.TxID = txID
@@ -761,6 +1057,7 @@ func (bs *AEBlockScanner) ExtractTransaction(block *Block, microBlockID string,
 			output.BlockHeight = bigHeight.Uint64()
 			//output.BlockHash = string(trx.BlockHash)
 			output.BlockHash = block.Hash //TODO: 先记录keyblock的hash方便上层计算确认次数，以后做扩展
+			setOutputMemo(&output, memo, memoIsHex)
 			ed := result.extractData[sourceKey2]
 			if ed == nil {
 				ed = openwallet.NewBlockExtractData()
@@ -792,10 +1089,23 @@ func (bs *AEBlockScanner) ExtractTransaction(block *Block, microBlockID string,
 				//SubmitTime:  int64(block.Time),
 				ConfirmTime: int64(block.Time),
 			}
+			setTransactionMemo(tx, memo, memoIsHex)
 			wxID := openwallet.GenTransactionWxID(tx)
 			tx.WxID = wxID
 			extractData.Transaction = tx
 		}
+	case "ContractCallTx":
+		//单笔合约调用解析失败不影响整个micro block的提取
+		contractCallTxJSON, ok := trx.Tx().(*models.ContractCallTxJSON)
+		if !ok {
+			bs.wm.Log.Errorf("tx [%s] can not convert models.ContractCallTxJSON, skip it", txID)
+			return result, nil
+		}
+		err := bs.extractContractCallTx(block, trx, &contractCallTxJSON.ContractCallTx, scanTargetFunc, result)
+		if err != nil {
+			bs.wm.Log.Errorf("tx [%s] extract contract call failed, skip it, err: %v", txID, err)
+			return result, nil
+		}
 	default:
 		return result, nil
 	}
@@ -804,6 +1114,224 @@ func (bs *AEBlockScanner) ExtractTransaction(block *Block, microBlockID string,
 
 }
 
+//scanRecipient 查找收款地址所属的账户，转入共享充值地址的交易按转账备注作为别名查找账户，
+//备注找不到账户时按地址查找
+func (bs *AEBlockScanner) scanRecipient(scanTargetFunc openwallet.BlockScanTargetFunc, to, memo string) (string, bool) {
+	if bs.wm.Config.IsSharedDepositAddress(to) && len(memo) > 0 {
+		sourceKey, ok := scanTargetFunc(
+			openwallet.ScanTarget{
+				Alias:            memo,
+				Symbol:           bs.wm.Symbol(),
+				BalanceModelType: openwallet.BalanceModelTypeAccount,
+			})
+		if ok {
+			return sourceKey, true
+		}
+		bs.wm.Log.Infof("deposit memo [%s] to shared address is not attributed to any account", memo)
+	}
+	return scanTargetFunc(
+		openwallet.ScanTarget{
+			Address:          to,
+			BalanceModelType: openwallet.BalanceModelTypeAddress,
+		})
+}
+
+//extractContractCallTx 提取调用AEX-9代币合约的交易单，通过交易回执中的Transfer事件解析代币转账
+func (bs *AEBlockScanner) extractContractCallTx(block *Block, trx *models.GenericSignedTx, callTx *models.ContractCallTx, scanTargetFunc openwallet.BlockScanTargetFunc, result *ExtractTxResult) error {
+
+	var (
+		txID            = *trx.Hash
+		contractAddress = *callTx.ContractID
+		caller          = *callTx.CallerID
+		createAt        = time.Now().Unix()
+		decimals        = bs.wm.Decimal()
+		bigHeight       = big.Int(trx.BlockHeight)
+	)
+
+	if !bs.wm.Config.IsWatchContract(contractAddress) {
+		return nil
+	}
+
+	callerKey, callerOK := scanTargetFunc(openwallet.ScanTarget{
+		Address:          caller,
+		BalanceModelType: openwallet.BalanceModelTypeAddress,
+	})
+
+	callInfo, err := bs.GetContractCallInfo(txID)
+	if err != nil {
+		return err
+	}
+
+	transfers := make([]*AEX9TransferEvent, 0)
+	status := "1"
+	reason := ""
+	if callInfo.ReturnType == nil || *callInfo.ReturnType != "ok" {
+		status = "0"
+		if callInfo.ReturnType != nil {
+			reason = *callInfo.ReturnType
+		}
+	} else {
+		for _, event := range callInfo.Log {
+			transfer := NewAEX9TransferEvent(event)
+			if transfer != nil && transfer.Contract == contractAddress {
+				transfers = append(transfers, transfer)
+			}
+		}
+	}
+
+	//没有相关的代币转账，也不是自己地址发起的调用
+	if len(transfers) == 0 && !callerOK {
+		return nil
+	}
+
+	metaInfo, err := bs.wm.ContractDecoder.GetTokenMetaInfo(contractAddress)
+	if err != nil {
+		return err
+	}
+
+	tokenDecimals := int32(metaInfo.Decimals)
+	contractID := openwallet.GenContractID(bs.wm.Symbol(), contractAddress)
+	coin := openwallet.Coin{
+		Symbol:     bs.wm.Symbol(),
+		IsContract: true,
+		ContractID: contractID,
+		Contract: openwallet.SmartContract{
+			ContractID: contractID,
+			Symbol:     bs.wm.Symbol(),
+			Address:    contractAddress,
+			Token:      metaInfo.Symbol,
+			Name:       metaInfo.Name,
+			Decimals:   metaInfo.Decimals,
+		},
+	}
+
+	//手续费 = fee + 实际燃料消耗
+	//复制数值，big.Int直接转换会共用底层数组，计算时会修改交易单的数据
+	bigFee := new(big.Int).Set((*big.Int)(&callTx.Fee))
+	gasPrice := new(big.Int).Set((*big.Int)(&callInfo.GasPrice))
+	gasFee := new(big.Int).SetUint64(*callInfo.GasUsed)
+	gasFee.Mul(gasFee, gasPrice)
+	bigFee.Add(bigFee, gasFee)
+	fees := common.BigIntToDecimals(bigFee, decimals).String()
+
+	getExtractData := func(sourceKey string) *openwallet.TxExtractData {
+		ed := result.extractData[sourceKey]
+		if ed == nil {
+			ed = openwallet.NewBlockExtractData()
+			result.extractData[sourceKey] = ed
+		}
+		return ed
+	}
+
+	//调用者支付的手续费作为AE的输入
+	if callerOK {
+		feeCharge := openwallet.TxInput{}
+		feeCharge.TxID = txID
+		feeCharge.Address = caller
+		feeCharge.Amount = fees
+		feeCharge.Coin = openwallet.Coin{
+			Symbol:     bs.wm.Symbol(),
+			IsContract: false,
+		}
+		feeCharge.Index = 0
+		feeCharge.Sid = openwallet.GenTxInputSID(txID, bs.wm.Symbol(), "", uint64(0))
+		feeCharge.BlockHeight = bigHeight.Uint64()
+		feeCharge.BlockHash = block.Hash //TODO: 先记录keyblock的hash方便上层计算确认次数，以后做扩展
+		feeCharge.TxType = 1
+		ed := getExtractData(callerKey)
+		ed.TxInputs = append(ed.TxInputs, &feeCharge)
+	}
+
+	from := make([]string, 0)
+	to := make([]string, 0)
+	totalAmount := big.NewInt(0)
+
+	for i, transfer := range transfers {
+
+		amount := common.BigIntToDecimals(transfer.Value, tokenDecimals).String()
+		from = append(from, transfer.From+":"+amount)
+		to = append(to, transfer.To+":"+amount)
+		totalAmount.Add(totalAmount, transfer.Value)
+
+		if sourceKey, ok := scanTargetFunc(openwallet.ScanTarget{
+			Address:          transfer.From,
+			BalanceModelType: openwallet.BalanceModelTypeAddress,
+		}); ok {
+			input := openwallet.TxInput{}
+			input.TxID = txID
+			input.Address = transfer.From
+			input.Amount = amount
+			input.Coin = coin
+			input.Index = uint64(i)
+			input.Sid = openwallet.GenTxInputSID(txID, bs.wm.Symbol(), contractID, uint64(i))
+			input.BlockHeight = bigHeight.Uint64()
+			input.BlockHash = block.Hash //TODO: 先记录keyblock的hash方便上层计算确认次数，以后做扩展
+			input.TxType = 1
+			ed := getExtractData(sourceKey)
+			ed.TxInputs = append(ed.TxInputs, &input)
+		}
+
+		if sourceKey, ok := scanTargetFunc(openwallet.ScanTarget{
+			Address:          transfer.To,
+			BalanceModelType: openwallet.BalanceModelTypeAddress,
+		}); ok {
+			output := openwallet.TxOutPut{}
+			output.TxID = txID
+			output.Address = transfer.To
+			output.Amount = amount
+			output.Coin = coin
+			output.Index = uint64(i)
+			output.Sid = openwallet.GenTxOutPutSID(txID, bs.wm.Symbol(), contractID, uint64(i))
+			output.CreateAt = createAt
+			output.BlockHeight = bigHeight.Uint64()
+			output.BlockHash = block.Hash //TODO: 先记录keyblock的hash方便上层计算确认次数，以后做扩展
+			output.TxType = 1
+			ed := getExtractData(sourceKey)
+			ed.TxOutputs = append(ed.TxOutputs, &output)
+		}
+	}
+
+	for _, extractData := range result.extractData {
+		tx := &openwallet.Transaction{
+			From:        from,
+			To:          to,
+			Amount:      common.BigIntToDecimals(totalAmount, tokenDecimals).String(),
+			Fees:        fees,
+			Coin:        coin,
+			BlockHash:   block.Hash, //TODO: 先记录keyblock的hash方便上层计算确认次数，以后做扩展
+			BlockHeight: bigHeight.Uint64(),
+			TxID:        txID,
+			Decimal:     tokenDecimals,
+			TxType:      1,
+			TxAction:    "Transfer",
+			Status:      status,
+			Reason:      reason,
+			ConfirmTime: int64(block.Time),
+		}
+		wxID := openwallet.GenTransactionWxID(tx)
+		tx.WxID = wxID
+		extractData.Transaction = tx
+	}
+
+	return nil
+}
+
+//GetContractCallInfo 获取合约调用的交易回执
+func (bs *AEBlockScanner) GetContractCallInfo(txid string) (*models.ContractCallObject, error) {
+
+	p := external.NewGetTransactionInfoByHashParams().WithHash(txid)
+	result, err := bs.wm.Api.External.GetTransactionInfoByHash(p)
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Payload.CallInfo == nil {
+		return nil, fmt.Errorf("transaction [%s] has no call info", txid)
+	}
+
+	return result.Payload.CallInfo, nil
+}
+
 //newExtractDataNotify 发送通知
 func (bs *AEBlockScanner) newExtractDataNotify(height uint64, extractTxResult []*ExtractTxResult) error {
 
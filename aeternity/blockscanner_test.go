@@ -3,6 +3,7 @@ package aeternity
 import (
 	"github.com/blocktree/openwallet/log"
 	"github.com/blocktree/openwallet/openwallet"
+	"reflect"
 	"testing"
 )
 
@@ -93,4 +94,47 @@ func TestAEBlockScanner_GetTopBlock(t *testing.T) {
 	log.Infof("key block: %+v", block.KeyBlock)
 	log.Infof("micro block: %+v", block.MicroBlock)
 	log.Infof("height: %d", *block.MicroBlock.Height)
-}
\ No newline at end of file
+}
+
+func TestFilterRescanMicroBlocks(t *testing.T) {
+
+	microBlocks := []string{"mh_1", "mh_2", "mh_3"}
+
+	//记录了microblock时只重扫该microblock，不在链上列表中的被微分叉丢弃
+	filtered := filterRescanMicroBlocks(microBlocks, map[string]bool{"mh_2": true, "mh_orphan": true})
+	if !reflect.DeepEqual(filtered, []string{"mh_2"}) {
+		t.Errorf("filterRescanMicroBlocks = %v, want [mh_2]", filtered)
+	}
+
+	//区块级的失败记录重扫整代未提取的microblock
+	filtered = filterRescanMicroBlocks(microBlocks, map[string]bool{"": true, "mh_2": true})
+	if !reflect.DeepEqual(filtered, microBlocks) {
+		t.Errorf("filterRescanMicroBlocks = %v, want %v", filtered, microBlocks)
+	}
+}
+
+func TestIsFinalGeneration(t *testing.T) {
+
+	block := &Block{Height: 10, MicroBlocks: []string{"mh_1", "mh_2"}}
+
+	tests := []struct {
+		block    *Block
+		height   uint64
+		lastHash string
+		want     bool
+	}{
+		{nil, 10, "mh_2", false},
+		{block, 10, "mh_2", true},
+		{block, 11, "mh_2", false},
+		//列表还未同步到最后一个microblock，需要重新获取
+		{block, 10, "mh_3", false},
+		{block, 10, "kh_1", false},
+		{&Block{Height: 10, MicroBlocks: []string{}}, 10, "kh_1", true},
+	}
+
+	for i, test := range tests {
+		if got := isFinalGeneration(test.block, test.height, test.lastHash); got != test.want {
+			t.Errorf("case %d: isFinalGeneration = %v, want %v", i, got, test.want)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package aeternity
 import (
 	"github.com/blocktree/go-owcrypt"
 	"github.com/blocktree/openwallet/common/file"
+	"github.com/shopspring/decimal"
 	"path/filepath"
 	"strings"
 )
@@ -17,10 +18,36 @@ const (
 
 # RPC api url
 serverAPI = ""
+# internal RPC api url, for contract dry-run, default is serverAPI
+internalAPI = ""
 # AE networkID, default(mainnet) networkID = "ae_mainnet",
 networkID = "ae_mainnet"
 # fix fees for transaction
 fixFees = "0.00002"
+# multiplier applied to the protocol minimum fee, must not be less than 1
+feeMultiplier = 1
+# gas limit for AEX-9 token transfer
+tokenGasLimit = 50000
+# AEX-9 token contracts watched by block scanner, separated by comma. Empty means no token is scanned
+watchContracts = ""
+# max key block rollback depth when the chain reorganizes, scanning stops when it is exceeded
+maxRollbackDepth = 20
+# shared deposit address, deposits to it are attributed to accounts by the memo(payload). Empty means disabled
+sharedDepositAddress = ""
+# key blocks after inclusion before a submitted transaction is considered final
+finalConfirmations = 10
+# seconds between polls of submitted transactions
+trackPeriod = 10
+# seconds a submitted transaction may stay in the mempool before it is rebroadcast
+rebroadcastAfter = 180
+# times a stuck transaction is rebroadcast before it is replaced
+maxRebroadcast = 3
+# replace stuck transactions with a higher-fee transaction at the same nonce
+replaceStuckTx = false
+# fee of the replacement transaction = fee of the stuck transaction * replaceFeeScale, must be greater than 1
+replaceFeeScale = 1.5
+# export unsigned transactions as tx_ base64check strings instead of hex, for third-party signers
+exportBase64Tx = false
 `
 )
 
@@ -33,11 +60,13 @@ type WalletConfig struct {
 	//配置文件名
 	configFileName string
 	//区块链数据文件
-	//BlockchainFile string
+	BlockchainFile string
 	//本地数据库文件路径
 	dbPath string
 	//钱包服务API
 	ServerAPI string
+	//节点内部API，用于合约dry-run
+	InternalAPI string
 	//默认配置内容
 	DefaultConfig string
 	//曲线类型
@@ -46,8 +75,32 @@ type WalletConfig struct {
 	NetworkID string
 	//固定手续费
 	FixFees string
+	//协议最低手续费的倍数
+	FeeMultiplier string
+	//代币转账的燃料上限
+	TokenGasLimit uint64
+	//区块扫描关注的代币合约，为空时不扫描代币交易
+	WatchContracts []string
 	//数据目录
 	DataDir string
+	//分叉最大回滚深度，超过时停止扫描
+	MaxRollbackDepth uint64
+	//共享充值地址，充值按转账备注归属到账户，为空时不启用
+	SharedDepositAddress string
+	//已提交交易单达到最终确认的keyblock数
+	FinalConfirmations uint64
+	//已提交交易单的查询间隔，单位秒
+	TrackPeriod uint64
+	//交易单在交易池中超过该时间视为卡住，重新广播，单位秒
+	RebroadcastAfter uint64
+	//卡住的交易单重新广播的最大次数，超过后替换
+	MaxRebroadcast uint64
+	//是否用更高手续费的交易单替换卡住的交易单
+	ReplaceStuckTx bool
+	//替换交易单的手续费倍数
+	ReplaceFeeScale string
+	//未签名交易单的RawHex是否为tx_编码，否则为十六进制编码
+	ExportBase64Tx bool
 }
 
 func NewConfig(symbol string) *WalletConfig {
@@ -65,11 +118,23 @@ func NewConfig(symbol string) *WalletConfig {
 	//配置文件名
 	c.configFileName = c.Symbol + ".ini"
 	//区块链数据文件
-	//c.BlockchainFile = "blockchain.db"
+	c.BlockchainFile = "blockchain.db"
 	//本地数据库文件路径
 	c.dbPath = filepath.Join("data", strings.ToLower(c.Symbol), "db")
 	//钱包服务API
 	c.ServerAPI = ""
+	//分叉最大回滚深度，超过时停止扫描
+	c.MaxRollbackDepth = 20
+	//已提交交易单达到最终确认的keyblock数
+	c.FinalConfirmations = 10
+	//已提交交易单的查询间隔
+	c.TrackPeriod = 10
+	//卡住的交易单重新广播
+	c.RebroadcastAfter = 180
+	c.MaxRebroadcast = 3
+	c.ReplaceFeeScale = "1.5"
+	//代币转账的燃料上限
+	c.TokenGasLimit = 50000
 
 	//创建目录
 	//file.MkdirAll(c.dbPath)
@@ -77,6 +142,40 @@ func NewConfig(symbol string) *WalletConfig {
 	return &c
 }
 
+//IsWatchContract 合约是否被区块扫描关注，只扫描明确配置的合约
+func (wc *WalletConfig) IsWatchContract(contractAddress string) bool {
+	for _, c := range wc.WatchContracts {
+		if c == contractAddress {
+			return true
+		}
+	}
+	return false
+}
+
+//GetFeeMultiplier 协议最低手续费的倍数，没有配置或小于1时为1
+func (wc *WalletConfig) GetFeeMultiplier() decimal.Decimal {
+	one := decimal.New(1, 0)
+	multiplier, err := decimal.NewFromString(wc.FeeMultiplier)
+	if err != nil || multiplier.LessThan(one) {
+		return one
+	}
+	return multiplier
+}
+
+//GetReplaceFeeScale 替换交易单的手续费倍数，没有配置或不大于1时为1.5
+func (wc *WalletConfig) GetReplaceFeeScale() decimal.Decimal {
+	scale, err := decimal.NewFromString(wc.ReplaceFeeScale)
+	if err != nil || scale.LessThanOrEqual(decimal.New(1, 0)) {
+		return decimal.New(15, -1)
+	}
+	return scale
+}
+
+//IsSharedDepositAddress 是否为共享充值地址
+func (wc *WalletConfig) IsSharedDepositAddress(address string) bool {
+	return len(wc.SharedDepositAddress) > 0 && wc.SharedDepositAddress == address
+}
+
 //创建文件夹
 func (wc *WalletConfig) makeDataDir() {
 
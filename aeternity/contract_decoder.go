@@ -0,0 +1,222 @@
+/*
+ * Copyright 2018 The OpenWallet Authors
+ * This file is part of the OpenWallet library.
+ *
+ * The OpenWallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The OpenWallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package aeternity
+
+import (
+	"fmt"
+	"github.com/aeternity/aepp-sdk-go/swagguard/node/models"
+	"github.com/blocktree/aeternity-adapter/aeternity_fate"
+	"github.com/blocktree/openwallet/common"
+	"github.com/blocktree/openwallet/openwallet"
+	"math/big"
+	"sync"
+)
+
+//aex9ACIJSON AEX-9代币标准的合约接口，只保留钱包需要的方法和事件
+const aex9ACIJSON = `[{"contract": {
+  "name": "FungibleToken",
+  "kind": "contract_main",
+  "event": {"variant": [
+    {"Transfer": ["address", "address", "int"]},
+    {"Allowance": ["address", "address", "int"]},
+    {"Burn": ["address", "int"]},
+    {"Mint": ["address", "int"]}
+  ]},
+  "functions": [
+    {"name": "aex9_extensions", "arguments": [], "returns": {"list": ["string"]}, "stateful": false, "payable": false},
+    {"name": "meta_info", "arguments": [], "returns": "FungibleToken.meta_info", "stateful": false, "payable": false},
+    {"name": "total_supply", "arguments": [], "returns": "int", "stateful": false, "payable": false},
+    {"name": "owner", "arguments": [], "returns": "address", "stateful": false, "payable": false},
+    {"name": "balance", "arguments": [{"name": "account", "type": "address"}], "returns": {"option": ["int"]}, "stateful": false, "payable": false},
+    {"name": "transfer", "arguments": [{"name": "recipient", "type": "address"}, {"name": "value", "type": "int"}], "returns": {"tuple": []}, "stateful": true, "payable": false}
+  ],
+  "type_defs": [
+    {"name": "meta_info", "typedef": {"record": [{"name": "name", "type": "string"}, {"name": "symbol", "type": "string"}, {"name": "decimals", "type": "int"}]}, "vars": []}
+  ]
+}}]`
+
+//aex9ACI AEX-9代币标准的合约接口
+var aex9ACI, _ = aeternity_fate.NewACI([]byte(aex9ACIJSON))
+
+//AEX9MetaInfo AEX-9代币的meta_info
+type AEX9MetaInfo struct {
+	Name     string
+	Symbol   string
+	Decimals uint64
+}
+
+//AEX9TransferEvent AEX-9代币的Transfer(indexed address, indexed address, indexed int)事件
+type AEX9TransferEvent struct {
+	Contract string
+	From     string
+	To       string
+	Value    *big.Int
+}
+
+//NewAEX9TransferEvent 解析合约事件日志，不是Transfer事件返回nil
+func NewAEX9TransferEvent(event *models.Event) *AEX9TransferEvent {
+
+	if event == nil || event.Address == nil || len(event.Topics) == 0 {
+		return nil
+	}
+
+	topics := make([]*big.Int, 0, len(event.Topics))
+	for _, topic := range event.Topics {
+		value := big.Int(topic)
+		topics = append(topics, &value)
+	}
+
+	data := ""
+	if event.Data != nil {
+		data = *event.Data
+	}
+
+	//其他合约的同名事件参数可能不同，解析失败的都忽略
+	decoded, err := aex9ACI.DecodeEvent(topics, data)
+	if err != nil || decoded.Name != "Transfer" {
+		return nil
+	}
+
+	return &AEX9TransferEvent{
+		Contract: *event.Address,
+		From:     decoded.Args[0].(string),
+		To:       decoded.Args[1].(string),
+		Value:    decoded.Args[2].(*big.Int),
+	}
+}
+
+type ContractDecoder struct {
+	*openwallet.SmartContractDecoderBase
+	wm        *WalletManager //钱包管理者
+	metaInfos sync.Map       //合约地址 -> *AEX9MetaInfo
+}
+
+//NewContractDecoder 智能合约解析器
+func NewContractDecoder(wm *WalletManager) *ContractDecoder {
+	decoder := ContractDecoder{}
+	decoder.wm = wm
+	return &decoder
+}
+
+//callContract 按AEX-9接口编码参数，dry-run调用合约方法并解码返回值
+func (decoder *ContractDecoder) callContract(contractAddress, function string, args ...interface{}) (interface{}, error) {
+
+	callData, err := aex9ACI.EncodeCall(function, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	returnValue, err := decoder.wm.DryRunContractCall(contractAddress, callData)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := aex9ACI.DecodeResult(function, returnValue)
+	if err != nil {
+		return nil, fmt.Errorf("contract [%s] %s is not AEX-9 compatible: %v", contractAddress, function, err)
+	}
+
+	return result, nil
+}
+
+//GetTokenMetaInfo 查询AEX-9代币的meta_info，结果会缓存
+func (decoder *ContractDecoder) GetTokenMetaInfo(contractAddress string) (*AEX9MetaInfo, error) {
+
+	if cache, ok := decoder.metaInfos.Load(contractAddress); ok {
+		return cache.(*AEX9MetaInfo), nil
+	}
+
+	result, err := decoder.callContract(contractAddress, "meta_info")
+	if err != nil {
+		return nil, err
+	}
+
+	record := result.(map[string]interface{})
+	decimals := record["decimals"].(*big.Int)
+
+	metaInfo := &AEX9MetaInfo{
+		Name:     record["name"].(string),
+		Symbol:   record["symbol"].(string),
+		Decimals: decimals.Uint64(),
+	}
+	decoder.metaInfos.Store(contractAddress, metaInfo)
+
+	return metaInfo, nil
+}
+
+//GetTokenDecimals 代币精度，合约信息没有设置时从meta_info读取
+func (decoder *ContractDecoder) GetTokenDecimals(contract openwallet.SmartContract) (int32, error) {
+	if contract.Decimals > 0 {
+		return int32(contract.Decimals), nil
+	}
+	metaInfo, err := decoder.GetTokenMetaInfo(contract.Address)
+	if err != nil {
+		return 0, err
+	}
+	return int32(metaInfo.Decimals), nil
+}
+
+//GetTokenBalance 通过dry-run调用balance(address)查询地址的代币余额，没有记录的地址余额为0
+func (decoder *ContractDecoder) GetTokenBalance(contractAddress, address string) (*big.Int, error) {
+
+	result, err := decoder.callContract(contractAddress, "balance", address)
+	if err != nil {
+		return nil, err
+	}
+
+	//balance返回option(int)，没有记录为None
+	if result == nil {
+		return big.NewInt(0), nil
+	}
+
+	return result.(*big.Int), nil
+}
+
+//GetTokenBalanceByAddress 查询地址token余额列表，任一地址查询失败时返回错误，不能当作余额为0
+func (decoder *ContractDecoder) GetTokenBalanceByAddress(contract openwallet.SmartContract, address ...string) ([]*openwallet.TokenBalance, error) {
+
+	tokenBalanceList := make([]*openwallet.TokenBalance, 0)
+
+	decimals, err := decoder.GetTokenDecimals(contract)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, addr := range address {
+
+		balance, err := decoder.GetTokenBalance(contract.Address, addr)
+		if err != nil {
+			return nil, openwallet.Errorf(openwallet.ErrCallFullNodeAPIFailed, "get address[%v] token balance failed, err: %v", addr, err)
+		}
+
+		balanceStr := common.BigIntToDecimals(balance, decimals).String()
+
+		tokenBalance := &openwallet.TokenBalance{
+			Contract: &contract,
+			Balance: &openwallet.Balance{
+				Address:          addr,
+				Symbol:           contract.Symbol,
+				Balance:          balanceStr,
+				ConfirmBalance:   balanceStr,
+				UnconfirmBalance: "0",
+			},
+		}
+
+		tokenBalanceList = append(tokenBalanceList, tokenBalance)
+	}
+
+	return tokenBalanceList, nil
+}
@@ -0,0 +1,111 @@
+package aeternity
+
+import (
+	"encoding/json"
+	"github.com/aeternity/aepp-sdk-go/aeternity"
+	"github.com/blocktree/aeternity-adapter/aeternity_fate"
+	"github.com/blocktree/openwallet/openwallet"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+//testDryRunServer 模拟节点的dry-run接口，按调用的方法返回结果，results中没有的方法返回调用失败
+func testDryRunServer(t *testing.T, results map[string]interface{}) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		var body struct {
+			Txs []string `json:"txs"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+
+		tx, err := DecodeTransaction(body.Txs[0])
+		if err != nil {
+			t.Errorf("DecodeTransaction error: %v", err)
+			return
+		}
+		callTx := tx.Tx.(*aeternity.ContractCallTx)
+		function, _, err := aex9ACI.DecodeCall(callTx.CallData)
+		if err != nil {
+			t.Errorf("DecodeCall error: %v", err)
+			return
+		}
+
+		result, ok := results[function]
+		if !ok {
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"results": []interface{}{map[string]interface{}{"result": "error", "reason": "contract not found"}},
+			})
+			return
+		}
+
+		f, _ := aex9ACI.Function(function)
+		value, _ := aex9ACI.ToFATE(f.Returns, result)
+		returnValue, _ := aeternity_fate.EncodeValue(value)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"results": []interface{}{map[string]interface{}{
+				"result":   "ok",
+				"call_obj": map[string]interface{}{"return_type": "ok", "return_value": returnValue},
+			}},
+		})
+	}))
+}
+
+func TestContractDecoder_GetTokenMetaInfo(t *testing.T) {
+
+	server := testDryRunServer(t, map[string]interface{}{
+		"meta_info": map[string]interface{}{"name": "Token", "symbol": "TT", "decimals": big.NewInt(18)},
+	})
+	defer server.Close()
+
+	wm := NewWalletManager()
+	wm.internalClient = NewClient(server.URL, false)
+
+	metaInfo, err := wm.ContractDecoder.GetTokenMetaInfo("ct_J3zBY8xxjsRr3QojETNw48Eb38fjvEuJKkQ6KzECvubvEcvCa")
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+		return
+	}
+	if metaInfo.Name != "Token" || metaInfo.Symbol != "TT" || metaInfo.Decimals != 18 {
+		t.Errorf("GetTokenMetaInfo = %+v", metaInfo)
+	}
+}
+
+func TestContractDecoder_GetTokenBalanceByAddress(t *testing.T) {
+
+	contract := openwallet.SmartContract{
+		Address:  "ct_J3zBY8xxjsRr3QojETNw48Eb38fjvEuJKkQ6KzECvubvEcvCa",
+		Symbol:   "AE",
+		Decimals: 2,
+	}
+	address := "ak_qcqXt6ySgRPvBkNwEpNMvaKWzrhPZsoBHLvgg68qg9vRht62y"
+
+	//balance返回Some(12345)
+	server := testDryRunServer(t, map[string]interface{}{"balance": big.NewInt(12345)})
+	wm := NewWalletManager()
+	wm.internalClient = NewClient(server.URL, false)
+	balances, err := wm.ContractDecoder.GetTokenBalanceByAddress(contract, address)
+	server.Close()
+	if err != nil || len(balances) != 1 || balances[0].Balance.Address != address || balances[0].Balance.Balance != "123.45" {
+		t.Errorf("GetTokenBalanceByAddress = %v, %v", balances, err)
+	}
+
+	//没有记录的地址余额为0
+	server = testDryRunServer(t, map[string]interface{}{"balance": nil})
+	wm.internalClient = NewClient(server.URL, false)
+	balances, err = wm.ContractDecoder.GetTokenBalanceByAddress(contract, address)
+	server.Close()
+	if err != nil || len(balances) != 1 || balances[0].Balance.Balance != "0" {
+		t.Errorf("GetTokenBalanceByAddress = %v, %v", balances, err)
+	}
+
+	//查询失败时返回错误，不能当作余额为0
+	server = testDryRunServer(t, map[string]interface{}{})
+	wm.internalClient = NewClient(server.URL, false)
+	balances, err = wm.ContractDecoder.GetTokenBalanceByAddress(contract, address)
+	server.Close()
+	if err == nil {
+		t.Errorf("GetTokenBalanceByAddress of failed dry-run = %v, want error", balances)
+	}
+}
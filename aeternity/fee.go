@@ -0,0 +1,226 @@
+package aeternity
+
+import (
+	"fmt"
+	"github.com/aeternity/aepp-sdk-go/aeternity"
+	"github.com/shopspring/decimal"
+	"math/big"
+	"sort"
+)
+
+const (
+	//协议规定的交易基础燃料倍数，基础燃料 = BaseGas * 倍数
+	spendTxBaseGasMultiplier        = 1
+	contractCallTxBaseGasMultiplier = 30
+	payingForTxBaseGasMultiplier    = 1
+
+	//计算最低手续费的最大迭代次数
+	maxFeeIterations = 16
+)
+
+//txFee 交易单的fee字段
+func txFee(tx aeternity.Tx) (*big.Int, error) {
+	switch t := tx.(type) {
+	case *aeternity.SpendTx:
+		return &t.Fee, nil
+	case *aeternity.ContractCallTx:
+		return &t.Fee, nil
+	case *PayingForTx:
+		return &t.Fee, nil
+	default:
+		return nil, fmt.Errorf("unsupported transaction type: %T", tx)
+	}
+}
+
+//setTxFee 设置交易单的fee字段
+func setTxFee(tx aeternity.Tx, fee *big.Int) error {
+	switch t := tx.(type) {
+	case *aeternity.SpendTx:
+		t.Fee = *new(big.Int).Set(fee)
+	case *aeternity.ContractCallTx:
+		t.Fee = *new(big.Int).Set(fee)
+	case *PayingForTx:
+		t.Fee = *new(big.Int).Set(fee)
+	default:
+		return fmt.Errorf("unsupported transaction type: %T", tx)
+	}
+	return nil
+}
+
+//txBaseGas 交易单的基础燃料
+func txBaseGas(tx aeternity.Tx) (*big.Int, error) {
+	multiplier := int64(0)
+	switch tx.(type) {
+	case *aeternity.SpendTx:
+		multiplier = spendTxBaseGasMultiplier
+	case *aeternity.ContractCallTx:
+		multiplier = contractCallTxBaseGasMultiplier
+	case *PayingForTx:
+		multiplier = payingForTxBaseGasMultiplier
+	default:
+		return nil, fmt.Errorf("unsupported transaction type: %T", tx)
+	}
+	return new(big.Int).Mul(&aeternity.Config.Client.BaseGas, big.NewInt(multiplier)), nil
+}
+
+//txGas 交易单按当前大小计算的燃料，燃料 = 基础燃料 + 交易单字节数 * 每字节燃料
+//代付交易单还要加上内部交易单的燃料
+func txGas(tx aeternity.Tx) (*big.Int, error) {
+	baseGas, err := txBaseGas(tx)
+	if err != nil {
+		return nil, err
+	}
+	txRaw, err := tx.RLP()
+	if err != nil {
+		return nil, err
+	}
+	gas := new(big.Int).Mul(big.NewInt(int64(len(txRaw))), &aeternity.Config.Client.GasPerByte)
+	gas.Add(gas, baseGas)
+	if payingForTx, ok := tx.(*PayingForTx); ok && payingForTx.InnerTx != nil {
+		innerGas, err := txGas(payingForTx.InnerTx)
+		if err != nil {
+			return nil, err
+		}
+		gas.Add(gas, innerGas)
+	}
+	return gas, nil
+}
+
+//requiredFee 交易单按当前大小计算的协议最低手续费，最低手续费 = 燃料 * 最低燃料价格
+func requiredFee(tx aeternity.Tx) (*big.Int, error) {
+	return requiredFeeWithGasPrice(tx, &aeternity.Config.Client.GasPrice)
+}
+
+//requiredFeeWithGasPrice 交易单按当前大小和指定燃料价格计算的手续费
+func requiredFeeWithGasPrice(tx aeternity.Tx, gasPrice *big.Int) (*big.Int, error) {
+	gas, err := txGas(tx)
+	if err != nil {
+		return nil, err
+	}
+	return gas.Mul(gas, gasPrice), nil
+}
+
+//txGasPrice 交易单fee字段折算的燃料价格，合约调用交易单直接使用gas_price字段
+func txGasPrice(tx aeternity.Tx) (*big.Int, error) {
+	if callTx, ok := tx.(*aeternity.ContractCallTx); ok {
+		return new(big.Int).Set(&callTx.GasPrice), nil
+	}
+	fee, err := txFee(tx)
+	if err != nil {
+		return nil, err
+	}
+	gas, err := txGas(tx)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).Div(fee, gas), nil
+}
+
+//applyFeeMultiplier 手续费乘以倍数，向上取整
+func applyFeeMultiplier(fee *big.Int, multiplier decimal.Decimal) *big.Int {
+	if multiplier.LessThanOrEqual(decimal.New(1, 0)) {
+		return new(big.Int).Set(fee)
+	}
+	result, _ := new(big.Int).SetString(decimal.NewFromBigInt(fee, 0).Mul(multiplier).Ceil().String(), 10)
+	return result
+}
+
+//CalcMinimumFee 计算交易单的最低手续费，并设置到交易单的fee字段，multiplier为手续费倍数，小于1按1计算
+//fee字段的长度会影响交易单大小，所以迭代计算直到fee满足按自身大小计算的最低手续费
+func CalcMinimumFee(tx aeternity.Tx, multiplier decimal.Decimal) (*big.Int, error) {
+	return calcFee(tx, &aeternity.Config.Client.GasPrice, multiplier)
+}
+
+//CalcFeeWithGasPrice 按指定燃料价格计算交易单的手续费，并设置到交易单的fee字段
+func CalcFeeWithGasPrice(tx aeternity.Tx, gasPrice *big.Int) (*big.Int, error) {
+	return calcFee(tx, gasPrice, decimal.New(1, 0))
+}
+
+//calcFee 迭代计算交易单的手续费
+func calcFee(tx aeternity.Tx, gasPrice *big.Int, multiplier decimal.Decimal) (*big.Int, error) {
+	fee := big.NewInt(0)
+	for i := 0; i < maxFeeIterations; i++ {
+		if err := setTxFee(tx, fee); err != nil {
+			return nil, err
+		}
+		required, err := requiredFeeWithGasPrice(tx, gasPrice)
+		if err != nil {
+			return nil, err
+		}
+		required = applyFeeMultiplier(required, multiplier)
+		if fee.Cmp(required) >= 0 {
+			return fee, nil
+		}
+		fee = required
+	}
+	return nil, fmt.Errorf("minimum fee does not converge")
+}
+
+//VerifyMinimumFee 检查交易单的fee字段是否达到协议最低手续费
+func VerifyMinimumFee(tx aeternity.Tx) error {
+	fee, err := txFee(tx)
+	if err != nil {
+		return err
+	}
+	required, err := requiredFee(tx)
+	if err != nil {
+		return err
+	}
+	if fee.Cmp(required) < 0 {
+		return fmt.Errorf("fee %s is below the protocol minimum fee %s", fee.String(), required.String())
+	}
+	return nil
+}
+
+//FeeTier 手续费档位
+type FeeTier struct {
+	GasPrice *big.Int //燃料价格
+	Fee      *big.Int //普通转账交易单按燃料价格计算的手续费
+}
+
+//FeeSuggestion 按交易池情况给出的手续费建议
+type FeeSuggestion struct {
+	Low          *FeeTier //低速，协议最低燃料价格
+	Normal       *FeeTier //普通，交易池燃料价格的中位数
+	Urgent       *FeeTier //加急，高于交易池90%的交易
+	PendingCount int      //交易池的交易数量
+	Timestamp    int64    //计算时间
+	Fallback     bool     //节点无法提供数据时，使用固定手续费
+}
+
+const (
+	//交易池交易数量不超过此值时，认为没有拥堵，所有档位使用最低燃料价格
+	congestionPendingCount = 10
+
+	//手续费建议的缓存时间，单位秒
+	feeSuggestionCacheSeconds = 10
+)
+
+//calcFeeTierGasPrices 按交易池的燃料价格计算各档位的燃料价格，低于最低燃料价格的按最低燃料价格计算
+func calcFeeTierGasPrices(minGasPrice *big.Int, pendingGasPrices []*big.Int) (low, normal, urgent *big.Int) {
+
+	low = new(big.Int).Set(minGasPrice)
+	if len(pendingGasPrices) <= congestionPendingCount {
+		return low, new(big.Int).Set(low), new(big.Int).Set(low)
+	}
+
+	prices := make([]*big.Int, len(pendingGasPrices))
+	copy(prices, pendingGasPrices)
+	sort.Slice(prices, func(i, j int) bool {
+		return prices[i].Cmp(prices[j]) < 0
+	})
+
+	percentile := func(p int) *big.Int {
+		price := new(big.Int).Set(prices[(len(prices)-1)*p/100])
+		if price.Cmp(minGasPrice) < 0 {
+			price.Set(minGasPrice)
+		}
+		return price
+	}
+
+	normal = percentile(50)
+	//加急档位比交易池90%的交易高一个单位，保证排在前面
+	urgent = percentile(90)
+	urgent.Add(urgent, big.NewInt(1))
+	return low, normal, urgent
+}
@@ -0,0 +1,188 @@
+package aeternity
+
+import (
+	"github.com/aeternity/aepp-sdk-go/aeternity"
+	"github.com/shopspring/decimal"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestCalcMinimumFee(t *testing.T) {
+
+	to := "ak_qcqXt6ySgRPvBkNwEpNMvaKWzrhPZsoBHLvgg68qg9vRht62y"
+	tx := aeternity.NewSpendTx(to, to, *big.NewInt(1000), *big.NewInt(0), "order:10086", 500, 1)
+
+	fee, err := CalcMinimumFee(&tx, decimal.New(1, 0))
+	if err != nil {
+		t.Errorf("CalcMinimumFee error: %v", err)
+		return
+	}
+	if tx.Fee.Cmp(fee) != 0 {
+		t.Errorf("CalcMinimumFee did not set fee of tx")
+	}
+	if err := VerifyMinimumFee(&tx); err != nil {
+		t.Errorf("VerifyMinimumFee error: %v", err)
+	}
+
+	//payload越长手续费越高
+	longTx := aeternity.NewSpendTx(to, to, *big.NewInt(1000), *big.NewInt(0), "order:10086-10087-10088", 500, 1)
+	longFee, err := CalcMinimumFee(&longTx, decimal.New(1, 0))
+	if err != nil {
+		t.Errorf("CalcMinimumFee error: %v", err)
+		return
+	}
+	if longFee.Cmp(fee) <= 0 {
+		t.Errorf("fee of longer payload %s is not greater than %s", longFee.String(), fee.String())
+	}
+
+	//手续费倍数
+	doubleFee, err := CalcMinimumFee(&tx, decimal.New(2, 0))
+	if err != nil {
+		t.Errorf("CalcMinimumFee error: %v", err)
+		return
+	}
+	if doubleFee.Cmp(new(big.Int).Mul(fee, big.NewInt(2))) < 0 {
+		t.Errorf("fee with multiplier 2 = %s, minimum fee = %s", doubleFee.String(), fee.String())
+	}
+
+	//低于最低手续费
+	tx.Fee = *new(big.Int).Sub(fee, big.NewInt(1))
+	if err := VerifyMinimumFee(&tx); err == nil {
+		t.Errorf("VerifyMinimumFee with insufficient fee should fail")
+	}
+}
+
+func TestWalletConfig_GetFeeMultiplier(t *testing.T) {
+
+	tests := map[string]string{
+		"":    "1",
+		"abc": "1",
+		"0.5": "1",
+		"1.2": "1.2",
+		"3":   "3",
+	}
+
+	for value, expect := range tests {
+		wc := &WalletConfig{FeeMultiplier: value}
+		if multiplier := wc.GetFeeMultiplier(); multiplier.String() != expect {
+			t.Errorf("GetFeeMultiplier(%q) = %s", value, multiplier.String())
+		}
+	}
+}
+
+func TestCalcFeeTierGasPrices(t *testing.T) {
+
+	minGasPrice := big.NewInt(1000000000)
+
+	//交易池没有拥堵
+	low, normal, urgent := calcFeeTierGasPrices(minGasPrice, []*big.Int{big.NewInt(5000000000)})
+	if low.Cmp(minGasPrice) != 0 || normal.Cmp(minGasPrice) != 0 || urgent.Cmp(minGasPrice) != 0 {
+		t.Errorf("tiers without congestion = %s, %s, %s", low.String(), normal.String(), urgent.String())
+	}
+
+	//交易池拥堵，燃料价格为1e9到20e9
+	pending := make([]*big.Int, 0)
+	for i := int64(20); i > 0; i-- {
+		pending = append(pending, new(big.Int).Mul(big.NewInt(i), minGasPrice))
+	}
+	low, normal, urgent = calcFeeTierGasPrices(minGasPrice, pending)
+	if low.Cmp(minGasPrice) != 0 {
+		t.Errorf("low = %s", low.String())
+	}
+	if normal.Cmp(big.NewInt(10000000000)) != 0 {
+		t.Errorf("normal = %s", normal.String())
+	}
+	if urgent.Cmp(big.NewInt(18000000001)) != 0 {
+		t.Errorf("urgent = %s", urgent.String())
+	}
+	if pending[0].Cmp(big.NewInt(20000000000)) != 0 {
+		t.Errorf("calcFeeTierGasPrices should not sort the input")
+	}
+}
+
+func TestTxGasPrice(t *testing.T) {
+
+	to := "ak_qcqXt6ySgRPvBkNwEpNMvaKWzrhPZsoBHLvgg68qg9vRht62y"
+	tx := aeternity.NewSpendTx(to, to, *big.NewInt(1000), *big.NewInt(0), "", 500, 1)
+
+	gasPrice := big.NewInt(3000000000)
+	if _, err := CalcFeeWithGasPrice(&tx, gasPrice); err != nil {
+		t.Errorf("CalcFeeWithGasPrice error: %v", err)
+		return
+	}
+	price, err := txGasPrice(&tx)
+	if err != nil {
+		t.Errorf("txGasPrice error: %v", err)
+		return
+	}
+	if price.Cmp(gasPrice) != 0 {
+		t.Errorf("txGasPrice = %s", price.String())
+	}
+}
+
+func TestGetTokenTransferFeeInfo(t *testing.T) {
+
+	wm := NewWalletManager()
+	decoder := NewTransactionDecoder(wm)
+	contract := "ct_2U1usf3A8ZNUcZLkZe5rEoBTxk7eJvk9fcbRDNqmRiwXCHAYN"
+	to := "ak_qcqXt6ySgRPvBkNwEpNMvaKWzrhPZsoBHLvgg68qg9vRht62y"
+	gasLimit := new(big.Int).SetUint64(wm.Config.TokenGasLimit)
+
+	//默认使用最低燃料价格和最低手续费
+	feeInfo, err := decoder.GetTokenTransferFeeInfo(contract, to, big.NewInt(100), "", "")
+	if err != nil {
+		t.Errorf("GetTokenTransferFeeInfo error: %v", err)
+		return
+	}
+	if feeInfo.GasPrice.Cmp(&aeternity.Config.Client.GasPrice) != 0 {
+		t.Errorf("GetTokenTransferFeeInfo gas price = %s", feeInfo.GasPrice.String())
+	}
+	want := new(big.Int).Mul(gasLimit, feeInfo.GasPrice)
+	want.Add(want, feeInfo.TxFee)
+	if feeInfo.Fee.Cmp(want) != 0 {
+		t.Errorf("GetTokenTransferFeeInfo fee = %s, want %s", feeInfo.Fee.String(), want.String())
+	}
+
+	//feeRate和AE转账一样是交易单的fee字段，不影响燃料价格
+	feeInfo, err = decoder.GetTokenTransferFeeInfo(contract, to, big.NewInt(100), "0.001", "0.000000002")
+	if err != nil {
+		t.Errorf("GetTokenTransferFeeInfo error: %v", err)
+		return
+	}
+	if feeInfo.TxFee.String() != "1000000000000000" || feeInfo.GasPrice.String() != "2000000000" {
+		t.Errorf("GetTokenTransferFeeInfo fee = %s, gas price = %s", feeInfo.TxFee.String(), feeInfo.GasPrice.String())
+	}
+
+	//燃料价格低于协议最低燃料价格
+	if _, err := decoder.GetTokenTransferFeeInfo(contract, to, big.NewInt(100), "", "0.0000000001"); err == nil {
+		t.Errorf("GetTokenTransferFeeInfo with low gas price should fail")
+	}
+}
+
+func TestGetFeeSuggestionCache(t *testing.T) {
+
+	wm := NewWalletManager()
+	wm.Config.FixFees = "0.00002"
+	decoder := NewTransactionDecoder(wm)
+
+	//缓存未过期时直接返回，不查询交易池
+	cached := &FeeSuggestion{
+		Normal:    &FeeTier{GasPrice: big.NewInt(2000000000), Fee: big.NewInt(40000000000000)},
+		Timestamp: time.Now().Unix(),
+	}
+	decoder.feeSuggestion = cached
+	if suggestion := decoder.GetFeeSuggestion(); suggestion != cached {
+		t.Errorf("GetFeeSuggestion should return the cached suggestion")
+	}
+
+	//缓存过期后重新查询，节点不可用时使用固定手续费，并且不缓存
+	cached.Timestamp -= feeSuggestionCacheSeconds
+	suggestion := decoder.GetFeeSuggestion()
+	if !suggestion.Fallback || suggestion.Normal.Fee.String() != "20000000000000" {
+		t.Errorf("GetFeeSuggestion fallback = %v, fee = %s", suggestion.Fallback, suggestion.Normal.Fee.String())
+	}
+	if decoder.feeSuggestion != cached {
+		t.Errorf("GetFeeSuggestion should not cache the fallback suggestion")
+	}
+}
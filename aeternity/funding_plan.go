@@ -0,0 +1,273 @@
+package aeternity
+
+import (
+	"fmt"
+	"github.com/blocktree/openwallet/common"
+	"github.com/blocktree/openwallet/openwallet"
+	"math/big"
+	"sort"
+)
+
+const (
+	//FundingModeConsolidate 先把其他地址的余额归集到付款地址，再由付款地址一次付款
+	FundingModeConsolidate = "consolidate"
+	//FundingModeSplit 拆分为多笔从不同地址到同一接收地址的付款
+	FundingModeSplit = "split"
+)
+
+//FundingPlan 多地址付款计划，交易单已创建但未签名，交由调用方确认后再签名广播。
+//创建计划时已为交易单预留nonce，调用方不采用计划时需要调用RejectFundingPlan释放
+type FundingPlan struct {
+	Mode           string                       //付款方式
+	Destination    string                       //接收地址
+	Amount         string                       //付款数量
+	Payer          string                       //归集模式的付款地址
+	Consolidations []*openwallet.RawTransaction //归集交易单，需要先上链，付款交易单才能广播
+	Payments       []*openwallet.RawTransaction //付款交易单
+	TotalFees      string                       //所有交易单的手续费合计
+}
+
+//fundingStep 付款计划中的一笔转账
+type fundingStep struct {
+	From   string
+	To     string
+	Amount *big.Int
+}
+
+//planSplitFunding 按余额从大到小拆分付款，每个地址扣除手续费后的余额用于付款
+func planSplitFunding(fundings []*AddrBalance, destination string, amount, fee *big.Int) ([]*fundingStep, error) {
+
+	steps := make([]*fundingStep, 0)
+	remaining := new(big.Int).Set(amount)
+
+	for _, f := range sortFundings(fundings) {
+		if remaining.Sign() <= 0 {
+			break
+		}
+		available := new(big.Int).Sub(f.Balance, fee)
+		if available.Sign() <= 0 {
+			continue
+		}
+		if available.Cmp(remaining) > 0 {
+			available.Set(remaining)
+		}
+		steps = append(steps, &fundingStep{From: f.Address, To: destination, Amount: available})
+		remaining.Sub(remaining, available)
+	}
+
+	if remaining.Sign() > 0 {
+		return nil, fmt.Errorf("the balance of account is not enough")
+	}
+
+	return steps, nil
+}
+
+//planConsolidateFunding 以余额最大的地址为付款地址，不足部分由其他地址归集，最后一步为付款
+func planConsolidateFunding(fundings []*AddrBalance, destination string, amount, payFee, consolidateFee *big.Int) ([]*fundingStep, error) {
+
+	sorted := sortFundings(fundings)
+	if len(sorted) == 0 {
+		return nil, fmt.Errorf("the balance of account is not enough")
+	}
+
+	payer := sorted[0]
+	steps := make([]*fundingStep, 0)
+	need := new(big.Int).Add(amount, payFee)
+	need.Sub(need, payer.Balance)
+
+	for _, f := range sorted[1:] {
+		if need.Sign() <= 0 {
+			break
+		}
+		available := new(big.Int).Sub(f.Balance, consolidateFee)
+		if available.Sign() <= 0 {
+			continue
+		}
+		if available.Cmp(need) > 0 {
+			available.Set(need)
+		}
+		steps = append(steps, &fundingStep{From: f.Address, To: payer.Address, Amount: available})
+		need.Sub(need, available)
+	}
+
+	if need.Sign() > 0 {
+		return nil, fmt.Errorf("the balance of account is not enough")
+	}
+
+	steps = append(steps, &fundingStep{From: payer.Address, To: destination, Amount: new(big.Int).Set(amount)})
+	return steps, nil
+}
+
+//sortFundings 地址余额从大到小排序，不修改原数组
+func sortFundings(fundings []*AddrBalance) []*AddrBalance {
+	sorted := make([]*AddrBalance, len(fundings))
+	copy(sorted, fundings)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Balance.Cmp(sorted[j].Balance) > 0
+	})
+	return sorted
+}
+
+//CreateFundingPlan 没有单个地址的余额足够付款时，由账户的多个地址共同付款，mode为FundingModeConsolidate或FundingModeSplit
+//返回的计划包含所有待签名的交易单，转账备注只附加在付款交易单上
+func (decoder *TransactionDecoder) CreateFundingPlan(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction, mode string) (*FundingPlan, error) {
+
+	var (
+		decimals    = decoder.wm.Decimal()
+		accountID   = rawTx.Account.AccountID
+		destination string
+		amountStr   string
+		steps       []*fundingStep
+	)
+
+	if rawTx.Coin.IsContract {
+		return nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "funding plan of token is not supported")
+	}
+
+	if len(rawTx.To) != 1 {
+		return nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "only one receiver address is supported")
+	}
+
+	for k, v := range rawTx.To {
+		destination = k
+		amountStr = v
+	}
+
+	addresses, err := wrapper.GetAddressList(0, -1, "AccountID", accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(addresses) == 0 {
+		return nil, openwallet.Errorf(openwallet.ErrAccountNotAddress, "[%s] have not addresses", accountID)
+	}
+
+	searchAddrs := make([]string, 0)
+	for _, address := range addresses {
+		searchAddrs = append(searchAddrs, address.Address)
+	}
+
+	addrBalanceArray, err := decoder.wm.Blockscanner.GetBalanceByAddress(searchAddrs...)
+	if err != nil {
+		return nil, err
+	}
+
+	fundings := make([]*AddrBalance, 0)
+	maxBalance := big.NewInt(0)
+	for _, addrBalance := range addrBalanceArray {
+		balance := common.StringNumToBigIntWithExp(addrBalance.Balance, decimals)
+		fundings = append(fundings, &AddrBalance{Address: addrBalance.Address, Balance: balance})
+		if balance.Cmp(maxBalance) > 0 {
+			maxBalance = balance
+		}
+	}
+
+	amount := common.StringNumToBigIntWithExp(amountStr, decimals)
+
+	payload, err := ParseMemo(rawTx.GetExtParam().Get("memo").String())
+	if err != nil {
+		return nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "%v", err)
+	}
+
+	//每笔转账数量不超过付款数量，按付款数量估算付款交易单的手续费
+	payFeeInfo, err := decoder.GetSpendFeeInfo(destination, amount, payload, rawTx.FeeRate)
+	if err != nil {
+		return nil, err
+	}
+
+	//归集数量不超过最大的地址余额，按最大余额估算归集交易单的手续费
+	consolidateFeeInfo, err := decoder.GetSpendFeeInfo(destination, maxBalance, nil, rawTx.FeeRate)
+	if err != nil {
+		return nil, err
+	}
+
+	switch mode {
+	case FundingModeConsolidate:
+		steps, err = planConsolidateFunding(fundings, destination, amount, payFeeInfo.Fee, consolidateFeeInfo.Fee)
+	case FundingModeSplit:
+		steps, err = planSplitFunding(fundings, destination, amount, payFeeInfo.Fee)
+	default:
+		return nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "unknown funding mode: %s", mode)
+	}
+	if err != nil {
+		return nil, openwallet.Errorf(openwallet.ErrInsufficientBalanceOfAccount, "%v", err)
+	}
+
+	plan := &FundingPlan{
+		Mode:           mode,
+		Destination:    destination,
+		Amount:         amountStr,
+		Consolidations: make([]*openwallet.RawTransaction, 0),
+		Payments:       make([]*openwallet.RawTransaction, 0),
+	}
+
+	totalFees := big.NewInt(0)
+	balances := make(map[string]*big.Int)
+	for _, f := range fundings {
+		balances[f.Address] = f.Balance
+	}
+
+	for _, step := range steps {
+
+		stepRawTx := &openwallet.RawTransaction{
+			Coin:     rawTx.Coin,
+			Account:  rawTx.Account,
+			FeeRate:  rawTx.FeeRate,
+			To:       map[string]string{step.To: common.BigIntToDecimals(step.Amount, decimals).StringFixed(decimals)},
+			Required: 1,
+		}
+
+		feeInfo := consolidateFeeInfo
+		stepPayload := ""
+		if step.To == destination {
+			feeInfo = payFeeInfo
+			stepPayload = string(payload)
+			if len(payload) > 0 {
+				stepRawTx.SetExtParam("memo", rawTx.GetExtParam().Get("memo").String())
+			}
+		}
+
+		createErr := decoder.createRawTransaction(
+			wrapper,
+			stepRawTx,
+			&AddrBalance{Address: step.From, Balance: balances[step.From]},
+			feeInfo,
+			stepPayload,
+			nil)
+		if createErr != nil {
+			//放弃已创建的交易单
+			decoder.RejectFundingPlan(plan)
+			return nil, createErr
+		}
+
+		totalFees.Add(totalFees, feeInfo.Fee)
+		if step.To == destination {
+			plan.Payments = append(plan.Payments, stepRawTx)
+		} else {
+			plan.Consolidations = append(plan.Consolidations, stepRawTx)
+		}
+	}
+
+	if mode == FundingModeConsolidate {
+		plan.Payer = steps[len(steps)-1].From
+	}
+	plan.TotalFees = common.BigIntToDecimals(totalFees, decimals).String()
+
+	return plan, nil
+}
+
+//RejectFundingPlan 放弃付款计划，释放计划中所有交易单预留的nonce
+func (decoder *TransactionDecoder) RejectFundingPlan(plan *FundingPlan) {
+	if plan == nil {
+		return
+	}
+	for _, rawTx := range append(plan.Consolidations, plan.Payments...) {
+		decoder.releaseRawTransactionNonce(rawTx)
+	}
+}
+
+//canFundByPlan 单个地址余额不足时，账户所有地址的余额是否足够按拆分方式付款
+func canFundByPlan(fundings []*AddrBalance, destination string, amount, fee *big.Int) bool {
+	_, err := planSplitFunding(fundings, destination, amount, fee)
+	return err == nil
+}
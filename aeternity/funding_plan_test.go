@@ -0,0 +1,118 @@
+package aeternity
+
+import (
+	"github.com/blocktree/openwallet/openwallet"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+)
+
+func testFundings() []*AddrBalance {
+	return []*AddrBalance{
+		{Address: "a", Balance: big.NewInt(30)},
+		{Address: "b", Balance: big.NewInt(50)},
+		{Address: "c", Balance: big.NewInt(2)},
+		{Address: "d", Balance: big.NewInt(20)},
+	}
+}
+
+func TestPlanSplitFunding(t *testing.T) {
+
+	steps, err := planSplitFunding(testFundings(), "dest", big.NewInt(70), big.NewInt(5))
+	if err != nil {
+		t.Errorf("planSplitFunding error: %v", err)
+		return
+	}
+	//b: 45, a: 25
+	if len(steps) != 2 || steps[0].From != "b" || steps[0].Amount.Int64() != 45 ||
+		steps[1].From != "a" || steps[1].Amount.Int64() != 25 {
+		for _, s := range steps {
+			t.Errorf("step %s -> %s: %s", s.From, s.To, s.Amount.String())
+		}
+	}
+
+	//可用余额合计 45 + 25 + 15 = 85
+	if _, err := planSplitFunding(testFundings(), "dest", big.NewInt(86), big.NewInt(5)); err == nil {
+		t.Errorf("planSplitFunding with insufficient balance should fail")
+	}
+}
+
+func TestPlanConsolidateFunding(t *testing.T) {
+
+	steps, err := planConsolidateFunding(testFundings(), "dest", big.NewInt(70), big.NewInt(5), big.NewInt(3))
+	if err != nil {
+		t.Errorf("planConsolidateFunding error: %v", err)
+		return
+	}
+	//b付款需要75，a归集25到b，b付款70
+	if len(steps) != 2 || steps[0].From != "a" || steps[0].To != "b" || steps[0].Amount.Int64() != 25 ||
+		steps[1].From != "b" || steps[1].To != "dest" || steps[1].Amount.Int64() != 70 {
+		for _, s := range steps {
+			t.Errorf("step %s -> %s: %s", s.From, s.To, s.Amount.String())
+		}
+	}
+
+	//付款地址余额足够时不需要归集
+	steps, _ = planConsolidateFunding(testFundings(), "dest", big.NewInt(40), big.NewInt(5), big.NewInt(3))
+	if len(steps) != 1 || steps[0].From != "b" {
+		t.Errorf("planConsolidateFunding steps = %d", len(steps))
+	}
+
+	//可用余额合计 50 + 27 + 17 = 94，付款需要 90 + 5
+	if _, err := planConsolidateFunding(testFundings(), "dest", big.NewInt(90), big.NewInt(5), big.NewInt(3)); err == nil {
+		t.Errorf("planConsolidateFunding with insufficient balance should fail")
+	}
+}
+
+func TestCanFundByPlan(t *testing.T) {
+	if !canFundByPlan(testFundings(), "dest", big.NewInt(85), big.NewInt(5)) {
+		t.Errorf("canFundByPlan(85) should be true")
+	}
+	if canFundByPlan(testFundings(), "dest", big.NewInt(86), big.NewInt(5)) {
+		t.Errorf("canFundByPlan(86) should be false")
+	}
+}
+
+func TestRejectFundingPlan(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "plan")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	wm := NewWalletManager()
+	wm.Config.dbPath = dir
+	defer wm.CloseDB()
+	decoder := NewTransactionDecoder(wm)
+
+	address := "ak_qcqXt6ySgRPvBkNwEpNMvaKWzrhPZsoBHLvgg68qg9vRht62y"
+	state := &accountNonceState{Address: address, TTL: 600, AccountNonce: 1, Height: 100}
+
+	plan := &FundingPlan{}
+	for i := 0; i < 2; i++ {
+		reservation, err := wm.NonceManager.reserveNonceWithState(state)
+		if err != nil {
+			t.Fatalf("reserveNonceWithState error: %v", err)
+		}
+		rawTx := &openwallet.RawTransaction{TxFrom: []string{address + ":1"}}
+		rawTx.SetExtParam("nonce", reservation.Nonce)
+		if i == 0 {
+			plan.Consolidations = append(plan.Consolidations, rawTx)
+		} else {
+			plan.Payments = append(plan.Payments, rawTx)
+		}
+	}
+
+	decoder.RejectFundingPlan(plan)
+
+	reservations, err := wm.NonceManager.GetReservations(address)
+	if err != nil {
+		t.Errorf("GetReservations error: %v", err)
+		return
+	}
+	if len(reservations) != 0 {
+		t.Errorf("RejectFundingPlan left %d reservations", len(reservations))
+	}
+}
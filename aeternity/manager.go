@@ -1,14 +1,32 @@
 package aeternity
 
 import (
-	"encoding/hex"
 	"fmt"
 	"github.com/aeternity/aepp-sdk-go/aeternity"
 	"github.com/aeternity/aepp-sdk-go/swagguard/node/client/external"
 	"github.com/aeternity/aepp-sdk-go/swagguard/node/models"
+	"github.com/asdine/storm"
+	"github.com/blocktree/aeternity-adapter/aeternity_fate"
+	"github.com/blocktree/go-owcrypt"
 	"github.com/blocktree/openwallet/log"
 	"github.com/blocktree/openwallet/openwallet"
+	"github.com/imroc/req"
 	rlp "github.com/randomshinichi/rlpae"
+	"math/big"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	//FATE合约的ABI版本
+	fateABIVersion = 3
+
+	//dry-run使用的虚拟账户、余额和燃料上限
+	dryRunAccount  = "ak_11111111111111111111111111111111273Yts"
+	dryRunAmount   = "100000000000000000000000000000000000"
+	dryRunGasLimit = 1000000
 )
 
 type WalletManager struct {
@@ -19,9 +37,15 @@ type WalletManager struct {
 	Decoder         openwallet.AddressDecoder       //地址编码器
 	TxDecoder       openwallet.TransactionDecoder   //交易单编码器
 	Log             *log.OWLogger                   //日志工具
-	ContractDecoder openwallet.SmartContractDecoder //智能合约解析器
+	ContractDecoder *ContractDecoder                //智能合约解析器
+	NonceManager    *NonceManager                   //本地nonce分配器
+	TxTracker       *TxTracker                      //已提交交易单跟踪器
+	StuckTxService  *StuckTxService                 //卡住交易单的重新广播和替换
 	Blockscanner    *AEBlockScanner                 //区块扫描器
 	client          *Client                         //本地封装的http client
+	internalClient  *Client                         //节点内部API的http client
+	db              *storm.DB                       //本地数据库，所有模块共用一个连接
+	dbMu            sync.Mutex
 }
 
 func NewWalletManager() *WalletManager {
@@ -31,17 +55,61 @@ func NewWalletManager() *WalletManager {
 	wm.Decoder = NewAddressDecoder(&wm)
 	wm.TxDecoder = NewTransactionDecoder(&wm)
 	wm.Log = log.NewOWLogger(wm.Symbol())
-	//wm.ContractDecoder = NewContractDecoder(&wm)
+	wm.ContractDecoder = NewContractDecoder(&wm)
+	wm.NonceManager = NewNonceManager(&wm)
+	wm.TxTracker = NewTxTracker(&wm)
+	wm.StuckTxService = NewStuckTxService(&wm)
 	return &wm
 }
 
+//openDB 打开本地数据库，bolt的文件锁不允许同一文件同时打开多次，所有模块共用第一次打开的连接
+func (wm *WalletManager) openDB() (*storm.DB, error) {
+	wm.dbMu.Lock()
+	defer wm.dbMu.Unlock()
+
+	if wm.db != nil {
+		return wm.db, nil
+	}
+	db, err := storm.Open(filepath.Join(wm.Config.dbPath, wm.Config.BlockchainFile))
+	if err != nil {
+		return nil, err
+	}
+	wm.db = db
+	return db, nil
+}
+
+//CloseDB 关闭本地数据库，之后的读写会重新打开
+func (wm *WalletManager) CloseDB() error {
+	wm.dbMu.Lock()
+	defer wm.dbMu.Unlock()
+
+	if wm.db == nil {
+		return nil
+	}
+	err := wm.db.Close()
+	wm.db = nil
+	return err
+}
+
 //GetAccount
 func (wm *WalletManager) GetAccount(address string) (*models.Account, error) {
 
 	if wm.Api == nil {
 		return nil, fmt.Errorf("aeternity API is not inited")
 	}
-	return wm.Api.GetAccount(address)
+	p := external.NewGetAccountByPubkeyParams().WithPubkey(address)
+	r, err := wm.Api.External.GetAccountByPubkey(p)
+	if err != nil {
+		switch e := err.(type) {
+		case *external.GetAccountByPubkeyNotFound:
+			return nil, NewNodeError(http.StatusNotFound, "404 Not Found", modelErrorReason(e.Payload))
+		case *external.GetAccountByPubkeyBadRequest:
+			return nil, NewNodeError(http.StatusBadRequest, "400 Bad Request", modelErrorReason(e.Payload))
+		default:
+			return nil, openwallet.Errorf(openwallet.ErrCallFullNodeAPIFailed, "%v", err)
+		}
+	}
+	return r.Payload, nil
 }
 
 //GetAccountPendingTxCount
@@ -75,21 +143,214 @@ func (wm *WalletManager) GetAccountPendingTxCount(address string) (uint64, error
 	//return uint64(len(txs.Array())), nil
 }
 
+//GetAccountPendingNonces 查询地址在交易池中的交易单nonce
+func (wm *WalletManager) GetAccountPendingNonces(address string) ([]uint64, error) {
+
+	if wm.client == nil {
+		return nil, fmt.Errorf("aeternity API is not inited")
+	}
+
+	path := fmt.Sprintf("/accounts/%s/transactions/pending", address)
+	result, err := wm.client.Call(path, "GET", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	nonces := make([]uint64, 0)
+	for _, tx := range result.Get("transactions").Array() {
+		nonces = append(nonces, tx.Get("tx.nonce").Uint())
+	}
+
+	return nonces, nil
+}
+
+//DryRunContractCall 试运行合约调用，callData为cb_编码的calldata，返回cb_编码的返回值
+func (wm *WalletManager) DryRunContractCall(contractID, callData string) (string, error) {
+
+	if wm.internalClient == nil {
+		return "", fmt.Errorf("aeternity internal API is not inited")
+	}
+
+	tx := aeternity.NewContractCallTx(
+		dryRunAccount,
+		1,
+		contractID,
+		*big.NewInt(0),
+		*big.NewInt(dryRunGasLimit),
+		aeternity.Config.Client.GasPrice,
+		fateABIVersion,
+		callData,
+		*big.NewInt(0),
+		0)
+	fee, err := tx.FeeEstimate()
+	if err != nil {
+		return "", err
+	}
+	tx.Fee = *fee
+
+	txStr, err := aeternity.BaseEncodeTx(&tx)
+	if err != nil {
+		return "", err
+	}
+
+	amount, _ := new(big.Int).SetString(dryRunAmount, 10)
+	body := map[string]interface{}{
+		"accounts": []map[string]interface{}{
+			{"pub_key": dryRunAccount, "amount": amount},
+		},
+		"txs": []string{txStr},
+	}
+
+	result, err := wm.internalClient.Call("/debug/transactions/dry-run", "POST", req.BodyJSON(body))
+	if err != nil {
+		return "", err
+	}
+
+	callResult := result.Get("results.0")
+	if callResult.Get("result").String() != "ok" {
+		return "", fmt.Errorf("dry-run contract [%s] failed: %s", contractID, callResult.Get("reason").String())
+	}
+
+	if returnType := callResult.Get("call_obj.return_type").String(); returnType != "ok" {
+		returnValue, _ := aeternity_fate.DecodeValue(callResult.Get("call_obj.return_value").String())
+		return "", fmt.Errorf("dry-run contract [%s] %s: %v", contractID, returnType, returnValue)
+	}
+
+	return callResult.Get("call_obj.return_value").String(), nil
+}
+
+//GetPendingTransactionGasPrices 查询节点交易池中交易的燃料价格，只统计普通转账和合约调用交易
+func (wm *WalletManager) GetPendingTransactionGasPrices() ([]*big.Int, error) {
+
+	if wm.internalClient == nil {
+		return nil, fmt.Errorf("aeternity internal API is not inited")
+	}
+
+	result, err := wm.internalClient.Call("/debug/transactions/pending", "GET", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	gasPrices := make([]*big.Int, 0)
+	for _, pendingTx := range result.Get("transactions").Array() {
+		txJSON := pendingTx.Get("tx")
+		var tx aeternity.Tx
+		switch txJSON.Get("type").String() {
+		case "SpendTx":
+			amount, _ := new(big.Int).SetString(txJSON.Get("amount").String(), 10)
+			fee, _ := new(big.Int).SetString(txJSON.Get("fee").String(), 10)
+			if amount == nil || fee == nil {
+				continue
+			}
+			payload, decodeErr := DecodePayload(txJSON.Get("payload").String())
+			if decodeErr != nil {
+				continue
+			}
+			spendTx := aeternity.NewSpendTx(
+				txJSON.Get("sender_id").String(),
+				txJSON.Get("recipient_id").String(),
+				*amount,
+				*fee,
+				string(payload),
+				txJSON.Get("ttl").Uint(),
+				txJSON.Get("nonce").Uint())
+			tx = &spendTx
+		case "ContractCallTx":
+			gasPrice, _ := new(big.Int).SetString(txJSON.Get("gas_price").String(), 10)
+			if gasPrice == nil {
+				continue
+			}
+			tx = &aeternity.ContractCallTx{GasPrice: *gasPrice}
+		default:
+			continue
+		}
+
+		gasPrice, priceErr := txGasPrice(tx)
+		if priceErr != nil {
+			continue
+		}
+		gasPrices = append(gasPrices, gasPrice)
+	}
+
+	return gasPrices, nil
+}
+
 // BroadcastTransaction recalculates the transaction hash and sends the transaction to the node.
-func (wm *WalletManager) BroadcastTransaction(txHex string) (string, error) {
-	txBytes, err := hex.DecodeString(txHex)
+func (wm *WalletManager) BroadcastTransaction(rawTx string) (string, error) {
+	txBytes, err := DecodeRawTx(rawTx)
 	if err != nil {
 		return "", fmt.Errorf("transaction decode failed, unexpected error: %v", err)
 	}
 	signedEncodedTx := aeternity.Encode(aeternity.PrefixTransaction, txBytes)
 	wm.Log.Debugf("signedEncodedTx: %s", signedEncodedTx)
 	// calculate the hash of the decoded txRLP
-	//rlpTxHashRaw := owcrypt.Hash(txBytes, 32, owcrypt.HASH_ALG_BLAKE2B)
-	//// base58/64 encode the hash with the th_ prefix
-	//signedEncodedTxHash := aeternity.Encode(aeternity.PrefixTransactionHash, rlpTxHashRaw)
+	txid := CalcTxHash(txBytes)
 
 	// send it to the network
-	return postTransaction(wm.Api, signedEncodedTx)
+	nodeTxID, err := wm.postTransaction(signedEncodedTx)
+	if err != nil {
+		//重复广播，节点已有该交易单
+		if isDuplicateTxError(err) {
+			wm.Log.Infof("transaction %s is already known by node", txid)
+			return txid, nil
+		}
+		//请求超时等情况不能确定是否广播成功，查询节点是否已有该交易单
+		if found, _, _, queryErr := wm.GetTransactionLocation(txid); queryErr == nil && found {
+			wm.Log.Infof("transaction %s is found after broadcast failed: %v", txid, err)
+			return txid, nil
+		}
+		return "", wm.convertBroadcastError(err)
+	}
+
+	if nodeTxID != txid {
+		return "", openwallet.Errorf(openwallet.ErrSubmitRawTransactionFailed, "transaction hash mismatch, expected %s got %s", txid, nodeTxID)
+	}
+
+	return txid, nil
+}
+
+//convertBroadcastError 广播失败的错误，签名错误时检查节点的networkID，其他未知错误为广播失败
+func (wm *WalletManager) convertBroadcastError(err error) error {
+	owErr := openwallet.ConvertError(err)
+	switch owErr.Code() {
+	case openwallet.ErrVerifyRawTransactionFailed:
+		//签名消息包含networkID，networkID不一致时节点只能返回签名错误
+		if networkID, statusErr := wm.GetNodeNetworkID(); statusErr == nil && networkID != wm.Config.NetworkID {
+			return openwallet.Errorf(openwallet.ErrVerifyRawTransactionFailed, "wrong network, node networkID is %s, but config networkID is %s", networkID, wm.Config.NetworkID)
+		}
+	case openwallet.ErrUnknownException:
+		return openwallet.Errorf(openwallet.ErrSubmitRawTransactionFailed, "%s", strings.TrimPrefix(owErr.Error(), fmt.Sprintf("[%d]", owErr.Code())))
+	}
+	return owErr
+}
+
+//GetNodeNetworkID 节点的networkID
+func (wm *WalletManager) GetNodeNetworkID() (string, error) {
+
+	if wm.client == nil {
+		return "", fmt.Errorf("aeternity API is not inited")
+	}
+
+	result, err := wm.client.Call("/status", "GET", nil)
+	if err != nil {
+		return "", err
+	}
+
+	return result.Get("network_id").String(), nil
+}
+
+//CalcTxHash 计算已签名交易单的hash，blake2b哈希的th_编码
+func CalcTxHash(signedTx []byte) string {
+	return aeternity.Encode(aeternity.PrefixTransactionHash, owcrypt.Hash(signedTx, 32, owcrypt.HASH_ALG_BLAKE2B))
+}
+
+//isDuplicateTxError 节点返回的错误是否为交易单已存在，按NodeErrorRules匹配错误原因
+func isDuplicateTxError(err error) bool {
+	if err == nil {
+		return false
+	}
+	rule := matchNodeErrorRule(err.Error())
+	return rule != nil && rule.Duplicate
 }
 
 // SignEncodeTx sign and encode a transaction
@@ -126,17 +387,44 @@ func buildRLPMessage(tag uint, version uint, fields ...interface{}) (rlpRawMsg [
 	return
 }
 
-// postTransaction post a transaction to the chain
-func postTransaction(node *aeternity.Node, signedEncodedTx string) (string, error) {
-	p := external.NewPostTransactionParams().WithBody(&models.Tx{
-		Tx: &signedEncodedTx,
-	})
-	r, err := node.External.PostTransaction(p)
+//postTransaction 广播已签名的交易单，返回节点计算的交易单hash
+func (wm *WalletManager) postTransaction(signedEncodedTx string) (string, error) {
+
+	if wm.client == nil {
+		return "", fmt.Errorf("aeternity API is not inited")
+	}
+
+	result, err := wm.client.Call("/transactions", "POST", req.BodyJSON(map[string]interface{}{
+		"tx": signedEncodedTx,
+	}))
 	if err != nil {
 		return "", err
 	}
-	//if r.Payload.TxHash != models.EncodedHash(signedEncodedTxHash) {
-	//	err = fmt.Errorf("Transaction hash mismatch, expected %s got %s", signedEncodedTxHash, r.Payload.TxHash)
-	//}
-	return string(*r.Payload.TxHash), nil
+
+	return result.Get("tx_hash").String(), nil
+}
+
+//GetTransactionLocation 查询交易单在链上的位置，found为false表示节点没有该交易单，
+//blockHeight为-1表示交易单还在交易池中
+func (wm *WalletManager) GetTransactionLocation(txid string) (found bool, blockHash string, blockHeight int64, err error) {
+
+	if wm.client == nil {
+		return false, "", 0, fmt.Errorf("aeternity API is not inited")
+	}
+
+	result, err := wm.client.Call("/transactions/"+txid, "GET", nil)
+	if err != nil {
+		if isNotFoundError(err) {
+			return false, "", 0, nil
+		}
+		return false, "", 0, err
+	}
+
+	blockHash = result.Get("block_hash").String()
+	blockHeight = result.Get("block_height").Int()
+	if blockHash == "none" {
+		blockHeight = -1
+	}
+
+	return true, blockHash, blockHeight, nil
 }
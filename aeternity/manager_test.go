@@ -2,9 +2,14 @@ package aeternity
 
 import (
 	"encoding/hex"
+	"fmt"
 	"github.com/aeternity/aepp-sdk-go/aeternity"
 	"github.com/astaxie/beego/config"
 	"github.com/blocktree/openwallet/log"
+	"github.com/blocktree/openwallet/openwallet"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
 	"path/filepath"
 	"testing"
 )
@@ -64,4 +69,72 @@ func TestWalletManager_BroadcastTransaction(t *testing.T) {
 		return
 	}
 	log.Infof("txid: %s", txid)
-}
\ No newline at end of file
+}
+
+func TestCalcTxHash(t *testing.T) {
+
+	account, err := aeternity.AccountFromHexString("e6a91d633c77cf5771329d3354b3bcef1bc5e032c43d70b6d35af923ce1eb74dcea7ade470c9f99d9d4e400880a86f1d49bb444b62f11a9ebb64bbcfeb73fef3")
+	if err != nil {
+		t.Errorf("AccountFromHexString error: %v", err)
+		return
+	}
+
+	spendTx := aeternity.NewSpendTx(account.Address, account.Address, *big.NewInt(1000), *big.NewInt(20000000000000), "", 500, 1)
+	txRaw, _ := spendTx.RLP()
+	signedEncodedTx, signedEncodedTxHash, _, err := aeternity.SignEncodeTx(account, txRaw, "ae_mainnet")
+	if err != nil {
+		t.Errorf("SignEncodeTx error: %v", err)
+		return
+	}
+
+	signedTx, _ := aeternity.Decode(signedEncodedTx)
+	if txid := CalcTxHash(signedTx); txid != signedEncodedTxHash {
+		t.Errorf("CalcTxHash = %s, want %s", txid, signedEncodedTxHash)
+	}
+}
+
+func TestBroadcastTransactionHashMismatch(t *testing.T) {
+
+	spendTx := aeternity.NewSpendTx("ak_qcqXt6ySgRPvBkNwEpNMvaKWzrhPZsoBHLvgg68qg9vRht62y", "ak_qcqXt6ySgRPvBkNwEpNMvaKWzrhPZsoBHLvgg68qg9vRht62y", *big.NewInt(1000), *big.NewInt(20000000000000), "", 500, 1)
+	txRaw, _ := spendTx.RLP()
+	signedTx, _ := createSignedTransaction(txRaw, [][]byte{make([]byte, signatureLength)})
+	txid := CalcTxHash(signedTx)
+
+	//节点返回的hash
+	nodeTxID := txid
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"tx_hash":"%s"}`, nodeTxID)
+	}))
+	defer server.Close()
+
+	wm := NewWalletManager()
+	wm.client = NewClient(server.URL, false)
+
+	result, err := wm.BroadcastTransaction(hex.EncodeToString(signedTx))
+	if err != nil || result != txid {
+		t.Errorf("BroadcastTransaction = %s, %v, want %s", result, err, txid)
+	}
+
+	//本地计算的hash和节点返回的不一致，不能确定哪个是对的，广播失败
+	nodeTxID = "th_2YpR4uXB6e4wMqDjbmeSsJp6xeR8cNuyUqahfnV1V7fyfDXYbs"
+	result, err = wm.BroadcastTransaction(hex.EncodeToString(signedTx))
+	if err == nil || openwallet.ConvertError(err).Code() != openwallet.ErrSubmitRawTransactionFailed {
+		t.Errorf("BroadcastTransaction = %s, %v, want ErrSubmitRawTransactionFailed", result, err)
+	}
+}
+
+func TestIsDuplicateTxError(t *testing.T) {
+	if !isDuplicateTxError(fmt.Errorf("[400 Bad Request]already_accepted")) {
+		t.Errorf("already_accepted should be duplicate")
+	}
+	if isDuplicateTxError(fmt.Errorf("[400 Bad Request]Invalid tx")) {
+		t.Errorf("Invalid tx should not be duplicate")
+	}
+	if isDuplicateTxError(fmt.Errorf("[400 Bad Request]Invalid tx: tx_nonce_already_used_for_account")) {
+		t.Errorf("nonce already used should not be duplicate")
+	}
+	//只按节点的错误原因匹配，不按普通文字匹配
+	if isDuplicateTxError(fmt.Errorf("[400 Bad Request]duplicate field already set")) {
+		t.Errorf("unknown reason should not be duplicate")
+	}
+}
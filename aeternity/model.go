@@ -1,9 +1,11 @@
 package aeternity
 
 import (
+	"fmt"
 	"github.com/aeternity/aepp-sdk-go/swagguard/node/models"
 	"github.com/blocktree/openwallet/openwallet"
 	"math/big"
+	"time"
 )
 
 type AddrBalance struct {
@@ -15,12 +17,16 @@ type AddrBalance struct {
 type txFeeInfo struct {
 	GasUsed  *big.Int
 	GasPrice *big.Int
+	TxFee    *big.Int //合约调用交易单的fee字段，燃料费另外按GasUsed * GasPrice消耗
 	Fee      *big.Int
 }
 
 func (f *txFeeInfo) CalcFee() error {
 	fee := new(big.Int)
 	fee.Mul(f.GasUsed, f.GasPrice)
+	if f.TxFee != nil {
+		fee.Add(fee, f.TxFee)
+	}
 	f.Fee = fee
 	return nil
 }
@@ -31,6 +37,7 @@ type Block struct {
 	Merkleroot        string
 	MicroBlocks       []string
 	Previousblockhash string
+	PrevHash          string //上一代最后一个microblock的hash，没有microblock时为上一个keyblock的hash
 	Height            uint64 `storm:"id"`
 	Version           uint64
 	Time              uint64
@@ -42,6 +49,7 @@ func NewBlock(generation *models.Generation) *Block {
 	obj.Height = *generation.KeyBlock.Height
 	obj.Hash = *generation.KeyBlock.Hash
 	obj.Previousblockhash = *generation.KeyBlock.PrevKeyHash
+	obj.PrevHash = *generation.KeyBlock.PrevHash
 	obj.Time = *generation.KeyBlock.Time
 	obj.MicroBlocks = generation.MicroBlocks
 
@@ -65,15 +73,82 @@ func (b *Block) BlockHeader(symbol string) *openwallet.BlockHeader {
 	return &obj
 }
 
+//MicroBlock 已提取的microblock记录，Height为所属keyblock的高度
 type MicroBlock struct {
-	Hash              string `storm:"id"`
-	Height            uint64
+	Hash   string `storm:"id"`
+	Height uint64 `storm:"index"`
+	TxIDs  []string //已通知观测者的交易单
 }
 
-func NewMicroBlock(height uint64, hash string) *MicroBlock {
+func NewMicroBlock(height uint64, hash string, txIDs []string) *MicroBlock {
 	obj := &MicroBlock{}
 	obj.Height = height
 	obj.Hash = hash
+	obj.TxIDs = txIDs
 	return obj
 }
 
+//NonceReservation 已预留的nonce，交易单创建时预留，交易上链、ttl过期或放弃时释放
+type NonceReservation struct {
+	ID         string `storm:"id"` //address:nonce
+	Address    string `storm:"index"`
+	Nonce      uint64
+	TTL        uint64 //交易单的ttl，超过此高度交易单不能再上链
+	CreateTime int64
+}
+
+func NewNonceReservation(address string, nonce, ttl uint64) *NonceReservation {
+	obj := &NonceReservation{}
+	obj.ID = fmt.Sprintf("%s:%d", address, nonce)
+	obj.Address = address
+	obj.Nonce = nonce
+	obj.TTL = ttl
+	obj.CreateTime = time.Now().Unix()
+	return obj
+}
+
+//已提交交易单的状态
+const (
+	TrackStatusPending   = "pending"   //在交易池中
+	TrackStatusMined     = "mined"     //已打包进microblock
+	TrackStatusFinalized = "finalized" //已达到最终确认数
+	TrackStatusDropped   = "dropped"   //已被节点丢弃或ttl过期
+	TrackStatusReplaced  = "replaced"  //已被相同nonce的交易单替换
+)
+
+//TrackedTransaction 跟踪中的已提交交易单
+type TrackedTransaction struct {
+	TxID          string `storm:"id"`
+	Address       string //发送地址
+	Nonce         uint64
+	TTL           uint64
+	PayerAddress  string //代付地址，代付交易单同时占用代付地址的nonce
+	PayerNonce    uint64
+	RawHex        string //已签名的交易单，用于重新广播
+	AccountID     string
+	Status        string `storm:"index"`
+	BlockHash     string //所在的microblock
+	BlockHeight   uint64 //所在的keyblock高度
+	Confirmations uint64
+	MissCount     uint64 //连续查询不到的次数
+	SubmitTime    int64
+	UpdateTime    int64
+
+	//用于创建替换交易单
+	Coin     openwallet.Coin
+	TxFrom   []string
+	TxTo     []string
+	TxAmount string
+	Fees     string
+	Memo     string
+
+	RebroadcastCount uint64 //重新广播的次数
+	LastActionTime   int64  //最后一次广播或创建替换交易单的时间
+	ReplacedBy       string //替换的交易单
+	Replacing        bool   //已创建替换交易单，等待签名和广播，期间不再创建新的替换交易单
+}
+
+//IsTerminal 是否为最终状态，不再跟踪
+func (tx *TrackedTransaction) IsTerminal() bool {
+	return tx.Status == TrackStatusFinalized || tx.Status == TrackStatusDropped || tx.Status == TrackStatusReplaced
+}
@@ -0,0 +1,107 @@
+package aeternity
+
+import (
+	"fmt"
+	"github.com/aeternity/aepp-sdk-go/swagguard/node/models"
+	"github.com/blocktree/openwallet/openwallet"
+	"github.com/tidwall/gjson"
+	"strings"
+)
+
+//NodeErrorRule 节点错误原因和openwallet错误码的对应规则
+type NodeErrorRule struct {
+	Keywords  []string //节点返回的错误原因包含的关键字，小写
+	Code      uint64   //openwallet错误码
+	Retryable bool     //相同的请求稍后重试是否可能成功
+	Duplicate bool     //广播时节点已有该交易单，视为广播成功
+}
+
+//NodeErrorRules 节点错误对应表，按顺序匹配错误原因，匹配不到时HTTP 5xx和网络错误为ErrCallFullNodeAPIFailed
+//
+//	错误情况          关键字                                        错误码                                  可重试
+//	交易单已存在       already_accepted                              ErrSubmitRawTransactionFailed(2008)    否，广播时视为成功
+//	nonce过高         nonce_too_high                                ErrNonceInvaild(3007)                  是，等待前面的nonce上链
+//	nonce过低或已使用  nonce_too_low, nonce_already_used              ErrNonceInvaild(3007)                  否，重新创建交易单
+//	ttl过期           ttl_expired                                   ErrSubmitRawTransactionFailed(2008)    否，重新创建交易单
+//	手续费过低         too_low_fee, fee_too_low, too_low_gas_price    ErrInsufficientFees(2003)              否，提高手续费重新创建
+//	地址余额不足       insufficient_funds, insufficient_balance       ErrInsufficientBalanceOfAddress(2002)  否，余额增加后重新创建
+//	签名错误          signature                                     ErrVerifyRawTransactionFailed(2007)    否，networkID不一致时也是该错误
+//	网络ID错误        network_id, wrong network                     ErrVerifyRawTransactionFailed(2007)    否，检查networkID配置
+//	账户不存在         account not found                             ErrAccountNotFound(3001)               否，地址没有收到过转账
+//	地址无效          invalid public key, invalid pubkey, invalid hash ErrAdressDecodeFailed(3006)         否
+//	节点不可用         HTTP 5xx, 网络错误                              ErrCallFullNodeAPIFailed(4001)         是
+var NodeErrorRules = []*NodeErrorRule{
+	{Keywords: []string{"already_accepted"}, Code: openwallet.ErrSubmitRawTransactionFailed, Duplicate: true},
+	{Keywords: []string{"nonce_too_high"}, Code: openwallet.ErrNonceInvaild, Retryable: true},
+	{Keywords: []string{"nonce_too_low", "nonce_already_used"}, Code: openwallet.ErrNonceInvaild},
+	{Keywords: []string{"ttl_expired"}, Code: openwallet.ErrSubmitRawTransactionFailed},
+	{Keywords: []string{"too_low_fee", "fee_too_low", "too_low_gas_price"}, Code: openwallet.ErrInsufficientFees},
+	{Keywords: []string{"insufficient_funds", "insufficient_balance"}, Code: openwallet.ErrInsufficientBalanceOfAddress},
+	{Keywords: []string{"signature"}, Code: openwallet.ErrVerifyRawTransactionFailed},
+	{Keywords: []string{"network_id", "wrong network"}, Code: openwallet.ErrVerifyRawTransactionFailed},
+	{Keywords: []string{"account not found"}, Code: openwallet.ErrAccountNotFound},
+	{Keywords: []string{"invalid public key", "invalid pubkey", "invalid hash"}, Code: openwallet.ErrAdressDecodeFailed},
+}
+
+//matchNodeErrorRule 按错误原因匹配对应规则，匹配不到返回nil
+func matchNodeErrorRule(reason string) *NodeErrorRule {
+	reason = strings.ToLower(reason)
+	for _, rule := range NodeErrorRules {
+		for _, keyword := range rule.Keywords {
+			if strings.Contains(reason, keyword) {
+				return rule
+			}
+		}
+	}
+	return nil
+}
+
+//nodeErrorReason 节点返回的错误原因，新版本节点在error_code中返回具体原因
+func nodeErrorReason(body []byte) string {
+	reason := gjson.GetBytes(body, "reason").String()
+	if errorCode := gjson.GetBytes(body, "error_code").String(); len(errorCode) > 0 {
+		reason = fmt.Sprintf("%s: %s", reason, errorCode)
+	}
+	return reason
+}
+
+//modelErrorReason swagger接口返回的错误原因
+func modelErrorReason(e *models.Error) string {
+	if e == nil || e.Reason == nil {
+		return ""
+	}
+	return *e.Reason
+}
+
+//NewNodeError 按HTTP状态和节点返回的错误原因生成openwallet错误，
+//匹配不到规则时HTTP 5xx为ErrCallFullNodeAPIFailed，其他为ErrUnknownException
+func NewNodeError(statusCode int, status, reason string) *openwallet.Error {
+	message := fmt.Sprintf("[%s]%s", status, reason)
+	if rule := matchNodeErrorRule(reason); rule != nil {
+		return openwallet.Errorf(rule.Code, "%s", message)
+	}
+	if statusCode >= 500 {
+		return openwallet.Errorf(openwallet.ErrCallFullNodeAPIFailed, "%s", message)
+	}
+	return openwallet.Errorf(openwallet.ErrUnknownException, "%s", message)
+}
+
+//IsRetryableError 相同的请求稍后重试是否可能成功，规则见NodeErrorRules
+func IsRetryableError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if rule := matchNodeErrorRule(err.Error()); rule != nil {
+		return rule.Retryable
+	}
+	owErr, ok := err.(*openwallet.Error)
+	if !ok {
+		return false
+	}
+	return owErr.Code() == openwallet.ErrCallFullNodeAPIFailed
+}
+
+//isNotFoundError 节点返回404
+func isNotFoundError(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "[404")
+}
@@ -0,0 +1,51 @@
+package aeternity
+
+import (
+	"fmt"
+	"github.com/blocktree/openwallet/openwallet"
+	"net/http"
+	"testing"
+)
+
+func TestNewNodeError(t *testing.T) {
+
+	tests := []struct {
+		statusCode int
+		reason     string
+		code       uint64
+		retryable  bool
+	}{
+		{http.StatusBadRequest, "Invalid tx: insufficient_funds", openwallet.ErrInsufficientBalanceOfAddress, false},
+		{http.StatusBadRequest, "Invalid tx: account_nonce_too_high", openwallet.ErrNonceInvaild, true},
+		{http.StatusBadRequest, "Invalid tx: account_nonce_too_low", openwallet.ErrNonceInvaild, false},
+		{http.StatusBadRequest, "Invalid tx: tx_nonce_already_used_for_account", openwallet.ErrNonceInvaild, false},
+		{http.StatusBadRequest, "Invalid tx: ttl_expired", openwallet.ErrSubmitRawTransactionFailed, false},
+		{http.StatusBadRequest, "Invalid tx: too_low_fee", openwallet.ErrInsufficientFees, false},
+		{http.StatusBadRequest, "Invalid tx: signature_check_failed", openwallet.ErrVerifyRawTransactionFailed, false},
+		{http.StatusNotFound, "Account not found", openwallet.ErrAccountNotFound, false},
+		{http.StatusBadRequest, "Invalid public key", openwallet.ErrAdressDecodeFailed, false},
+		{http.StatusServiceUnavailable, "", openwallet.ErrCallFullNodeAPIFailed, true},
+		{http.StatusBadRequest, "Invalid tx", openwallet.ErrUnknownException, false},
+	}
+
+	for _, test := range tests {
+		err := NewNodeError(test.statusCode, http.StatusText(test.statusCode), test.reason)
+		if err.Code() != test.code {
+			t.Errorf("NewNodeError(%s) code = %d, want %d", test.reason, err.Code(), test.code)
+		}
+		if IsRetryableError(err) != test.retryable {
+			t.Errorf("IsRetryableError(%s) = %v, want %v", test.reason, !test.retryable, test.retryable)
+		}
+	}
+
+	if IsRetryableError(fmt.Errorf("transaction signature is empty")) {
+		t.Errorf("local error should not be retryable")
+	}
+}
+
+func TestNodeErrorReason(t *testing.T) {
+	reason := nodeErrorReason([]byte(`{"reason":"Invalid tx","error_code":"too_low_fee"}`))
+	if reason != "Invalid tx: too_low_fee" {
+		t.Errorf("nodeErrorReason = %s", reason)
+	}
+}
@@ -0,0 +1,190 @@
+package aeternity
+
+import (
+	"fmt"
+	"github.com/aeternity/aepp-sdk-go/aeternity"
+	"github.com/asdine/storm"
+	"sync"
+)
+
+//NonceManager 本地nonce分配器，创建交易单时预留nonce，避免同一地址并发创建的交易单使用相同的nonce
+//预留记录保存在本地数据库，每次分配前都和节点的账户nonce及交易池对账
+type NonceManager struct {
+	wm *WalletManager
+	mu sync.Mutex
+}
+
+//NewNonceManager 创建nonce分配器
+func NewNonceManager(wm *WalletManager) *NonceManager {
+	return &NonceManager{wm: wm}
+}
+
+//openDB 本地数据库
+func (nm *NonceManager) openDB() (*storm.DB, error) {
+	return nm.wm.openDB()
+}
+
+//accountNonceState 地址在节点上的nonce状态，批量创建交易单时同一地址只查询一次
+type accountNonceState struct {
+	Address       string
+	TTL           uint64   //新交易单的ttl
+	AccountNonce  uint64   //账户已上链的nonce
+	Height        uint64   //当前区块高度
+	PendingNonces []uint64 //交易池中的nonce
+}
+
+//getAccountNonceState 查询地址的nonce状态
+func (nm *NonceManager) getAccountNonceState(address string) (*accountNonceState, error) {
+
+	if nm.wm.Api == nil {
+		return nil, fmt.Errorf("aeternity API is not inited")
+	}
+
+	ttl, accountNonce, err := aeternity.GetTTLNonce(nm.wm.Api, address, aeternity.Config.Client.TTL)
+	if err != nil {
+		return nil, err
+	}
+
+	//交易池查询失败时只按本地预留记录分配
+	pendingNonces, err := nm.wm.GetAccountPendingNonces(address)
+	if err != nil {
+		nm.wm.Log.Errorf("get pending transactions of address %s failed: %v", address, err)
+	}
+
+	return &accountNonceState{
+		Address: address,
+		TTL:     ttl,
+		//GetTTLNonce返回的是账户的下一个nonce
+		AccountNonce:  accountNonce - 1,
+		Height:        ttl - aeternity.Config.Client.TTL,
+		PendingNonces: pendingNonces,
+	}, nil
+}
+
+//ReserveNonce 为地址预留下一个可用的nonce，返回预留记录，ttl为交易单的ttl
+func (nm *NonceManager) ReserveNonce(address string) (*NonceReservation, error) {
+
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+
+	state, err := nm.getAccountNonceState(address)
+	if err != nil {
+		return nil, err
+	}
+
+	return nm.reserveNonce(state)
+}
+
+//reserveNonceWithState 按已查询的nonce状态预留nonce，同一地址连续预留时不必重复查询节点
+func (nm *NonceManager) reserveNonceWithState(state *accountNonceState) (*NonceReservation, error) {
+
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+
+	return nm.reserveNonce(state)
+}
+
+//reserveNonce 和本地预留记录对账后分配nonce，调用者需要持有锁
+func (nm *NonceManager) reserveNonce(state *accountNonceState) (*NonceReservation, error) {
+
+	db, err := nm.openDB()
+	if err != nil {
+		return nil, err
+	}
+
+	used, err := nm.reconcile(db, state)
+	if err != nil {
+		return nil, err
+	}
+
+	reservation := NewNonceReservation(state.Address, allocateNonce(state.AccountNonce, used), state.TTL)
+	if err := db.Save(reservation); err != nil {
+		return nil, err
+	}
+
+	nm.wm.Log.Debugf("reserve nonce %d of address %s, account nonce: %d", reservation.Nonce, state.Address, state.AccountNonce)
+
+	return reservation, nil
+}
+
+//ReleaseNonce 释放地址预留的nonce，交易单放弃或广播失败时调用
+func (nm *NonceManager) ReleaseNonce(address string, nonce uint64) error {
+
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+
+	db, err := nm.openDB()
+	if err != nil {
+		return err
+	}
+
+	err = db.DeleteStruct(&NonceReservation{ID: fmt.Sprintf("%s:%d", address, nonce)})
+	if err != nil && err != storm.ErrNotFound {
+		return err
+	}
+
+	nm.wm.Log.Debugf("release nonce %d of address %s", nonce, address)
+
+	return nil
+}
+
+//GetReservations 获取地址预留的nonce记录
+func (nm *NonceManager) GetReservations(address string) ([]*NonceReservation, error) {
+
+	db, err := nm.openDB()
+	if err != nil {
+		return nil, err
+	}
+
+	var reservations []*NonceReservation
+	err = db.Find("Address", address, &reservations)
+	if err != nil && err != storm.ErrNotFound {
+		return nil, err
+	}
+
+	return reservations, nil
+}
+
+//reconcile 和节点对账，删除已上链和ttl过期的预留记录，返回交易池和预留记录已使用的nonce
+func (nm *NonceManager) reconcile(db *storm.DB, state *accountNonceState) (map[uint64]bool, error) {
+
+	var (
+		accountNonce = state.AccountNonce
+		height       = state.Height
+		used         = make(map[uint64]bool)
+	)
+
+	for _, nonce := range state.PendingNonces {
+		if nonce > accountNonce {
+			used[nonce] = true
+		}
+	}
+
+	var reservations []*NonceReservation
+	err := db.Find("Address", state.Address, &reservations)
+	if err != nil && err != storm.ErrNotFound {
+		return nil, err
+	}
+
+	for _, reservation := range reservations {
+		//已上链，或者ttl过期且不在交易池
+		if reservation.Nonce <= accountNonce || (reservation.TTL < height && !used[reservation.Nonce]) {
+			if err := db.DeleteStruct(reservation); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		used[reservation.Nonce] = true
+	}
+
+	return used, nil
+}
+
+//allocateNonce 分配大于账户nonce且未使用的最小nonce，释放的nonce会被优先使用，避免后续交易卡住
+func allocateNonce(accountNonce uint64, used map[uint64]bool) uint64 {
+	nonce := accountNonce + 1
+	for used[nonce] {
+		nonce++
+	}
+	return nonce
+}
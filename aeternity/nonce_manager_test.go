@@ -0,0 +1,75 @@
+package aeternity
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestAllocateNonce(t *testing.T) {
+
+	if nonce := allocateNonce(5, map[uint64]bool{}); nonce != 6 {
+		t.Errorf("allocateNonce = %d", nonce)
+	}
+	if nonce := allocateNonce(5, map[uint64]bool{6: true, 7: true, 9: true}); nonce != 8 {
+		t.Errorf("allocateNonce = %d", nonce)
+	}
+}
+
+func TestNonceManager_reconcile(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "nonce")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	wm := NewWalletManager()
+	wm.Config.dbPath = dir
+	nm := wm.NonceManager
+
+	address := "ak_qcqXt6ySgRPvBkNwEpNMvaKWzrhPZsoBHLvgg68qg9vRht62y"
+
+	db, err := nm.openDB()
+	if err != nil {
+		t.Fatalf("openDB error: %v", err)
+	}
+
+	//nonce 3已上链，nonce 5的ttl已过期，nonce 4和6仍然有效
+	for _, r := range []*NonceReservation{
+		NewNonceReservation(address, 3, 200),
+		NewNonceReservation(address, 4, 200),
+		NewNonceReservation(address, 5, 90),
+		NewNonceReservation(address, 6, 200),
+	} {
+		if err := db.Save(r); err != nil {
+			t.Fatalf("Save error: %v", err)
+		}
+	}
+
+	used, err := nm.reconcile(db, &accountNonceState{Address: address, AccountNonce: 3, Height: 100})
+	wm.CloseDB()
+	if err != nil {
+		t.Errorf("reconcile error: %v", err)
+		return
+	}
+	if len(used) != 2 || !used[4] || !used[6] {
+		t.Errorf("reconcile used = %v", used)
+	}
+	if nonce := allocateNonce(3, used); nonce != 5 {
+		t.Errorf("allocateNonce = %d", nonce)
+	}
+
+	reservations, err := nm.GetReservations(address)
+	if err != nil || len(reservations) != 2 {
+		t.Errorf("GetReservations = %d, %v", len(reservations), err)
+	}
+
+	if err := nm.ReleaseNonce(address, 4); err != nil {
+		t.Errorf("ReleaseNonce error: %v", err)
+	}
+	reservations, _ = nm.GetReservations(address)
+	if len(reservations) != 1 || reservations[0].Nonce != 6 {
+		t.Errorf("reservations after release = %v", reservations)
+	}
+}
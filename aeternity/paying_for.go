@@ -0,0 +1,327 @@
+package aeternity
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"github.com/aeternity/aepp-sdk-go/aeternity"
+	"github.com/blocktree/openwallet/common"
+	"github.com/blocktree/openwallet/openwallet"
+	"math"
+	"math/big"
+)
+
+const (
+	//ObjectTagPayingForTransaction PayingForTx的RLP标签
+	ObjectTagPayingForTransaction uint = 82
+
+	//innerTxNetworkSuffix 内部交易单签名使用的网络ID后缀
+	innerTxNetworkSuffix = "-inner_tx"
+
+	//signatureLength ed25519签名的长度
+	signatureLength = 64
+)
+
+//PayingForTx 代付交易单，PayerID支付内部交易单的手续费和燃料费，内部交易单的fee为0
+type PayingForTx struct {
+	PayerID string
+	Nonce   uint64
+	Fee     big.Int
+	Tx      []byte       //已签名的内部交易单
+	InnerTx aeternity.Tx //内部交易单，用于计算手续费
+}
+
+//NewPayingForTx 创建代付交易单，signedInnerTx为空时使用空签名占位，交易单大小和签名后一致
+func NewPayingForTx(payerID string, nonce uint64, innerTx aeternity.Tx, signedInnerTx []byte) (*PayingForTx, error) {
+	if signedInnerTx == nil {
+		innerRaw, err := innerTx.RLP()
+		if err != nil {
+			return nil, err
+		}
+		signedInnerTx, err = createSignedTransaction(innerRaw, [][]byte{make([]byte, signatureLength)})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &PayingForTx{
+		PayerID: payerID,
+		Nonce:   nonce,
+		Tx:      signedInnerTx,
+		InnerTx: innerTx,
+	}, nil
+}
+
+//RLP 交易单的RLP编码
+func (tx *PayingForTx) RLP() ([]byte, error) {
+	pID, err := buildIDTag(aeternity.IDTagAccount, tx.PayerID)
+	if err != nil {
+		return nil, err
+	}
+	return buildRLPMessage(
+		ObjectTagPayingForTransaction,
+		1,
+		pID,
+		tx.Nonce,
+		tx.Fee,
+		tx.Tx)
+}
+
+//buildIDTag 编码id类型，1字节标签 + 32字节hash
+func buildIDTag(tag uint8, encoded string) ([]byte, error) {
+	raw, err := aeternity.Decode(encoded)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{tag}, raw...), nil
+}
+
+//innerTxSignMessage 内部交易单的签名消息
+func innerTxSignMessage(networkID string, txRaw []byte) []byte {
+	return append([]byte(networkID+innerTxNetworkSuffix), txRaw...)
+}
+
+//payingForInfo 交易单ExtParam中记录的代付信息
+type payingForInfo struct {
+	PayerAccountID string
+	Payer          string
+	Nonce          uint64
+	Fee            *big.Int
+	InnerTx        []byte
+}
+
+//getPayingForInfo 读取交易单的代付信息，不是代付交易单返回nil
+func getPayingForInfo(rawTx *openwallet.RawTransaction) (*payingForInfo, error) {
+	payingFor := rawTx.GetExtParam().Get("payingFor")
+	if !payingFor.Exists() {
+		return nil, nil
+	}
+	fee, ok := new(big.Int).SetString(payingFor.Get("fee").String(), 10)
+	if !ok {
+		return nil, fmt.Errorf("paying for fee is invalid")
+	}
+	innerTx, err := hex.DecodeString(payingFor.Get("innerTx").String())
+	if err != nil {
+		return nil, fmt.Errorf("paying for inner transaction is invalid")
+	}
+	return &payingForInfo{
+		PayerAccountID: payingFor.Get("payerAccountID").String(),
+		Payer:          payingFor.Get("payer").String(),
+		Nonce:          payingFor.Get("nonce").Uint(),
+		Fee:            fee,
+		InnerTx:        innerTx,
+	}, nil
+}
+
+//createPayingForTransaction 为内部交易单创建代付交易单，付款账户中余额最大的地址作为代付地址
+//代付交易单的手续费 = 代付交易单按大小计算的手续费 + 内部交易单按大小计算的手续费，再乘以手续费倍数
+//代付交易单的签名在内部交易单签名后才能确定，所以签名消息在SignRawTransaction中生成。
+//代付交易单和内部交易单用同一个钱包签名，代付账户必须和发送账户在同一个钱包。
+//返回代付地址预留的nonce，后续步骤失败时由调用方释放
+func (decoder *TransactionDecoder) createPayingForTransaction(
+	wrapper openwallet.WalletDAI,
+	rawTx *openwallet.RawTransaction,
+	payerAccountID string,
+	innerTx aeternity.Tx,
+	innerRaw []byte) (fee *big.Int, payerNonce *NonceReservation, err error) {
+
+	if payerAccountID == rawTx.Account.AccountID {
+		return nil, nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "fee payer account can not be the same as the sender account")
+	}
+
+	payerAccount, err := wrapper.GetAssetsAccountInfo(payerAccountID)
+	if err != nil || payerAccount == nil {
+		return nil, nil, openwallet.Errorf(openwallet.ErrAccountNotFound, "fee payer account [%s] is not found: %v", payerAccountID, err)
+	}
+	if payerAccount.WalletID != rawTx.Account.WalletID {
+		return nil, nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "fee payer account [%s] is not in the wallet of the sender account", payerAccountID)
+	}
+
+	addresses, err := wrapper.GetAddressList(0, -1, "AccountID", payerAccountID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(addresses) == 0 {
+		return nil, nil, openwallet.Errorf(openwallet.ErrAccountNotAddress, "fee payer account [%s] have not addresses", payerAccountID)
+	}
+
+	searchAddrs := make([]string, 0)
+	for _, address := range addresses {
+		searchAddrs = append(searchAddrs, address.Address)
+	}
+
+	addrBalanceArray, err := decoder.wm.Blockscanner.GetBalanceByAddress(searchAddrs...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fundings := make([]*AddrBalance, 0)
+	for _, addrBalance := range addrBalanceArray {
+		fundings = append(fundings, &AddrBalance{
+			Address: addrBalance.Address,
+			Balance: common.StringNumToBigIntWithExp(addrBalance.Balance, decoder.wm.Decimal()),
+		})
+	}
+	fundings = sortFundings(fundings)
+	if len(fundings) == 0 {
+		return nil, nil, openwallet.Errorf(openwallet.ErrInsufficientFees, "fee payer account [%s] does not have enough balance for fees", payerAccountID)
+	}
+	payer := fundings[0]
+
+	//按最大的nonce估算手续费
+	draftTx, err := NewPayingForTx(payer.Address, math.MaxUint32, innerTx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	fee, err = CalcMinimumFee(draftTx, decoder.wm.Config.GetFeeMultiplier())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	totalCost := payingForCost(fee, innerTx)
+	if payer.Balance.Cmp(totalCost) < 0 {
+		costAmount := common.BigIntToDecimals(totalCost, decoder.wm.Decimal())
+		return nil, nil, openwallet.Errorf(openwallet.ErrInsufficientFees, "fee payer account [%s] does not have enough %s [%s] for fees", payerAccountID, decoder.wm.Symbol(), costAmount.String())
+	}
+
+	payerAddr, err := wrapper.GetAddress(payer.Address)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	reservation, err := decoder.wm.NonceManager.ReserveNonce(payer.Address)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	//签名消息在内部交易单签名后生成
+	rawTx.Signatures[payerAccountID] = []*openwallet.KeySignature{
+		{
+			EccType: decoder.wm.Config.CurveType,
+			Address: payerAddr,
+		},
+	}
+	rawTx.SetExtParam("payingFor", map[string]interface{}{
+		"payerAccountID": payerAccountID,
+		"payer":          payer.Address,
+		"nonce":          reservation.Nonce,
+		"fee":            fee.String(),
+		"innerTx":        hex.EncodeToString(innerRaw),
+	})
+
+	return fee, reservation, nil
+}
+
+//payingForCost 代付地址支付的总手续费 = 代付交易单的fee + 内部合约调用的燃料上限 * 燃料价格
+func payingForCost(fee *big.Int, innerTx aeternity.Tx) *big.Int {
+	totalCost := new(big.Int).Set(fee)
+	if callTx, ok := innerTx.(*aeternity.ContractCallTx); ok {
+		totalCost.Add(totalCost, new(big.Int).Mul(&callTx.Gas, &callTx.GasPrice))
+	}
+	return totalCost
+}
+
+//buildPayingForTxRaw 按内部交易单的签名生成代付交易单
+func buildPayingForTxRaw(info *payingForInfo, innerSignature string) ([]byte, error) {
+
+	innerSig, err := hex.DecodeString(innerSignature)
+	if err != nil || len(innerSig) != signatureLength {
+		return nil, fmt.Errorf("inner transaction signature is invalid")
+	}
+
+	signedInnerTx, err := createSignedTransaction(info.InnerTx, [][]byte{innerSig})
+	if err != nil {
+		return nil, err
+	}
+
+	payingForTx, err := NewPayingForTx(info.Payer, info.Nonce, nil, signedInnerTx)
+	if err != nil {
+		return nil, err
+	}
+	payingForTx.Fee = *info.Fee
+
+	return payingForTx.RLP()
+}
+
+//signPayingForTransaction 内部交易单签名后，生成代付交易单的签名消息并签名
+func (decoder *TransactionDecoder) signPayingForTransaction(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction, info *payingForInfo) error {
+
+	innerSignatures := rawTx.Signatures[rawTx.Account.AccountID]
+	if len(innerSignatures) == 0 || len(innerSignatures[0].Signature) == 0 {
+		return fmt.Errorf("inner transaction is not signed")
+	}
+
+	txRaw, err := buildPayingForTxRaw(info, innerSignatures[0].Signature)
+	if err != nil {
+		return err
+	}
+
+	payerSignatures := rawTx.Signatures[info.PayerAccountID]
+	if len(payerSignatures) == 0 {
+		return fmt.Errorf("fee payer signature is empty")
+	}
+	payerSignatures[0].Message = hex.EncodeToString(append([]byte(decoder.wm.Config.NetworkID), txRaw...))
+
+	return decoder.signKeySignatures(wrapper, payerSignatures)
+}
+
+//verifyPayingForTransaction 验证内部交易单和代付交易单的签名，合并为已签名的代付交易单
+func (decoder *TransactionDecoder) verifyPayingForTransaction(rawTx *openwallet.RawTransaction, info *payingForInfo) error {
+
+	innerSignatures := rawTx.Signatures[rawTx.Account.AccountID]
+	payerSignatures := rawTx.Signatures[info.PayerAccountID]
+	if len(innerSignatures) == 0 || len(payerSignatures) == 0 {
+		return fmt.Errorf("transaction signature is empty")
+	}
+
+	for _, keySignature := range []*openwallet.KeySignature{innerSignatures[0], payerSignatures[0]} {
+		if err := verifyKeySignature(keySignature); err != nil {
+			return err
+		}
+	}
+
+	//内部交易单必须是rawTx的交易单，签名消息必须是ExtParam记录的内部交易单
+	if txRaw, err := DecodeRawTx(rawTx.RawHex); err != nil || !bytes.Equal(txRaw, info.InnerTx) {
+		return verifyFailed("inner transaction does not match the transaction")
+	}
+	if innerSignatures[0].Message != hex.EncodeToString(innerTxSignMessage(decoder.wm.Config.NetworkID, info.InnerTx)) {
+		return fmt.Errorf("inner transaction message mismatch")
+	}
+
+	//解码内部交易单，检查交易单字段和rawTx记录一致，签名公钥必须对应发送地址和代付地址
+	innerTx, err := decodeUnsignedTx(info.InnerTx)
+	if err != nil {
+		return verifyFailed("inner transaction decode failed: %v", err)
+	}
+	sender, err := decoder.checkTransactionFields(rawTx, innerTx, info.Fee)
+	if err != nil {
+		return err
+	}
+	if err := checkSigner(innerSignatures[0], sender); err != nil {
+		return err
+	}
+	if err := checkSigner(payerSignatures[0], info.Payer); err != nil {
+		return err
+	}
+
+	//代付交易单的签名消息必须包含已签名的内部交易单
+	txRaw, err := buildPayingForTxRaw(info, innerSignatures[0].Signature)
+	if err != nil {
+		return err
+	}
+	if payerSignatures[0].Message != hex.EncodeToString(append([]byte(decoder.wm.Config.NetworkID), txRaw...)) {
+		return fmt.Errorf("paying for transaction message mismatch")
+	}
+	payerSig, _ := hex.DecodeString(payerSignatures[0].Signature)
+
+	signedEncodedTx, err := createSignedTransaction(txRaw, [][]byte{payerSig})
+	if err != nil {
+		return fmt.Errorf("SignEncodeTx failed, unexpected error: %v", err)
+	}
+
+	rawTx.IsCompleted = true
+	rawTx.RawHex = encodeRawTx(signedEncodedTx, IsBase64Tx(rawTx.RawHex))
+	rawTx.TxID = CalcTxHash(signedEncodedTx)
+
+	return nil
+}
@@ -0,0 +1,124 @@
+package aeternity
+
+import (
+	"encoding/hex"
+	"github.com/aeternity/aepp-sdk-go/aeternity"
+	"github.com/blocktree/openwallet/openwallet"
+	"github.com/shopspring/decimal"
+	"math/big"
+	"testing"
+)
+
+func TestPayingForTx(t *testing.T) {
+
+	sender := "ak_qcqXt6ySgRPvBkNwEpNMvaKWzrhPZsoBHLvgg68qg9vRht62y"
+	payer := "ak_11111111111111111111111111111111273Yts"
+
+	innerTx := aeternity.NewSpendTx(sender, sender, *big.NewInt(1000), *big.NewInt(0), "", 500, 1)
+	payingForTx, err := NewPayingForTx(payer, 1, &innerTx, nil)
+	if err != nil {
+		t.Errorf("NewPayingForTx error: %v", err)
+		return
+	}
+
+	fee, err := CalcMinimumFee(payingForTx, decimal.New(1, 0))
+	if err != nil {
+		t.Errorf("CalcMinimumFee error: %v", err)
+		return
+	}
+
+	//代付手续费包含内部交易单的手续费
+	innerFee, _ := CalcMinimumFee(&innerTx, decimal.New(1, 0))
+	innerTx.Fee = *big.NewInt(0)
+	if fee.Cmp(innerFee) <= 0 {
+		t.Errorf("paying for fee %s is not greater than inner fee %s", fee.String(), innerFee.String())
+	}
+
+	txRaw, err := payingForTx.RLP()
+	if err != nil {
+		t.Errorf("RLP error: %v", err)
+		return
+	}
+	fields := aeternity.DecodeRLPMessage(txRaw)
+	if len(fields) != 6 || hex.EncodeToString(fields[0].([]byte)) != "52" {
+		t.Errorf("paying for tx fields = %v", fields)
+	}
+
+	//按内部交易单签名生成的代付交易单和估算的大小一致
+	innerRaw, _ := innerTx.RLP()
+	rawTx := &openwallet.RawTransaction{}
+	rawTx.SetExtParam("payingFor", map[string]interface{}{
+		"payerAccountID": "payer",
+		"payer":          payer,
+		"nonce":          1,
+		"fee":            fee.String(),
+		"innerTx":        hex.EncodeToString(innerRaw),
+	})
+	info, err := getPayingForInfo(rawTx)
+	if err != nil || info == nil {
+		t.Errorf("getPayingForInfo = %v, %v", info, err)
+		return
+	}
+	signedRaw, err := buildPayingForTxRaw(info, hex.EncodeToString(make([]byte, signatureLength)))
+	if err != nil {
+		t.Errorf("buildPayingForTxRaw error: %v", err)
+		return
+	}
+	if hex.EncodeToString(signedRaw) != hex.EncodeToString(txRaw) {
+		t.Errorf("buildPayingForTxRaw = %x, want %x", signedRaw, txRaw)
+	}
+
+	if _, err := buildPayingForTxRaw(info, "00"); err == nil {
+		t.Errorf("buildPayingForTxRaw with invalid signature should fail")
+	}
+}
+
+//testPayerWrapper 离线测试用的钱包，只提供代付账户查询
+type testPayerWrapper struct {
+	openwallet.WalletDAIBase
+	account *openwallet.AssetsAccount
+}
+
+func (w *testPayerWrapper) GetAssetsAccountInfo(accountID string) (*openwallet.AssetsAccount, error) {
+	return w.account, nil
+}
+
+func TestCreatePayingForTransactionOtherWallet(t *testing.T) {
+
+	decoder := NewTransactionDecoder(NewWalletManager())
+	sender := "ak_qcqXt6ySgRPvBkNwEpNMvaKWzrhPZsoBHLvgg68qg9vRht62y"
+	innerTx := aeternity.NewSpendTx(sender, sender, *big.NewInt(1000), *big.NewInt(0), "", 500, 1)
+	innerRaw, _ := innerTx.RLP()
+
+	rawTx := &openwallet.RawTransaction{
+		Account: &openwallet.AssetsAccount{WalletID: "W1", AccountID: "sender"},
+	}
+	//代付账户在其他钱包，发送账户的钱包无法为代付交易单签名
+	wrapper := &testPayerWrapper{account: &openwallet.AssetsAccount{WalletID: "W2", AccountID: "payer"}}
+	_, payerNonce, err := decoder.createPayingForTransaction(wrapper, rawTx, "payer", &innerTx, innerRaw)
+	if err == nil || payerNonce != nil {
+		t.Errorf("createPayingForTransaction with payer in other wallet should fail")
+	}
+}
+
+func TestPayingForCost(t *testing.T) {
+
+	sender := "ak_qcqXt6ySgRPvBkNwEpNMvaKWzrhPZsoBHLvgg68qg9vRht62y"
+	contract := "ct_2U1usf3A8ZNUcZLkZe5rEoBTxk7eJvk9fcbRDNqmRiwXCHAYN"
+	fee := big.NewInt(30000000000000)
+
+	spendTx := aeternity.NewSpendTx(sender, sender, *big.NewInt(1000), *big.NewInt(0), "", 500, 1)
+	if cost := payingForCost(fee, &spendTx); cost.Cmp(fee) != 0 {
+		t.Errorf("payingForCost of SpendTx = %s, want %s", cost.String(), fee.String())
+	}
+
+	//合约调用还要支付燃料上限 * 燃料价格
+	callTx := aeternity.NewContractCallTx(sender, 1, contract, *big.NewInt(0), *big.NewInt(50000), *big.NewInt(1000000000), fateABIVersion, "cb_AAAAAA", *big.NewInt(0), 500)
+	want := new(big.Int).Add(fee, big.NewInt(50000*1000000000))
+	if cost := payingForCost(fee, &callTx); cost.Cmp(want) != 0 {
+		t.Errorf("payingForCost of ContractCallTx = %s, want %s", cost.String(), want.String())
+	}
+	if fee.Cmp(big.NewInt(30000000000000)) != 0 {
+		t.Errorf("payingForCost modified fee: %s", fee.String())
+	}
+}
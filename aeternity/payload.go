@@ -0,0 +1,117 @@
+package aeternity
+
+import (
+	"encoding/hex"
+	"fmt"
+	"github.com/aeternity/aepp-sdk-go/aeternity"
+	"github.com/blocktree/openwallet/openwallet"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	//PayloadPrefix SpendTx payload的base64check编码前缀
+	PayloadPrefix = "ba_"
+
+	//MaxPayloadSize 转账备注的最大字节数
+	MaxPayloadSize = 1024
+)
+
+//EncodePayload payload编码为ba_。
+//当前SDK没有定义ba_前缀，ba_与cb_同为base64check编码，借用cb_编码后替换前缀
+func EncodePayload(payload []byte) string {
+	//aeternity.Encode会在参数后追加校验码，复制一份避免覆盖调用方数据
+	data := append([]byte{}, payload...)
+	encoded := aeternity.Encode(aeternity.PrefixContractByteArray, data)
+	return PayloadPrefix + strings.TrimPrefix(encoded, string(aeternity.PrefixContractByteArray))
+}
+
+//DecodePayload 解码ba_编码的payload
+func DecodePayload(encoded string) ([]byte, error) {
+	if !strings.HasPrefix(encoded, PayloadPrefix) {
+		return nil, fmt.Errorf("payload [%s] is not %s encoded", encoded, PayloadPrefix)
+	}
+	//SDK不支持解码空内容，空payload直接比较编码结果
+	if encoded == EncodePayload(nil) {
+		return []byte{}, nil
+	}
+	payload, err := aeternity.Decode(string(aeternity.PrefixContractByteArray) + encoded[len(PayloadPrefix):])
+	if err != nil {
+		return nil, fmt.Errorf("payload [%s] is not valid base64check, err: %v", encoded, err)
+	}
+	return payload, nil
+}
+
+//ParseMemo 转账备注转为SpendTx的payload，ba_开头的按base64check解码，其他按UTF-8文本处理
+func ParseMemo(memo string) ([]byte, error) {
+	var payload []byte
+	if strings.HasPrefix(memo, PayloadPrefix) {
+		decoded, err := DecodePayload(memo)
+		if err != nil {
+			return nil, err
+		}
+		payload = decoded
+	} else {
+		if !utf8.ValidString(memo) {
+			return nil, fmt.Errorf("memo is not valid UTF-8 text")
+		}
+		payload = []byte(memo)
+	}
+	if len(payload) > MaxPayloadSize {
+		return nil, fmt.Errorf("memo is %d bytes, exceeds the limit of %d bytes", len(payload), MaxPayloadSize)
+	}
+	return payload, nil
+}
+
+//PayloadToMemo ba_编码的payload转为转账备注，可打印的UTF-8文本原样返回，
+//其他内容返回十六进制编码，并且isHex为true
+func PayloadToMemo(encoded string) (memo string, isHex bool, err error) {
+	payload, err := DecodePayload(encoded)
+	if err != nil {
+		return "", false, err
+	}
+	if isPrintableText(payload) {
+		return string(payload), false, nil
+	}
+	return hex.EncodeToString(payload), true, nil
+}
+
+//isPrintableText 是否为可打印的UTF-8文本
+func isPrintableText(data []byte) bool {
+	if !utf8.Valid(data) {
+		return false
+	}
+	for _, r := range string(data) {
+		if !unicode.IsPrint(r) && !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
+
+//setTransactionMemo 交易单记录转账备注，十六进制的备注在ExtParam中标记memoHex
+func setTransactionMemo(tx *openwallet.Transaction, memo string, isHex bool) {
+	if len(memo) == 0 {
+		return
+	}
+	tx.IsMemo = true
+	tx.Memo = memo
+	tx.SetExtParam("memo", memo)
+	if isHex {
+		tx.SetExtParam("memoHex", true)
+	}
+}
+
+//setOutputMemo 交易输出记录转账备注
+func setOutputMemo(output *openwallet.TxOutPut, memo string, isHex bool) {
+	if len(memo) == 0 {
+		return
+	}
+	output.IsMemo = true
+	output.Memo = memo
+	output.SetExtParam("memo", memo)
+	if isHex {
+		output.SetExtParam("memoHex", true)
+	}
+}
@@ -0,0 +1,81 @@
+package aeternity
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEncodePayload(t *testing.T) {
+
+	if encoded := EncodePayload(nil); encoded != "ba_Xfbg4g==" {
+		t.Errorf("EncodePayload(empty) = %s", encoded)
+	}
+
+	encoded := EncodePayload([]byte("order:10086"))
+	payload, err := DecodePayload(encoded)
+	if err != nil {
+		t.Errorf("DecodePayload error: %v", err)
+		return
+	}
+	if string(payload) != "order:10086" {
+		t.Errorf("DecodePayload = %s", string(payload))
+	}
+
+	if _, err := DecodePayload("ba_Xfbg4w=="); err == nil {
+		t.Errorf("DecodePayload with invalid checksum should fail")
+	}
+}
+
+func TestParseMemo(t *testing.T) {
+
+	tests := []struct {
+		memo    string
+		payload string
+		valid   bool
+	}{
+		{"", "", true},
+		{"订单10086", "订单10086", true},
+		{EncodePayload([]byte{0xff, 0x00}), "\xff\x00", true},
+		{"ba_invalid", "", false},
+		{"\xff", "", false},
+		{strings.Repeat("a", MaxPayloadSize), strings.Repeat("a", MaxPayloadSize), true},
+		{strings.Repeat("a", MaxPayloadSize+1), "", false},
+	}
+
+	for _, test := range tests {
+		payload, err := ParseMemo(test.memo)
+		if test.valid != (err == nil) {
+			t.Errorf("ParseMemo(%q) error: %v", test.memo, err)
+			continue
+		}
+		if string(payload) != test.payload {
+			t.Errorf("ParseMemo(%q) = %q", test.memo, payload)
+		}
+	}
+}
+
+func TestPayloadToMemo(t *testing.T) {
+
+	tests := []struct {
+		payload []byte
+		memo    string
+		isHex   bool
+	}{
+		{nil, "", false},
+		{[]byte("订单10086"), "订单10086", false},
+		{[]byte("line1\nline2"), "line1\nline2", false},
+		{[]byte{0xff, 0x00}, "ff00", true},
+		{[]byte{0x01, 0x02}, "0102", true},
+	}
+
+	for _, test := range tests {
+		memo, isHex, err := PayloadToMemo(EncodePayload(test.payload))
+		if err != nil {
+			t.Errorf("PayloadToMemo(%x) error: %v", test.payload, err)
+			continue
+		}
+		if memo != test.memo || isHex != test.isHex {
+			t.Errorf("PayloadToMemo(%x) = %q, %v", test.payload, memo, isHex)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package aeternity
 import (
 	"fmt"
 	"github.com/blocktree/openwallet/log"
+	"github.com/blocktree/openwallet/openwallet"
 	"github.com/imroc/req"
 	"github.com/tidwall/gjson"
 	"net/http"
@@ -67,7 +68,7 @@ func (c *Client) Call(path, method string, request interface{}) (*gjson.Result,
 	}
 
 	if err != nil {
-		return nil, err
+		return nil, openwallet.Errorf(openwallet.ErrCallFullNodeAPIFailed, "%v", err)
 	}
 
 	resp := gjson.ParseBytes(r.Bytes())
@@ -83,9 +84,7 @@ func (c *Client) Call(path, method string, request interface{}) (*gjson.Result,
 func isError(r *req.Resp) error {
 
 	if r.Response().StatusCode != http.StatusOK {
-		message := gjson.GetBytes(r.Bytes(), "reason").String()
-		message = fmt.Sprintf("[%s]%s", r.Response().Status, message)
-		return fmt.Errorf(message)
+		return NewNodeError(r.Response().StatusCode, r.Response().Status, nodeErrorReason(r.Bytes()))
 	}
 
 
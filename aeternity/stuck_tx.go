@@ -0,0 +1,416 @@
+package aeternity
+
+import (
+	"encoding/hex"
+	"fmt"
+	"github.com/aeternity/aepp-sdk-go/aeternity"
+	"github.com/asdine/storm"
+	"github.com/asdine/storm/q"
+	"github.com/blocktree/openwallet/common"
+	"github.com/blocktree/openwallet/openwallet"
+	"github.com/blocktree/openwallet/timer"
+	rlp "github.com/randomshinichi/rlpae"
+	"github.com/shopspring/decimal"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+//StuckTxObserver 卡住交易单的处理观察者
+type StuckTxObserver interface {
+	//TxRebroadcast 卡住的交易单已重新广播，err为广播失败的原因
+	TxRebroadcast(tx *TrackedTransaction, err error)
+	//TxReplacement 已为卡住的交易单创建替换交易单，err为创建失败的原因
+	//rawTx未签名，需要按正常流程签名、验证和广播，广播成功后原交易单不再跟踪
+	TxReplacement(tx *TrackedTransaction, rawTx *openwallet.RawTransaction, err error)
+}
+
+//StuckTxService 卡住交易单的处理服务，手续费过低或nonce不连续的交易单会一直留在交易池直到ttl过期
+//交易单在交易池中超过RebroadcastAfter秒时重新广播，重新广播MaxRebroadcast次后，
+//开启ReplaceStuckTx时创建相同nonce、更高手续费的替换交易单，开启时必须设置WalletDAI。
+//同一笔交易单同时只有一个等待广播的替换交易单，广播失败或调用CancelReplacement后才会重新创建
+type StuckTxService struct {
+	wm           *WalletManager
+	WalletDAI    openwallet.WalletDAI //创建替换交易单时查询账户和地址
+	mu           sync.RWMutex
+	observers    map[StuckTxObserver]bool
+	stuckTask    *timer.TaskTimer
+	PeriodOfTask time.Duration
+}
+
+//NewStuckTxService 创建卡住交易单的处理服务
+func NewStuckTxService(wm *WalletManager) *StuckTxService {
+	return &StuckTxService{
+		wm:           wm,
+		observers:    make(map[StuckTxObserver]bool),
+		PeriodOfTask: time.Duration(wm.Config.TrackPeriod) * time.Second,
+	}
+}
+
+//AddObserver 添加观察者
+func (ss *StuckTxService) AddObserver(obj StuckTxObserver) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	if obj == nil {
+		return nil
+	}
+	ss.observers[obj] = true
+	return nil
+}
+
+//RemoveObserver 移除观察者
+func (ss *StuckTxService) RemoveObserver(obj StuckTxObserver) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	delete(ss.observers, obj)
+	return nil
+}
+
+//Run 启动定时检查，由调用方启动，加载配置不会启动。修改查询间隔后需要Stop再Run
+func (ss *StuckTxService) Run() error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	//替换交易单需要查询账户和地址
+	if ss.wm.Config.ReplaceStuckTx && ss.WalletDAI == nil {
+		return fmt.Errorf("wallet DAI is not set, it is required when replaceStuckTx is enabled")
+	}
+
+	if ss.stuckTask != nil && ss.stuckTask.Running() {
+		return nil
+	}
+	ss.stuckTask = timer.NewTask(ss.PeriodOfTask, ss.poll)
+	ss.stuckTask.Start()
+	return nil
+}
+
+//Stop 停止定时检查
+func (ss *StuckTxService) Stop() error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	if ss.stuckTask != nil {
+		ss.stuckTask.Stop()
+		ss.stuckTask = nil
+	}
+	return nil
+}
+
+//isStuckTransaction 交易单在交易池中超过after秒没有处理视为卡住
+func isStuckTransaction(tracked *TrackedTransaction, now, after int64) bool {
+	if tracked.Status != TrackStatusPending {
+		return false
+	}
+	lastActionTime := tracked.LastActionTime
+	if lastActionTime == 0 {
+		lastActionTime = tracked.SubmitTime
+	}
+	return now-lastActionTime >= after
+}
+
+//poll 检查交易池中的交易单，同一地址按nonce从小到大处理，先处理的交易单可以补上nonce的空缺
+func (ss *StuckTxService) poll() {
+
+	db, err := ss.wm.TxTracker.openDB()
+	if err != nil {
+		ss.wm.Log.Errorf("open db failed: %v", err)
+		return
+	}
+
+	var trackedArray []*TrackedTransaction
+	err = db.Select(q.Eq("Status", TrackStatusPending)).Find(&trackedArray)
+	if err != nil && err != storm.ErrNotFound {
+		ss.wm.Log.Errorf("load tracked transactions failed: %v", err)
+		return
+	}
+
+	sort.SliceStable(trackedArray, func(i, j int) bool {
+		if trackedArray[i].Address != trackedArray[j].Address {
+			return trackedArray[i].Address < trackedArray[j].Address
+		}
+		return trackedArray[i].Nonce < trackedArray[j].Nonce
+	})
+
+	now := time.Now().Unix()
+	for _, tracked := range trackedArray {
+		if !isStuckTransaction(tracked, now, int64(ss.wm.Config.RebroadcastAfter)) {
+			continue
+		}
+		ss.handle(tracked)
+	}
+}
+
+//handle 重新广播或替换卡住的交易单
+func (ss *StuckTxService) handle(tracked *TrackedTransaction) {
+
+	if ss.wm.Config.ReplaceStuckTx && tracked.RebroadcastCount >= ss.wm.Config.MaxRebroadcast {
+		ss.replace(tracked)
+		return
+	}
+
+	_, actionErr := ss.wm.BroadcastTransaction(tracked.RawHex)
+
+	updated, err := ss.wm.TxTracker.modify(tracked.TxID, func(t *TrackedTransaction) bool {
+		if t.Status != TrackStatusPending {
+			return false
+		}
+		t.RebroadcastCount++
+		t.LastActionTime = time.Now().Unix()
+		return true
+	})
+	if err != nil {
+		ss.wm.Log.Errorf("update tracked transaction %s failed: %v", tracked.TxID, err)
+		return
+	}
+
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+
+	ss.wm.Log.Infof("rebroadcast stuck transaction %s, error: %v", tracked.TxID, actionErr)
+	for o := range ss.observers {
+		o.TxRebroadcast(updated, actionErr)
+	}
+}
+
+//replace 创建替换交易单，先在跟踪记录中标记，已有等待广播的替换交易单时不再创建，创建失败时取消标记
+func (ss *StuckTxService) replace(tracked *TrackedTransaction) {
+
+	claimed := false
+	_, err := ss.wm.TxTracker.modify(tracked.TxID, func(t *TrackedTransaction) bool {
+		if t.Status != TrackStatusPending || t.Replacing {
+			return false
+		}
+		t.Replacing = true
+		t.LastActionTime = time.Now().Unix()
+		claimed = true
+		return true
+	})
+	if err != nil {
+		ss.wm.Log.Errorf("update tracked transaction %s failed: %v", tracked.TxID, err)
+		return
+	}
+	if !claimed {
+		return
+	}
+
+	rawTx, actionErr := ss.wm.TxDecoder.(*TransactionDecoder).CreateReplacementRawTransaction(ss.WalletDAI, tracked)
+	if actionErr != nil {
+		if cancelErr := ss.CancelReplacement(tracked.TxID); cancelErr != nil {
+			ss.wm.Log.Errorf("update tracked transaction %s failed: %v", tracked.TxID, cancelErr)
+		}
+	}
+
+	updated, err := ss.wm.TxTracker.GetTrackedTransaction(tracked.TxID)
+	if err != nil {
+		ss.wm.Log.Errorf("load tracked transaction %s failed: %v", tracked.TxID, err)
+		return
+	}
+
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+
+	ss.wm.Log.Infof("create replacement of stuck transaction %s, error: %v", tracked.TxID, actionErr)
+	for o := range ss.observers {
+		o.TxReplacement(updated, rawTx, actionErr)
+	}
+}
+
+//CancelReplacement 放弃已创建的替换交易单，下次检查时可以重新创建，替换交易单广播失败时自动调用
+func (ss *StuckTxService) CancelReplacement(txid string) error {
+	_, err := ss.wm.TxTracker.modify(txid, func(t *TrackedTransaction) bool {
+		if !t.Replacing {
+			return false
+		}
+		t.Replacing = false
+		return true
+	})
+	return err
+}
+
+//txFeeFieldIndex 交易单RLP字段中手续费和燃料价格的位置，普通转账没有燃料价格，位置为-1
+func txFeeFieldIndex(tag uint64) (feeIndex, gasIndex, gasPriceIndex int, err error) {
+	switch uint(tag) {
+	case aeternity.ObjectTagSpendTransaction:
+		return 5, -1, -1, nil
+	case aeternity.ObjectTagContractCallTransaction:
+		return 6, 9, 10, nil
+	default:
+		return 0, 0, 0, fmt.Errorf("transaction of object tag %d can not be replaced", tag)
+	}
+}
+
+//scaleBigInt 数值乘以倍数，向上取整
+func scaleBigInt(value *big.Int, scale decimal.Decimal) *big.Int {
+	scaled, _ := new(big.Int).SetString(decimal.NewFromBigInt(value, 0).Mul(scale).Ceil().String(), 10)
+	return scaled
+}
+
+//replaceTxFee 取出已签名交易单中的交易单，手续费乘以scale，合约调用的燃料价格也乘以scale，
+//返回未签名的新交易单，以及原交易单和新交易单的手续费
+func replaceTxFee(signedTx []byte, scale decimal.Decimal) ([]byte, *txFeeInfo, *txFeeInfo, error) {
+
+	var signed []interface{}
+	if err := rlp.DecodeBytes(signedTx, &signed); err != nil {
+		return nil, nil, nil, err
+	}
+	if len(signed) != 4 || new(big.Int).SetBytes(signed[0].([]byte)).Uint64() != uint64(aeternity.ObjectTagSignedTransaction) {
+		return nil, nil, nil, fmt.Errorf("transaction is not signed")
+	}
+	txRaw, ok := signed[3].([]byte)
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("signed transaction is invalid")
+	}
+
+	var fields []interface{}
+	if err := rlp.DecodeBytes(txRaw, &fields); err != nil {
+		return nil, nil, nil, err
+	}
+	if len(fields) == 0 {
+		return nil, nil, nil, fmt.Errorf("transaction is invalid")
+	}
+	tag, ok := fields[0].([]byte)
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("transaction is invalid")
+	}
+	feeIndex, gasIndex, gasPriceIndex, err := txFeeFieldIndex(new(big.Int).SetBytes(tag).Uint64())
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	//读取数值字段
+	bigField := func(index int) (*big.Int, error) {
+		if index < 0 {
+			return big.NewInt(0), nil
+		}
+		if index >= len(fields) {
+			return nil, fmt.Errorf("transaction is invalid")
+		}
+		value, ok := fields[index].([]byte)
+		if !ok {
+			return nil, fmt.Errorf("transaction fee is invalid")
+		}
+		return new(big.Int).SetBytes(value), nil
+	}
+
+	oldFee, err := bigField(feeIndex)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	gas, err := bigField(gasIndex)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	oldGasPrice, err := bigField(gasPriceIndex)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	//手续费 = fee + 燃料上限 * 燃料价格，和创建交易单时的计算一致
+	oldFeeInfo := &txFeeInfo{GasUsed: gas, GasPrice: oldGasPrice, TxFee: oldFee}
+	oldFeeInfo.CalcFee()
+	newFeeInfo := &txFeeInfo{GasUsed: gas, GasPrice: oldGasPrice, TxFee: scaleBigInt(oldFee, scale)}
+	fields[feeIndex] = newFeeInfo.TxFee
+	if gasPriceIndex >= 0 {
+		newFeeInfo.GasPrice = scaleBigInt(oldGasPrice, scale)
+		fields[gasPriceIndex] = newFeeInfo.GasPrice
+	}
+	newFeeInfo.CalcFee()
+
+	newRaw, err := rlp.EncodeToBytes(fields)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return newRaw, oldFeeInfo, newFeeInfo, nil
+}
+
+//CreateReplacementRawTransaction 为卡住的交易单创建相同nonce、更高手续费的替换交易单，
+//手续费 = 原手续费 * ReplaceFeeScale，合约调用的燃料价格也按倍数提高。
+//替换交易单未签名，需要按正常流程签名、验证和广播
+func (decoder *TransactionDecoder) CreateReplacementRawTransaction(wrapper openwallet.WalletDAI, tracked *TrackedTransaction) (*openwallet.RawTransaction, error) {
+
+	if wrapper == nil {
+		return nil, fmt.Errorf("wallet DAI is not set")
+	}
+
+	if tracked.IsTerminal() {
+		return nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "transaction [%s] is %s", tracked.TxID, tracked.Status)
+	}
+
+	if len(tracked.TxTo) == 0 {
+		return nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "transaction [%s] has no receiver", tracked.TxID)
+	}
+
+	signedTx, err := DecodeRawTx(tracked.RawHex)
+	if err != nil {
+		return nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "transaction [%s] is invalid", tracked.TxID)
+	}
+
+	txRaw, oldFeeInfo, newFeeInfo, err := replaceTxFee(signedTx, decoder.wm.Config.GetReplaceFeeScale())
+	if err != nil {
+		return nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "%v", err)
+	}
+	if oldFeeInfo.TxFee.Sign() <= 0 {
+		return nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "fee of transaction [%s] is paid by fee payer", tracked.TxID)
+	}
+
+	account, err := wrapper.GetAssetsAccountInfo(tracked.AccountID)
+	if err != nil {
+		return nil, openwallet.Errorf(openwallet.ErrAccountNotFound, "account [%s] is not found", tracked.AccountID)
+	}
+
+	addr, err := wrapper.GetAddress(tracked.Address)
+	if err != nil {
+		return nil, openwallet.Errorf(openwallet.ErrAddressNotFound, "address [%s] is not found: %v", tracked.Address, err)
+	}
+
+	decimals := decoder.wm.Decimal()
+	feesAmount := common.BigIntToDecimals(newFeeInfo.Fee, decimals)
+
+	//AE转账的实际转账数量包含手续费，代币转账不包含
+	txAmount := tracked.TxAmount
+	if !tracked.Coin.IsContract {
+		amount, _ := decimal.NewFromString(tracked.TxAmount)
+		feeDiff := common.BigIntToDecimals(new(big.Int).Sub(newFeeInfo.Fee, oldFeeInfo.Fee), decimals)
+		txAmount = amount.Sub(feeDiff).StringFixed(decimals)
+	}
+
+	to := strings.Split(tracked.TxTo[0], ":")
+	rawTx := &openwallet.RawTransaction{
+		Coin:     tracked.Coin,
+		Account:  account,
+		To:       map[string]string{to[0]: to[len(to)-1]},
+		Required: 1,
+		RawHex:   encodeRawTx(txRaw, decoder.wm.Config.ExportBase64Tx),
+		FeeRate:  common.BigIntToDecimals(newFeeInfo.TxFee, decimals).String(),
+		Fees:     feesAmount.String(),
+		TxAmount: txAmount,
+		TxFrom:   tracked.TxFrom,
+		TxTo:     tracked.TxTo,
+		IsBuilt:  true,
+		Signatures: map[string][]*openwallet.KeySignature{
+			tracked.AccountID: {
+				{
+					EccType: decoder.wm.Config.CurveType,
+					Address: addr,
+					Message: hex.EncodeToString(append([]byte(decoder.wm.Config.NetworkID), txRaw...)),
+				},
+			},
+		},
+	}
+	rawTx.SetExtParam("nonce", tracked.Nonce)
+	rawTx.SetExtParam("ttl", tracked.TTL)
+	rawTx.SetExtParam("replaces", tracked.TxID)
+	if tracked.Coin.IsContract {
+		rawTx.SetExtParam("gasPrice", common.BigIntToDecimals(newFeeInfo.GasPrice, decimals).String())
+	}
+	if len(tracked.Memo) > 0 {
+		rawTx.SetExtParam("memo", tracked.Memo)
+	}
+
+	return rawTx, nil
+}
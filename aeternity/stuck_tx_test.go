@@ -0,0 +1,251 @@
+package aeternity
+
+import (
+	"encoding/hex"
+	"github.com/aeternity/aepp-sdk-go/aeternity"
+	"github.com/blocktree/openwallet/hdkeystore"
+	"github.com/blocktree/openwallet/openwallet"
+	"github.com/shopspring/decimal"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+)
+
+func TestIsStuckTransaction(t *testing.T) {
+
+	tracked := &TrackedTransaction{Status: TrackStatusPending, SubmitTime: 1000}
+	if isStuckTransaction(tracked, 1100, 180) {
+		t.Errorf("transaction should not be stuck before timeout")
+	}
+	if !isStuckTransaction(tracked, 1180, 180) {
+		t.Errorf("transaction should be stuck after timeout")
+	}
+
+	//重新广播后重新计时
+	tracked.LastActionTime = 1180
+	if isStuckTransaction(tracked, 1200, 180) {
+		t.Errorf("transaction should not be stuck after rebroadcast")
+	}
+
+	tracked.Status = TrackStatusMined
+	if isStuckTransaction(tracked, 2000, 180) {
+		t.Errorf("mined transaction should not be stuck")
+	}
+}
+
+func TestReplaceTxFee(t *testing.T) {
+
+	sender := "ak_qcqXt6ySgRPvBkNwEpNMvaKWzrhPZsoBHLvgg68qg9vRht62y"
+
+	spendTx := aeternity.NewSpendTx(sender, sender, *big.NewInt(1000), *big.NewInt(20000000000000), "memo", 500, 7)
+	txRaw, _ := spendTx.RLP()
+	signedTx, err := createSignedTransaction(txRaw, [][]byte{make([]byte, signatureLength)})
+	if err != nil {
+		t.Errorf("createSignedTransaction error: %v", err)
+		return
+	}
+
+	newRaw, oldFee, newFee, err := replaceTxFee(signedTx, decimal.NewFromFloat(1.5))
+	if err != nil {
+		t.Errorf("replaceTxFee error: %v", err)
+		return
+	}
+	if oldFee.Fee.String() != "20000000000000" || newFee.Fee.String() != "30000000000000" {
+		t.Errorf("replaceTxFee fee = %s -> %s", oldFee.Fee.String(), newFee.Fee.String())
+	}
+
+	spendTx.Fee = *big.NewInt(30000000000000)
+	wantRaw, _ := spendTx.RLP()
+	if hex.EncodeToString(newRaw) != hex.EncodeToString(wantRaw) {
+		t.Errorf("replaceTxFee = %x, want %x", newRaw, wantRaw)
+	}
+
+	//未签名的交易单不能替换
+	if _, _, _, err := replaceTxFee(txRaw, decimal.NewFromFloat(1.5)); err == nil {
+		t.Errorf("replaceTxFee of unsigned transaction should fail")
+	}
+}
+
+//testReplaceWrapper 离线测试用的钱包，提供账户、地址和签名密钥
+type testReplaceWrapper struct {
+	openwallet.WalletDAIBase
+	key     *hdkeystore.HDKey
+	account *openwallet.AssetsAccount
+	address *openwallet.Address
+}
+
+func (w *testReplaceWrapper) GetAssetsAccountInfo(accountID string) (*openwallet.AssetsAccount, error) {
+	return w.account, nil
+}
+
+func (w *testReplaceWrapper) GetAddress(address string) (*openwallet.Address, error) {
+	return w.address, nil
+}
+
+func (w *testReplaceWrapper) HDKey(password ...string) (*hdkeystore.HDKey, error) {
+	return w.key, nil
+}
+
+func TestCreateReplacementRawTransaction_Token(t *testing.T) {
+
+	wm := NewWalletManager()
+	decoder := NewTransactionDecoder(wm)
+
+	key, err := hdkeystore.NewHDKey(make([]byte, 32), "test", "m/44'/457'")
+	if err != nil {
+		t.Fatalf("NewHDKey error: %v", err)
+	}
+	hdPath := "m/44'/457'/0'/0'/0'"
+	childKey, err := key.DerivedKeyWithPath(hdPath, wm.Config.CurveType)
+	if err != nil {
+		t.Fatalf("DerivedKeyWithPath error: %v", err)
+	}
+	publicKey := childKey.GetPublicKeyBytes()
+	sender, _ := wm.Decoder.PublicKeyToAddress(publicKey, false)
+
+	wrapper := &testReplaceWrapper{
+		key:     key,
+		account: &openwallet.AssetsAccount{WalletID: "W1", AccountID: "sender"},
+		address: &openwallet.Address{AccountID: "sender", Address: sender, PublicKey: hex.EncodeToString(publicKey), HDPath: hdPath},
+	}
+
+	contract := "ct_2U1usf3A8ZNUcZLkZe5rEoBTxk7eJvk9fcbRDNqmRiwXCHAYN"
+	recipient := "ak_2iBPH7HUz3cSDVEUWiHg76MZJ6tZooVNBmmxcgVK6VV8KAE688"
+	callData, err := aex9ACI.EncodeCall("transfer", recipient, big.NewInt(1000000000000000000))
+	if err != nil {
+		t.Fatalf("EncodeCall error: %v", err)
+	}
+	callTx := aeternity.NewContractCallTx(sender, 7, contract, *big.NewInt(0), *big.NewInt(50000), *big.NewInt(1000000000),
+		fateABIVersion, callData, *big.NewInt(200000000000000), 500)
+	txRaw, _ := callTx.RLP()
+	signedTx, _ := createSignedTransaction(txRaw, [][]byte{make([]byte, signatureLength)})
+
+	tracked := &TrackedTransaction{
+		TxID:      CalcTxHash(signedTx),
+		Nonce:     7,
+		TTL:       500,
+		RawHex:    encodeRawTx(signedTx, false),
+		AccountID: "sender",
+		Address:   sender,
+		Status:    TrackStatusPending,
+		Coin: openwallet.Coin{
+			Symbol:     wm.Symbol(),
+			IsContract: true,
+			Contract:   openwallet.SmartContract{Address: contract, Decimals: 18},
+		},
+		TxFrom:   []string{sender + ":1"},
+		TxTo:     []string{recipient + ":1"},
+		TxAmount: "-1",
+	}
+
+	rawTx, err := decoder.CreateReplacementRawTransaction(wrapper, tracked)
+	if err != nil {
+		t.Fatalf("CreateReplacementRawTransaction error: %v", err)
+	}
+
+	//fee和燃料价格都提高1.5倍，手续费 = 燃料上限 * 燃料价格 + fee
+	if rawTx.FeeRate != "0.0003" || rawTx.GetExtParam().Get("gasPrice").String() != "0.0000000015" {
+		t.Errorf("replacement fee rate = %s, gas price = %s", rawTx.FeeRate, rawTx.GetExtParam().Get("gasPrice").String())
+	}
+	if rawTx.Fees != "0.000375" {
+		t.Errorf("replacement fees = %s", rawTx.Fees)
+	}
+
+	if err := decoder.SignRawTransaction(wrapper, rawTx); err != nil {
+		t.Fatalf("SignRawTransaction error: %v", err)
+	}
+	if err := decoder.VerifyRawTransaction(wrapper, rawTx); err != nil {
+		t.Fatalf("VerifyRawTransaction error: %v", err)
+	}
+	if !rawTx.IsCompleted {
+		t.Errorf("replacement is not completed")
+	}
+}
+
+//testStuckObserver 记录创建的替换交易单
+type testStuckObserver struct {
+	replacements []*openwallet.RawTransaction
+}
+
+func (o *testStuckObserver) TxRebroadcast(tx *TrackedTransaction, err error) {
+}
+
+func (o *testStuckObserver) TxReplacement(tx *TrackedTransaction, rawTx *openwallet.RawTransaction, err error) {
+	if err == nil {
+		o.replacements = append(o.replacements, rawTx)
+	}
+}
+
+func TestStuckTxService_ReplaceOnce(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "stuck")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	wm := NewWalletManager()
+	wm.Config.dbPath = dir
+	wm.Config.ReplaceStuckTx = true
+	wm.Config.MaxRebroadcast = 0
+	ss := wm.StuckTxService
+
+	//开启替换但没有设置WalletDAI时不能启动
+	if err := ss.Run(); err == nil {
+		ss.Stop()
+		t.Errorf("Run without wallet DAI should fail")
+	}
+
+	sender := "ak_qcqXt6ySgRPvBkNwEpNMvaKWzrhPZsoBHLvgg68qg9vRht62y"
+	recipient := "ak_2iBPH7HUz3cSDVEUWiHg76MZJ6tZooVNBmmxcgVK6VV8KAE688"
+	ss.WalletDAI = &testReplaceWrapper{
+		account: &openwallet.AssetsAccount{WalletID: "W1", AccountID: "sender"},
+		address: &openwallet.Address{AccountID: "sender", Address: sender},
+	}
+	observer := &testStuckObserver{}
+	ss.AddObserver(observer)
+
+	spendTx := aeternity.NewSpendTx(sender, recipient, *big.NewInt(1000), *big.NewInt(20000000000000), "", 500, 7)
+	txRaw, _ := spendTx.RLP()
+	signedTx, _ := createSignedTransaction(txRaw, [][]byte{make([]byte, signatureLength)})
+	tracked := &TrackedTransaction{
+		TxID:      CalcTxHash(signedTx),
+		Nonce:     7,
+		TTL:       500,
+		RawHex:    encodeRawTx(signedTx, false),
+		AccountID: "sender",
+		Address:   sender,
+		Status:    TrackStatusPending,
+		Coin:      openwallet.Coin{Symbol: "AE"},
+		TxFrom:    []string{sender + ":0.00000000000000102"},
+		TxTo:      []string{recipient + ":0.000000000000001"},
+		TxAmount:  "-0.00002000000000100",
+	}
+	db, err := wm.openDB()
+	if err != nil {
+		t.Fatalf("openDB error: %v", err)
+	}
+	if err := db.Save(tracked); err != nil {
+		t.Fatalf("Save error: %v", err)
+	}
+
+	//替换交易单等待签名和广播时不再创建新的替换交易单
+	ss.handle(tracked)
+	ss.handle(tracked)
+	if len(observer.replacements) != 1 {
+		t.Fatalf("replacements = %d, want 1", len(observer.replacements))
+	}
+	if updated, _ := wm.TxTracker.GetTrackedTransaction(tracked.TxID); updated == nil || !updated.Replacing {
+		t.Errorf("tracked transaction should be replacing")
+	}
+
+	//放弃替换交易单后可以重新创建
+	if err := ss.CancelReplacement(tracked.TxID); err != nil {
+		t.Fatalf("CancelReplacement error: %v", err)
+	}
+	ss.handle(tracked)
+	if len(observer.replacements) != 2 {
+		t.Errorf("replacements = %d, want 2", len(observer.replacements))
+	}
+}
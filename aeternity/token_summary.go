@@ -0,0 +1,189 @@
+package aeternity
+
+import (
+	"fmt"
+	"github.com/blocktree/openwallet/common"
+	"github.com/blocktree/openwallet/openwallet"
+	"github.com/shopspring/decimal"
+	"math/big"
+)
+
+//CreateTokenSummaryRawTransaction 创建AEX-9代币汇总交易，地址的AE余额不足支付燃料费时，
+//由手续费支持账户(FeesSupportAccount)先转入手续费，下一次汇总时再汇总该地址的代币
+//返回的交易单包含手续费补充交易单，单个地址失败时记录在对应交易单的Error中
+func (decoder *TransactionDecoder) CreateTokenSummaryRawTransaction(wrapper openwallet.WalletDAI, sumRawTx *openwallet.SummaryRawTransaction) ([]*openwallet.RawTransactionWithError, error) {
+
+	var (
+		rawTxArray = make([]*openwallet.RawTransactionWithError, 0)
+		accountID  = sumRawTx.Account.AccountID
+	)
+
+	tokenDecimals, err := decoder.wm.ContractDecoder.GetTokenDecimals(sumRawTx.Coin.Contract)
+	if err != nil {
+		return nil, err
+	}
+
+	minTransfer := common.StringNumToBigIntWithExp(sumRawTx.MinTransfer, tokenDecimals)
+	retainedBalance := common.StringNumToBigIntWithExp(sumRawTx.RetainedBalance, tokenDecimals)
+
+	if minTransfer.Cmp(retainedBalance) < 0 {
+		return nil, fmt.Errorf("mini transfer amount must be greater than address retained balance")
+	}
+
+	//获取wallet
+	addresses, err := wrapper.GetAddressList(sumRawTx.AddressStartIndex, sumRawTx.AddressLimit,
+		"AccountID", accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("[%s] have not addresses", accountID)
+	}
+
+	searchAddrs := make([]string, 0)
+	for _, address := range addresses {
+		searchAddrs = append(searchAddrs, address.Address)
+	}
+
+	tokenBalanceArray, err := decoder.wm.ContractDecoder.GetTokenBalanceByAddress(sumRawTx.Coin.Contract, searchAddrs...)
+	if err != nil {
+		return nil, err
+	}
+
+	addrBalanceArray, err := decoder.wm.Blockscanner.GetBalanceByAddress(searchAddrs...)
+	if err != nil {
+		return nil, err
+	}
+
+	addrBalanceMap := make(map[string]*big.Int)
+	for _, addrBalance := range addrBalanceArray {
+		addrBalanceMap[addrBalance.Address] = common.StringNumToBigIntWithExp(addrBalance.Balance, decoder.wm.Decimal())
+	}
+
+	//ExtParam的feePayer为代付手续费的账户，代付时不需要补充手续费
+	feePayer := sumRawTx.GetExtParam().Get("feePayer").String()
+
+	for _, tokenBalance := range tokenBalanceArray {
+
+		address := tokenBalance.Balance.Address
+
+		//检查余额是否超过最低转账
+		tokenBalance_BI := common.StringNumToBigIntWithExp(tokenBalance.Balance.Balance, tokenDecimals)
+		if tokenBalance_BI.Cmp(minTransfer) < 0 || tokenBalance_BI.Sign() <= 0 {
+			continue
+		}
+
+		//计算汇总数量 = 余额 - 保留余额
+		sumAmount_BI := new(big.Int).Sub(tokenBalance_BI, retainedBalance)
+		if sumAmount_BI.Sign() <= 0 {
+			continue
+		}
+
+		sumAmount := common.BigIntToDecimals(sumAmount_BI, tokenDecimals)
+
+		//创建一笔交易单
+		rawTx := &openwallet.RawTransaction{
+			Coin:    sumRawTx.Coin,
+			Account: sumRawTx.Account,
+			To: map[string]string{
+				sumRawTx.SummaryAddress: sumAmount.StringFixed(tokenDecimals),
+			},
+			Required: 1,
+		}
+		if len(feePayer) > 0 {
+			rawTx.SetExtParam("feePayer", feePayer)
+		}
+
+		feeInfo, feeErr := decoder.GetTokenTransferFeeInfo(sumRawTx.Coin.Contract.Address, sumRawTx.SummaryAddress, sumAmount_BI, sumRawTx.FeeRate, sumRawTx.GetExtParam().Get("gasPrice").String())
+		if feeErr != nil {
+			rawTxArray = append(rawTxArray, &openwallet.RawTransactionWithError{
+				RawTx: rawTx,
+				Error: openwallet.ConvertError(feeErr),
+			})
+			continue
+		}
+
+		addrBalance_BI, ok := addrBalanceMap[address]
+		if !ok {
+			addrBalance_BI = big.NewInt(0)
+		}
+
+		decoder.wm.Log.Debugf("token balance: %v", tokenBalance.Balance.Balance)
+		decoder.wm.Log.Debugf("fees: %v", common.BigIntToDecimals(feeInfo.Fee, decoder.wm.Decimal()))
+		decoder.wm.Log.Debugf("sumAmount: %v", sumAmount)
+
+		//AE余额不足支付燃料费，创建手续费补充交易单
+		if len(feePayer) == 0 && addrBalance_BI.Cmp(feeInfo.Fee) < 0 {
+			if sumRawTx.FeesSupportAccount == nil {
+				feesAmount := common.BigIntToDecimals(feeInfo.Fee, decoder.wm.Decimal())
+				rawTxArray = append(rawTxArray, &openwallet.RawTransactionWithError{
+					RawTx: rawTx,
+					Error: openwallet.Errorf(openwallet.ErrInsufficientFees, "address [%s] does not have enough %s [%s] for fees", address, decoder.wm.Symbol(), feesAmount.String()),
+				})
+				continue
+			}
+			supportRawTx, supportErr := decoder.createFeesSupportRawTransaction(wrapper, sumRawTx, address, feeInfo.Fee)
+			rawTxArray = append(rawTxArray, &openwallet.RawTransactionWithError{
+				RawTx: supportRawTx,
+				Error: openwallet.ConvertError(supportErr),
+			})
+			continue
+		}
+
+		createErr := decoder.createRawTransaction(
+			wrapper,
+			rawTx,
+			&AddrBalance{Address: address, Balance: addrBalance_BI, TokenBalance: tokenBalance_BI},
+			feeInfo,
+			"",
+			nil)
+		rawTxArray = append(rawTxArray, &openwallet.RawTransactionWithError{
+			RawTx: rawTx,
+			Error: openwallet.ConvertError(createErr),
+		})
+	}
+
+	return rawTxArray, nil
+}
+
+//createFeesSupportRawTransaction 由手续费支持账户向地址转入手续费，
+//转入数量为FixSupportAmount，没有设置时为手续费乘以FeesSupportScale
+func (decoder *TransactionDecoder) createFeesSupportRawTransaction(wrapper openwallet.WalletDAI, sumRawTx *openwallet.SummaryRawTransaction, address string, fee *big.Int) (*openwallet.RawTransaction, error) {
+
+	feesSupport := sumRawTx.FeesSupportAccount
+
+	supportAmount := common.BigIntToDecimals(fee, decoder.wm.Decimal())
+	fixSupportAmount, _ := decimal.NewFromString(feesSupport.FixSupportAmount)
+	if fixSupportAmount.GreaterThan(decimal.Zero) {
+		supportAmount = fixSupportAmount
+	} else if scale, scaleErr := decimal.NewFromString(feesSupport.FeesSupportScale); scaleErr == nil && scale.GreaterThan(decimal.Zero) {
+		supportAmount = supportAmount.Mul(scale)
+	}
+
+	supportRawTx := &openwallet.RawTransaction{
+		Coin: openwallet.Coin{
+			Symbol:     sumRawTx.Coin.Symbol,
+			IsContract: false,
+		},
+		To: map[string]string{
+			address: supportAmount.StringFixed(decoder.wm.Decimal()),
+		},
+		Required: 1,
+	}
+
+	supportAccount, err := wrapper.GetAssetsAccountInfo(feesSupport.AccountID)
+	if err != nil {
+		return supportRawTx, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "fees support account [%s] is not found", feesSupport.AccountID)
+	}
+	supportRawTx.Account = supportAccount
+
+	decoder.wm.Log.Debugf("fees support: %s -> %s", supportAmount.String(), address)
+
+	err = decoder.CreateAERawTransaction(wrapper, supportRawTx)
+	if err != nil {
+		return supportRawTx, err
+	}
+
+	return supportRawTx, nil
+}
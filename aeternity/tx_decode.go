@@ -10,14 +10,19 @@ import (
 	"github.com/blocktree/openwallet/log"
 	"github.com/blocktree/openwallet/openwallet"
 	"github.com/shopspring/decimal"
+	"math"
 	"math/big"
 	"sort"
+	"strings"
+	"sync"
 	"time"
 )
 
 type TransactionDecoder struct {
 	openwallet.TransactionDecoderBase
-	wm *WalletManager //钱包管理者
+	wm            *WalletManager //钱包管理者
+	feeSuggestion *FeeSuggestion //最近一次按交易池计算的手续费建议
+	feeMu         sync.Mutex
 }
 
 //NewTransactionDecoder 交易单解析器
@@ -29,13 +34,26 @@ func NewTransactionDecoder(wm *WalletManager) *TransactionDecoder {
 
 //CreateRawTransaction 创建交易单
 func (decoder *TransactionDecoder) CreateRawTransaction(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction) error {
+	//一笔交易单只能有一个接收地址，多个接收地址使用CreateBatchRawTransaction
+	if len(rawTx.To) > 1 {
+		return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "only one receiver address is supported, use batch transfer for multiple receivers")
+	}
+	if rawTx.Coin.IsContract {
+		return decoder.CreateTokenRawTransaction(wrapper, rawTx)
+	} else {
+		return decoder.CreateAERawTransaction(wrapper, rawTx)
+	}
+}
+
+//CreateAERawTransaction 创建AE交易单
+func (decoder *TransactionDecoder) CreateAERawTransaction(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction) error {
 
 	var (
 		decimals        = decoder.wm.Decimal()
 		accountID       = rawTx.Account.AccountID
-		fixFees         = big.NewInt(0)
 		findAddrBalance *AddrBalance
-		feeInfo         *txFeeInfo
+		destination     string
+		amountStr       string
 	)
 
 	//获取wallet
@@ -58,8 +76,8 @@ func (decoder *TransactionDecoder) CreateRawTransaction(wrapper openwallet.Walle
 		return err
 	}
 
-	var amountStr string
-	for _, v := range rawTx.To {
+	for k, v := range rawTx.To {
+		destination = k
 		amountStr = v
 		break
 	}
@@ -77,17 +95,22 @@ func (decoder *TransactionDecoder) CreateRawTransaction(wrapper openwallet.Walle
 
 	amount := common.StringNumToBigIntWithExp(amountStr, decimals)
 
-	if len(rawTx.FeeRate) > 0 {
-		fixFees = common.StringNumToBigIntWithExp(rawTx.FeeRate, decimals)
-	} else {
-		fixFees = common.StringNumToBigIntWithExp(decoder.wm.Config.FixFees, decimals)
+	//转账备注作为SpendTx的payload
+	payload, err := ParseMemo(rawTx.GetExtParam().Get("memo").String())
+	if err != nil {
+		return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "%v", err)
 	}
 
-	//计算手续费
-	feeInfo = &txFeeInfo{
-		Fee: fixFees,
-		GasPrice: fixFees,
-		GasUsed: big.NewInt(1),
+	//计算手续费，payload按字节数增加手续费
+	feeInfo, err := decoder.GetSpendFeeInfo(destination, amount, payload, rawTx.FeeRate)
+	if err != nil {
+		return err
+	}
+
+	//手续费由代付账户支付
+	feePayer := rawTx.GetExtParam().Get("feePayer").String()
+	if len(feePayer) > 0 {
+		feeInfo = sponsoredFeeInfo()
 	}
 
 	for _, addrBalance := range addrBalanceArray {
@@ -109,6 +132,19 @@ func (decoder *TransactionDecoder) CreateRawTransaction(wrapper openwallet.Walle
 	}
 
 	if findAddrBalance == nil {
+		//多个地址合计余额足够时，提示调用方创建多地址付款计划
+		fundings := make([]*AddrBalance, 0, len(addrBalanceArray))
+		for _, addrBalance := range addrBalanceArray {
+			fundings = append(fundings, &AddrBalance{
+				Address: addrBalance.Address,
+				Balance: common.StringNumToBigIntWithExp(addrBalance.Balance, decimals),
+			})
+		}
+		if len(feePayer) == 0 && canFundByPlan(fundings, destination, amount, feeInfo.Fee) {
+			return openwallet.Errorf(openwallet.ErrInsufficientBalanceOfAccount,
+				"no single address's balance is enough, but the account's total balance is enough, create a funding plan with mode %s or %s instead",
+				FundingModeConsolidate, FundingModeSplit)
+		}
 		return openwallet.Errorf(openwallet.ErrInsufficientBalanceOfAccount,"all address's balance of account is not enough")
 	}
 
@@ -118,13 +154,225 @@ func (decoder *TransactionDecoder) CreateRawTransaction(wrapper openwallet.Walle
 		rawTx,
 		findAddrBalance,
 		feeInfo,
-		"")
+		string(payload),
+		nil)
+	if err != nil {
+		return err
+	}
+
+	return nil
+
+}
+
+//CreateTokenRawTransaction 创建AEX-9代币交易单，构建调用合约transfer(recipient, value)的ContractCallTx
+func (decoder *TransactionDecoder) CreateTokenRawTransaction(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction) error {
+
+	var (
+		accountID       = rawTx.Account.AccountID
+		findAddrBalance *AddrBalance
+		amountStr       string
+		destination     string
+	)
+
+	//ContractCallTx没有payload字段，不能附带转账备注
+	if len(rawTx.GetExtParam().Get("memo").String()) > 0 {
+		return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "memo is not supported by token transfer")
+	}
+
+	tokenDecimals, err := decoder.wm.ContractDecoder.GetTokenDecimals(rawTx.Coin.Contract)
+	if err != nil {
+		return err
+	}
+
+	//获取wallet
+	addresses, err := wrapper.GetAddressList(0, -1, "AccountID", accountID)
+	if err != nil {
+		return err
+	}
+
+	if len(addresses) == 0 {
+		return openwallet.Errorf(openwallet.ErrAccountNotAddress, "[%s] have not addresses", accountID)
+	}
+
+	searchAddrs := make([]string, 0)
+	for _, address := range addresses {
+		searchAddrs = append(searchAddrs, address.Address)
+	}
+
+	for k, v := range rawTx.To {
+		destination = k
+		amountStr = v
+		break
+	}
+
+	amount := common.StringNumToBigIntWithExp(amountStr, tokenDecimals)
+	feePayer := rawTx.GetExtParam().Get("feePayer").String()
+
+	//计算手续费
+	feeInfo, err := decoder.GetTokenTransferFeeInfo(rawTx.Coin.Contract.Address, destination, amount, rawTx.FeeRate, rawTx.GetExtParam().Get("gasPrice").String())
+	if err != nil {
+		return err
+	}
+
+	tokenBalanceArray, err := decoder.wm.ContractDecoder.GetTokenBalanceByAddress(rawTx.Coin.Contract, searchAddrs...)
+	if err != nil {
+		return err
+	}
+
+	addrBalanceArray, err := decoder.wm.Blockscanner.GetBalanceByAddress(searchAddrs...)
+	if err != nil {
+		return err
+	}
+
+	addrBalanceMap := make(map[string]*big.Int)
+	for _, addrBalance := range addrBalanceArray {
+		addrBalanceMap[addrBalance.Address] = common.StringNumToBigIntWithExp(addrBalance.Balance, decoder.wm.Decimal())
+	}
+
+	findTokenBalance := false
+	for _, tokenBalance := range tokenBalanceArray {
+
+		tokenBalance_BI := common.StringNumToBigIntWithExp(tokenBalance.Balance.Balance, tokenDecimals)
+
+		//代币余额不足查找下一个地址
+		if tokenBalance_BI.Cmp(amount) < 0 {
+			continue
+		}
+
+		findTokenBalance = true
+
+		//AE余额不足支付燃料费查找下一个地址，代付时不需要AE余额
+		addrBalance_BI, ok := addrBalanceMap[tokenBalance.Balance.Address]
+		if !ok {
+			addrBalance_BI = big.NewInt(0)
+		}
+		if len(feePayer) == 0 && addrBalance_BI.Cmp(feeInfo.Fee) < 0 {
+			continue
+		}
+
+		//只要找到一个合适使用的地址余额就停止遍历
+		findAddrBalance = &AddrBalance{
+			Address:      tokenBalance.Balance.Address,
+			Balance:      addrBalance_BI,
+			TokenBalance: tokenBalance_BI,
+		}
+		break
+	}
+
+	if !findTokenBalance {
+		return openwallet.Errorf(openwallet.ErrInsufficientTokenBalanceOfAddress, "all address's token balance of account is not enough")
+	}
+
+	if findAddrBalance == nil {
+		feesAmount := common.BigIntToDecimals(feeInfo.Fee, decoder.wm.Decimal())
+		return openwallet.Errorf(openwallet.ErrInsufficientFees, "the address which has enough token balance does not have enough %s [%s] for fees", decoder.wm.Symbol(), feesAmount.String())
+	}
+
+	//最后创建交易单
+	err = decoder.createRawTransaction(
+		wrapper,
+		rawTx,
+		findAddrBalance,
+		feeInfo,
+		"",
+		nil)
 	if err != nil {
 		return err
 	}
 
 	return nil
+}
+
+//GetSpendFeeInfo 计算AE转账的手续费，feeRate为自定义手续费，为空时按交易单大小计算协议最低手续费再乘以手续费倍数
+//交易单按最大的nonce和ttl估算，实际交易单不会比估算的更大
+func (decoder *TransactionDecoder) GetSpendFeeInfo(destination string, amount *big.Int, payload []byte, feeRate string) (*txFeeInfo, error) {
 
+	var fee *big.Int
+
+	if len(feeRate) > 0 {
+		fee = common.StringNumToBigIntWithExp(feeRate, decoder.wm.Decimal())
+	} else {
+		tx := aeternity.NewSpendTx(
+			destination,
+			destination,
+			*amount,
+			*big.NewInt(0),
+			string(payload), math.MaxUint32, math.MaxUint32)
+		minFee, err := CalcMinimumFee(&tx, decoder.wm.Config.GetFeeMultiplier())
+		if err != nil {
+			return nil, err
+		}
+		fee = minFee
+	}
+
+	feeInfo := &txFeeInfo{
+		Fee:      fee,
+		GasPrice: fee,
+		GasUsed:  big.NewInt(1),
+	}
+
+	return feeInfo, nil
+}
+
+//sponsoredFeeInfo 代付时内部交易单的手续费为0
+func sponsoredFeeInfo() *txFeeInfo {
+	return &txFeeInfo{
+		Fee:      big.NewInt(0),
+		GasPrice: big.NewInt(0),
+		GasUsed:  big.NewInt(1),
+	}
+}
+
+//GetTokenTransferFeeInfo 计算代币转账的手续费，feeRate和AE转账一样是交易单的fee字段，为空时按交易单大小计算协议最低手续费再乘以手续费倍数，
+//gasPrice为自定义燃料价格(ExtParam的gasPrice)，为空时使用最低燃料价格
+//交易单fee字段按最大的nonce和ttl估算，总手续费 = fee + 燃料上限 * 燃料价格
+func (decoder *TransactionDecoder) GetTokenTransferFeeInfo(contractAddress, destination string, amount *big.Int, feeRate, gasPriceStr string) (*txFeeInfo, error) {
+
+	gasPrice := new(big.Int).Set(&aeternity.Config.Client.GasPrice)
+	if len(gasPriceStr) > 0 {
+		gasPrice = common.StringNumToBigIntWithExp(gasPriceStr, decoder.wm.Decimal())
+		//燃料价格不能低于协议最低燃料价格
+		if gasPrice.Cmp(&aeternity.Config.Client.GasPrice) < 0 {
+			minGasPrice := common.BigIntToDecimals(&aeternity.Config.Client.GasPrice, decoder.wm.Decimal())
+			return nil, openwallet.Errorf(openwallet.ErrInsufficientFees, "gas price [%s] is below the protocol minimum gas price [%s]", gasPriceStr, minGasPrice.String())
+		}
+	}
+	gasLimit := new(big.Int).SetUint64(decoder.wm.Config.TokenGasLimit)
+
+	callData, err := aex9ACI.EncodeCall("transfer", destination, amount)
+	if err != nil {
+		return nil, err
+	}
+
+	tx := aeternity.NewContractCallTx(
+		destination,
+		math.MaxUint32,
+		contractAddress,
+		*big.NewInt(0),
+		*gasLimit,
+		*gasPrice,
+		fateABIVersion,
+		callData,
+		*big.NewInt(0),
+		math.MaxUint32)
+	var txFee *big.Int
+	if len(feeRate) > 0 {
+		txFee = common.StringNumToBigIntWithExp(feeRate, decoder.wm.Decimal())
+	} else {
+		txFee, err = CalcMinimumFee(&tx, decoder.wm.Config.GetFeeMultiplier())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	feeInfo := &txFeeInfo{
+		GasUsed:  gasLimit,
+		GasPrice: gasPrice,
+		TxFee:    txFee,
+	}
+	feeInfo.CalcFee()
+
+	return feeInfo, nil
 }
 
 //SignRawTransaction 签名交易单
@@ -135,12 +383,37 @@ func (decoder *TransactionDecoder) SignRawTransaction(wrapper openwallet.WalletD
 		return fmt.Errorf("transaction signature is empty")
 	}
 
+	keySignatures := rawTx.Signatures[rawTx.Account.AccountID]
+	if err := decoder.signKeySignatures(wrapper, keySignatures); err != nil {
+		return err
+	}
+
+	//代付交易单在内部交易单签名后再签名
+	payingFor, err := getPayingForInfo(rawTx)
+	if err != nil {
+		return err
+	}
+	if payingFor != nil {
+		if err := decoder.signPayingForTransaction(wrapper, rawTx, payingFor); err != nil {
+			return err
+		}
+	}
+
+	decoder.wm.Log.Info("transaction hash sign success")
+
+	rawTx.Signatures[rawTx.Account.AccountID] = keySignatures
+
+	return nil
+}
+
+//signKeySignatures 用钱包的私钥签名
+func (decoder *TransactionDecoder) signKeySignatures(wrapper openwallet.WalletDAI, keySignatures []*openwallet.KeySignature) error {
+
 	key, err := wrapper.HDKey()
 	if err != nil {
 		return err
 	}
 
-	keySignatures := rawTx.Signatures[rawTx.Account.AccountID]
 	if keySignatures != nil {
 		for _, keySignature := range keySignatures {
 
@@ -174,10 +447,6 @@ func (decoder *TransactionDecoder) SignRawTransaction(wrapper openwallet.WalletD
 		}
 	}
 
-	decoder.wm.Log.Info("transaction hash sign success")
-
-	rawTx.Signatures[rawTx.Account.AccountID] = keySignatures
-
 	return nil
 }
 
@@ -188,29 +457,56 @@ func (decoder *TransactionDecoder) VerifyRawTransaction(wrapper openwallet.Walle
 		//this.wm.Log.Std.Error("len of signatures error. ")
 		return fmt.Errorf("transaction signature is empty")
 	}
+
+	//代付交易单合并两个签名
+	payingFor, err := getPayingForInfo(rawTx)
+	if err != nil {
+		return err
+	}
+	if payingFor != nil {
+		return decoder.verifyPayingForTransaction(rawTx, payingFor)
+	}
+
 	//
 	//var tx eos.Transaction
-	txHex, err := hex.DecodeString(rawTx.RawHex)
+	//RawHex支持十六进制编码和tx_编码，已签名交易单使用相同的编码
+	txHex, err := DecodeRawTx(rawTx.RawHex)
 	if err != nil {
 		return fmt.Errorf("transaction decode failed, unexpected error: %v", err)
 	}
 
+	//解码交易单，检查交易单字段和rawTx记录一致
+	tx, err := decodeUnsignedTx(txHex)
+	if err != nil {
+		return openwallet.Errorf(openwallet.ErrVerifyRawTransactionFailed, "transaction decode failed: %v", err)
+	}
+	sender, err := decoder.checkTransactionFields(rawTx, tx, nil)
+	if err != nil {
+		return err
+	}
+	signMessage := append([]byte(decoder.wm.Config.NetworkID), txHex...)
+
 	//支持多重签名
 	for accountID, keySignatures := range rawTx.Signatures {
 		decoder.wm.Log.Debug("accountID Signatures:", accountID)
 		for _, keySignature := range keySignatures {
 
-			messsage, _ := hex.DecodeString(keySignature.Message)
 			signature, _ := hex.DecodeString(keySignature.Signature)
-			publicKey, _ := hex.DecodeString(keySignature.Address.PublicKey)
 
 			//decoder.wm.Log.Debug("txHex:", hex.EncodeToString(txHex))
 			//decoder.wm.Log.Debug("Signature:", keySignature.Signature)
 
+			//签名消息必须是networkID + 交易单，签名公钥必须对应发送地址
+			if checkErr := checkSignatureMessage(keySignature, signMessage); checkErr != nil {
+				return checkErr
+			}
+			if checkErr := checkSigner(keySignature, sender); checkErr != nil {
+				return checkErr
+			}
+
 			//验证签名
-			ret := owcrypt.Verify(publicKey, nil, 0, messsage, uint16(len(messsage)), signature, keySignature.EccType)
-			if ret != owcrypt.SUCCESS {
-				return fmt.Errorf("transaction verify failed")
+			if verifyErr := verifyKeySignature(keySignature); verifyErr != nil {
+				return verifyErr
 			}
 
 			signedEncodedTx, signErr := createSignedTransaction(txHex, [][]byte{signature})
@@ -219,7 +515,8 @@ func (decoder *TransactionDecoder) VerifyRawTransaction(wrapper openwallet.Walle
 			}
 
 			rawTx.IsCompleted = true
-			rawTx.RawHex = hex.EncodeToString(signedEncodedTx)
+			rawTx.RawHex = encodeRawTx(signedEncodedTx, IsBase64Tx(rawTx.RawHex))
+			rawTx.TxID = CalcTxHash(signedEncodedTx)
 			break
 
 		}
@@ -228,11 +525,37 @@ func (decoder *TransactionDecoder) VerifyRawTransaction(wrapper openwallet.Walle
 	return nil
 }
 
+//verifyKeySignature 验证签名
+func verifyKeySignature(keySignature *openwallet.KeySignature) error {
+
+	messsage, _ := hex.DecodeString(keySignature.Message)
+	signature, _ := hex.DecodeString(keySignature.Signature)
+	publicKey, _ := hex.DecodeString(keySignature.Address.PublicKey)
+
+	ret := owcrypt.Verify(publicKey, nil, 0, messsage, uint16(len(messsage)), signature, keySignature.EccType)
+	if ret != owcrypt.SUCCESS {
+		return fmt.Errorf("transaction verify failed")
+	}
+
+	return nil
+}
+
 //SendRawTransaction 广播交易单
 func (decoder *TransactionDecoder) SubmitRawTransaction(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction) (*openwallet.Transaction, error) {
 
+	//替换交易单使用原交易单的nonce，广播失败时原交易单仍然有效，不释放nonce
+	replaces := rawTx.GetExtParam().Get("replaces").String()
+
 	txid, err := decoder.wm.BroadcastTransaction(rawTx.RawHex)
 	if err != nil {
+		if len(replaces) == 0 {
+			decoder.releaseRawTransactionNonce(rawTx)
+		} else {
+			//替换交易单广播失败，允许重新创建
+			if cancelErr := decoder.wm.StuckTxService.CancelReplacement(replaces); cancelErr != nil {
+				decoder.wm.Log.Errorf("cancel replacement of transaction %s failed: %v", replaces, cancelErr)
+			}
+		}
 		return nil, err
 	}
 
@@ -241,6 +564,16 @@ func (decoder *TransactionDecoder) SubmitRawTransaction(wrapper openwallet.Walle
 	rawTx.TxID = txid
 	rawTx.IsSubmit = true
 
+	//跟踪交易单的上链状态
+	if trackErr := decoder.wm.TxTracker.Track(rawTx); trackErr != nil {
+		decoder.wm.Log.Errorf("track transaction %s failed: %v", txid, trackErr)
+	}
+	if len(replaces) > 0 {
+		if replaceErr := decoder.wm.TxTracker.markReplaced(replaces, txid); replaceErr != nil {
+			decoder.wm.Log.Errorf("mark transaction %s replaced failed: %v", replaces, replaceErr)
+		}
+	}
+
 	decimals := decoder.wm.Decimal()
 
 	//记录一个交易单
@@ -256,27 +589,138 @@ func (decoder *TransactionDecoder) SubmitRawTransaction(wrapper openwallet.Walle
 		SubmitTime: time.Now().Unix(),
 	}
 
+	//记录转账备注
+	if memo := rawTx.GetExtParam().Get("memo").String(); len(memo) > 0 {
+		tx.IsMemo = true
+		tx.Memo = memo
+		tx.SetExtParam("memo", memo)
+	}
+
 	tx.WxID = openwallet.GenTransactionWxID(tx)
 
 	return tx, nil
 }
 
-//GetRawTransactionFeeRate 获取交易单的费率
+//releaseRawTransactionNonce 释放交易单预留的nonce
+func (decoder *TransactionDecoder) releaseRawTransactionNonce(rawTx *openwallet.RawTransaction) {
+	nonce := rawTx.GetExtParam().Get("nonce")
+	if !nonce.Exists() || len(rawTx.TxFrom) == 0 {
+		return
+	}
+	from := strings.Split(rawTx.TxFrom[0], ":")[0]
+	if err := decoder.wm.NonceManager.ReleaseNonce(from, nonce.Uint()); err != nil {
+		decoder.wm.Log.Errorf("release nonce %d of address %s failed: %v", nonce.Uint(), from, err)
+	}
+	//代付地址的nonce
+	if payingFor, _ := getPayingForInfo(rawTx); payingFor != nil {
+		if err := decoder.wm.NonceManager.ReleaseNonce(payingFor.Payer, payingFor.Nonce); err != nil {
+			decoder.wm.Log.Errorf("release nonce %d of address %s failed: %v", payingFor.Nonce, payingFor.Payer, err)
+		}
+	}
+}
+
+//GetRawTransactionFeeRate 获取交易单的费率，返回普通档位的普通转账手续费
 func (decoder *TransactionDecoder) GetRawTransactionFeeRate() (feeRate string, unit string, err error) {
-	return decoder.wm.Config.FixFees, "TX", nil
+	suggestion := decoder.GetFeeSuggestion()
+	fee := common.BigIntToDecimals(suggestion.Normal.Fee, decoder.wm.Decimal())
+	return fee.String(), "TX", nil
+}
+
+//GetFeeSuggestion 按节点最低燃料价格和交易池情况给出低速、普通、加急三档手续费建议，
+//建议会缓存一小段时间，避免每次创建交易单都查询交易池。
+//节点无法提供交易池数据时，所有档位使用固定手续费
+func (decoder *TransactionDecoder) GetFeeSuggestion() *FeeSuggestion {
+
+	decoder.feeMu.Lock()
+	defer decoder.feeMu.Unlock()
+
+	cached := decoder.feeSuggestion
+	if cached != nil && time.Now().Unix()-cached.Timestamp < feeSuggestionCacheSeconds {
+		return cached
+	}
+
+	suggestion := decoder.calcFeeSuggestion()
+	//使用固定手续费的建议不缓存，下次继续尝试查询交易池
+	if !suggestion.Fallback {
+		decoder.feeSuggestion = suggestion
+	}
+	return suggestion
+}
+
+//calcFeeSuggestion 查询交易池计算手续费建议
+func (decoder *TransactionDecoder) calcFeeSuggestion() *FeeSuggestion {
+
+	minGasPrice := &aeternity.Config.Client.GasPrice
+
+	pendingGasPrices, err := decoder.wm.GetPendingTransactionGasPrices()
+	if err != nil {
+		decoder.wm.Log.Errorf("get pending transactions failed, use fix fees instead: %v", err)
+		fixFees := common.StringNumToBigIntWithExp(decoder.wm.Config.FixFees, decoder.wm.Decimal())
+		newFixFeesTier := func() *FeeTier {
+			return &FeeTier{GasPrice: new(big.Int).Set(minGasPrice), Fee: new(big.Int).Set(fixFees)}
+		}
+		return &FeeSuggestion{
+			Low:       newFixFeesTier(),
+			Normal:    newFixFeesTier(),
+			Urgent:    newFixFeesTier(),
+			Timestamp: time.Now().Unix(),
+			Fallback:  true,
+		}
+	}
+
+	low, normal, urgent := calcFeeTierGasPrices(minGasPrice, pendingGasPrices)
+
+	//普通转账按最大的nonce、ttl和较大的转账数量估算手续费
+	amount, _ := new(big.Int).SetString(dryRunAmount, 10)
+	newFeeTier := func(gasPrice *big.Int) *FeeTier {
+		tx := aeternity.NewSpendTx(
+			dryRunAccount,
+			dryRunAccount,
+			*amount,
+			*big.NewInt(0),
+			"", math.MaxUint32, math.MaxUint32)
+		fee, _ := CalcFeeWithGasPrice(&tx, gasPrice)
+		return &FeeTier{GasPrice: gasPrice, Fee: fee}
+	}
+
+	return &FeeSuggestion{
+		Low:          newFeeTier(low),
+		Normal:       newFeeTier(normal),
+		Urgent:       newFeeTier(urgent),
+		PendingCount: len(pendingGasPrices),
+		Timestamp:    time.Now().Unix(),
+	}
 }
 
-//CreateSummaryRawTransaction 创建汇总交易
+//CreateSummaryRawTransaction 创建汇总交易，只返回创建成功的交易单
 func (decoder *TransactionDecoder) CreateSummaryRawTransaction(wrapper openwallet.WalletDAI, sumRawTx *openwallet.SummaryRawTransaction) ([]*openwallet.RawTransaction, error) {
 
+	rawTxWithErrArray, err := decoder.CreateSummaryRawTransactionWithError(wrapper, sumRawTx)
+	if err != nil {
+		return nil, err
+	}
+
+	rawTxArray := make([]*openwallet.RawTransaction, 0)
+	for _, rawTxWithErr := range rawTxWithErrArray {
+		if rawTxWithErr.Error != nil {
+			decoder.wm.Log.Errorf("create summary transaction failed: %v", rawTxWithErr.Error)
+			continue
+		}
+		rawTxArray = append(rawTxArray, rawTxWithErr.RawTx)
+	}
+
+	return rawTxArray, nil
+}
+
+//createAESummaryRawTransaction 创建AE汇总交易，单个地址失败时记录在对应交易单的Error中，继续汇总其他地址
+func (decoder *TransactionDecoder) createAESummaryRawTransaction(wrapper openwallet.WalletDAI, sumRawTx *openwallet.SummaryRawTransaction) ([]*openwallet.RawTransactionWithError, error) {
+
 	var (
 		decimals        = decoder.wm.Decimal()
-		rawTxArray      = make([]*openwallet.RawTransaction, 0)
+		rawTxArray      = make([]*openwallet.RawTransactionWithError, 0)
 		accountID       = sumRawTx.Account.AccountID
 		minTransfer     = common.StringNumToBigIntWithExp(sumRawTx.MinTransfer, decimals)
 		retainedBalance = common.StringNumToBigIntWithExp(sumRawTx.RetainedBalance, decimals)
-		fixFees         = big.NewInt(0)
-		feeInfo         *txFeeInfo
 	)
 
 	if minTransfer.Cmp(retainedBalance) < 0 {
@@ -304,19 +748,8 @@ func (decoder *TransactionDecoder) CreateSummaryRawTransaction(wrapper openwalle
 		return nil, err
 	}
 
-	if len(sumRawTx.FeeRate) > 0 {
-		fixFees = common.StringNumToBigIntWithExp(sumRawTx.FeeRate, decimals)
-	} else {
-		fixFees = common.StringNumToBigIntWithExp(decoder.wm.Config.FixFees, decimals)
-	}
-
-	//计算手续费
-	//计算手续费
-	feeInfo = &txFeeInfo{
-		Fee: fixFees,
-		GasPrice: fixFees,
-		GasUsed: big.NewInt(1),
-	}
+	//ExtParam的feePayer为代付手续费的账户
+	feePayer := sumRawTx.GetExtParam().Get("feePayer").String()
 
 	for _, addrBalance := range addrBalanceArray {
 
@@ -326,6 +759,33 @@ func (decoder *TransactionDecoder) CreateSummaryRawTransaction(wrapper openwalle
 		if addrBalance_BI.Cmp(minTransfer) < 0 || addrBalance_BI.Cmp(big.NewInt(0)) <= 0 {
 			continue
 		}
+
+		//创建一笔交易单，汇总数量在计算手续费后确定
+		rawTx := &openwallet.RawTransaction{
+			Coin:     sumRawTx.Coin,
+			Account:  sumRawTx.Account,
+			To:       map[string]string{sumRawTx.SummaryAddress: "0"},
+			TxFrom:   []string{fmt.Sprintf("%s:%s", addrBalance.Address, addrBalance.Balance)},
+			Required: 1,
+		}
+		if len(feePayer) > 0 {
+			rawTx.SetExtParam("feePayer", feePayer)
+		}
+
+		//计算手续费，汇总数量不会超过余额，按余额估算交易单大小
+		feeInfo, feeErr := decoder.GetSpendFeeInfo(sumRawTx.SummaryAddress, addrBalance_BI, nil, sumRawTx.FeeRate)
+		if feeErr != nil {
+			rawTxArray = append(rawTxArray, &openwallet.RawTransactionWithError{
+				RawTx: rawTx,
+				Error: openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "%v", feeErr),
+			})
+			continue
+		}
+		//手续费由代付账户支付，汇总全部余额
+		if len(feePayer) > 0 {
+			feeInfo = sponsoredFeeInfo()
+		}
+
 		//计算汇总数量 = 余额 - 保留余额
 		sumAmount_BI := new(big.Int)
 		sumAmount_BI.Sub(addrBalance_BI, retainedBalance)
@@ -343,14 +803,8 @@ func (decoder *TransactionDecoder) CreateSummaryRawTransaction(wrapper openwalle
 		decoder.wm.Log.Debugf("fees: %v", feesAmount)
 		decoder.wm.Log.Debugf("sumAmount: %v", sumAmount)
 
-		//创建一笔交易单
-		rawTx := &openwallet.RawTransaction{
-			Coin:    sumRawTx.Coin,
-			Account: sumRawTx.Account,
-			To: map[string]string{
-				sumRawTx.SummaryAddress: sumAmount.StringFixed(decoder.wm.Decimal()),
-			},
-			Required: 1,
+		rawTx.To = map[string]string{
+			sumRawTx.SummaryAddress: sumAmount.StringFixed(decoder.wm.Decimal()),
 		}
 
 		createErr := decoder.createRawTransaction(
@@ -358,27 +812,30 @@ func (decoder *TransactionDecoder) CreateSummaryRawTransaction(wrapper openwalle
 			rawTx,
 			&AddrBalance{Address: addrBalance.Address, Balance: addrBalance_BI},
 			feeInfo,
-			"")
+			"",
+			nil)
 		if createErr != nil {
-			return nil, createErr
+			decoder.wm.Log.Errorf("create summary transaction of address [%s] failed: %v", addrBalance.Address, createErr)
 		}
 
-		//创建成功，添加到队列
-		rawTxArray = append(rawTxArray, rawTx)
-
+		rawTxArray = append(rawTxArray, &openwallet.RawTransactionWithError{
+			RawTx: rawTx,
+			Error: openwallet.ConvertError(createErr),
+		})
 	}
 
 	return rawTxArray, nil
 
 }
 
-//createRawTransaction
+//createRawTransaction nonceState为付款地址已查询的nonce状态，为nil时向节点查询
 func (decoder *TransactionDecoder) createRawTransaction(
 	wrapper openwallet.WalletDAI,
 	rawTx *openwallet.RawTransaction,
 	addrBalance *AddrBalance,
 	feeInfo *txFeeInfo,
-	callData string) error {
+	payload string,
+	nonceState *accountNonceState) (err error) {
 
 	var (
 		accountTotalSent = decimal.Zero
@@ -391,7 +848,11 @@ func (decoder *TransactionDecoder) createRawTransaction(
 
 	decimals := int32(0)
 	if rawTx.Coin.IsContract {
-		decimals = int32(rawTx.Coin.Contract.Decimals)
+		tokenDecimals, decimalsErr := decoder.wm.ContractDecoder.GetTokenDecimals(rawTx.Coin.Contract)
+		if decimalsErr != nil {
+			return openwallet.Errorf(openwallet.ErrCallFullNodeAPIFailed, "get token decimals failed: %v", decimalsErr)
+		}
+		decimals = tokenDecimals
 	} else {
 		decimals = decoder.wm.Decimal()
 	}
@@ -419,45 +880,95 @@ func (decoder *TransactionDecoder) createRawTransaction(
 
 	addr, err := wrapper.GetAddress(addrBalance.Address)
 	if err != nil {
-		return err
+		return openwallet.Errorf(openwallet.ErrAddressNotFound, "address [%s] is not found: %v", addrBalance.Address, err)
 	}
 
-	//helpers := aeternity.Helpers{Node: decoder.wm.Api}
-	ttl, nonce, err := aeternity.GetTTLNonce(decoder.wm.Api, addrBalance.Address, aeternity.Config.Client.TTL)
-	if err != nil {
-		return err
+	//预留nonce，创建失败时释放
+	var reservation *NonceReservation
+	if nonceState != nil {
+		reservation, err = decoder.wm.NonceManager.reserveNonceWithState(nonceState)
+	} else {
+		reservation, err = decoder.wm.NonceManager.ReserveNonce(addrBalance.Address)
 	}
-
-	//查询是否有带
-	pending, err := decoder.wm.GetAccountPendingTxCount(addrBalance.Address)
 	if err != nil {
-		return err
+		return openwallet.Errorf(openwallet.ErrCallFullNodeAPIFailed, "reserve nonce of address [%s] failed: %v", addrBalance.Address, err)
 	}
+	nonce, ttl := reservation.Nonce, reservation.TTL
+	var payerNonce *NonceReservation
+	defer func() {
+		if err != nil {
+			decoder.wm.NonceManager.ReleaseNonce(addrBalance.Address, nonce)
+			//代付地址的nonce
+			if payerNonce != nil {
+				decoder.wm.NonceManager.ReleaseNonce(payerNonce.Address, payerNonce.Nonce)
+			}
+		}
+	}()
 
 	decoder.wm.Log.Debugf("nonce: %d", nonce)
-	decoder.wm.Log.Debugf("pending: %d", pending)
 
 	amount := common.StringNumToBigIntWithExp(amountStr, decimals)
 
-	// create the SpendTransaction
-	tx := aeternity.NewSpendTx(
-		addrBalance.Address,
-		destination,
-		*amount,
-		*feeInfo.Fee,
-		callData, ttl, nonce+pending)
+	//ExtParam的feePayer为代付手续费的账户，内部交易单的fee为0
+	feePayer := rawTx.GetExtParam().Get("feePayer").String()
+	innerFee := feeInfo.Fee
+	innerTxFee := feeInfo.TxFee
+	if len(feePayer) > 0 {
+		innerFee = big.NewInt(0)
+		innerTxFee = big.NewInt(0)
+	}
+
+	var tx aeternity.Tx
+	if rawTx.Coin.IsContract {
+		// create the ContractCallTransaction of token transfer
+		transferData, encodeErr := aex9ACI.EncodeCall("transfer", destination, amount)
+		if encodeErr != nil {
+			return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "%v", encodeErr)
+		}
+		callTx := aeternity.NewContractCallTx(
+			addrBalance.Address,
+			nonce,
+			rawTx.Coin.Contract.Address,
+			*big.NewInt(0),
+			*feeInfo.GasUsed,
+			*feeInfo.GasPrice,
+			fateABIVersion,
+			transferData,
+			*innerTxFee,
+			ttl)
+		tx = &callTx
+	} else {
+		// create the SpendTransaction
+		spendTx := aeternity.NewSpendTx(
+			addrBalance.Address,
+			destination,
+			*amount,
+			*innerFee,
+			payload, ttl, nonce)
+		tx = &spendTx
+	}
+	//手续费不能低于按实际交易单大小计算的协议最低手续费
+	if len(feePayer) == 0 {
+		if verifyErr := VerifyMinimumFee(tx); verifyErr != nil {
+			return openwallet.Errorf(openwallet.ErrInsufficientFees, "%v", verifyErr)
+		}
+	}
+
 	//txRaw, err := rlp.EncodeToBytes(tx)
 	txRaw, err := tx.RLP()
 	if err != nil {
-		return err
+		return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "%v", err)
 	}
-	rawTx.RawHex = hex.EncodeToString(txRaw)
+	rawTx.RawHex = encodeRawTx(txRaw, decoder.wm.Config.ExportBase64Tx)
 
 	if rawTx.Signatures == nil {
 		rawTx.Signatures = make(map[string][]*openwallet.KeySignature)
 	}
 
 	msg := append([]byte(decoder.wm.Config.NetworkID), txRaw...)
+	if len(feePayer) > 0 {
+		msg = innerTxSignMessage(decoder.wm.Config.NetworkID, txRaw)
+	}
 
 	signature := openwallet.KeySignature{
 		EccType: decoder.wm.Config.CurveType,
@@ -466,35 +977,48 @@ func (decoder *TransactionDecoder) createRawTransaction(
 	}
 	keySignList = append(keySignList, &signature)
 
-	feesAmount := common.BigIntToDecimals(feeInfo.Fee, decimals)
-	gasPrice := common.BigIntToDecimals(feeInfo.GasPrice, decimals)
-	accountTotalSent = accountTotalSent.Add(feesAmount)
+	rawTx.Signatures[rawTx.Account.AccountID] = keySignList
+
+	feesAmount := common.BigIntToDecimals(feeInfo.Fee, decoder.wm.Decimal())
+	//FeeRate是交易单的fee字段，代币转账的燃料价格另外记录在ExtParam的gasPrice
+	feeRate := common.BigIntToDecimals(feeInfo.Fee, decoder.wm.Decimal())
+	if rawTx.Coin.IsContract {
+		feeRate = common.BigIntToDecimals(feeInfo.TxFee, decoder.wm.Decimal())
+		rawTx.SetExtParam("gasPrice", common.BigIntToDecimals(feeInfo.GasPrice, decoder.wm.Decimal()).String())
+	}
+	if len(feePayer) > 0 {
+		//手续费由代付账户支付，不计入账户的实际转账数量
+		payingForFee, payingForNonce, payingForErr := decoder.createPayingForTransaction(wrapper, rawTx, feePayer, tx, txRaw)
+		if payingForErr != nil {
+			return payingForErr
+		}
+		payerNonce = payingForNonce
+		//代付地址支付的手续费，代币转账包含燃料费
+		feesAmount = common.BigIntToDecimals(payingForCost(payingForFee, tx), decoder.wm.Decimal())
+	} else if !rawTx.Coin.IsContract {
+		//代币转账的手续费是AE，不计入代币的实际转账数量
+		accountTotalSent = accountTotalSent.Add(feesAmount)
+	}
 	accountTotalSent = decimal.Zero.Sub(accountTotalSent)
 
 	//rawTx.RawHex = rawHex
-	rawTx.Signatures[rawTx.Account.AccountID] = keySignList
-	rawTx.FeeRate = gasPrice.String()
+	rawTx.FeeRate = feeRate.String()
 	rawTx.Fees = feesAmount.String()
 	rawTx.IsBuilt = true
 	rawTx.TxAmount = accountTotalSent.StringFixed(decimals)
 	rawTx.TxFrom = txFrom
 	rawTx.TxTo = txTo
+	//记录预留的nonce和ttl，广播失败时释放nonce，广播后用于跟踪交易单
+	rawTx.SetExtParam("nonce", nonce)
+	rawTx.SetExtParam("ttl", ttl)
 
 	return nil
 }
 
 //CreateSummaryRawTransactionWithError 创建汇总交易，返回能原始交易单数组（包含带错误的原始交易单）
 func (decoder *TransactionDecoder) CreateSummaryRawTransactionWithError(wrapper openwallet.WalletDAI, sumRawTx *openwallet.SummaryRawTransaction) ([]*openwallet.RawTransactionWithError, error) {
-	raTxWithErr := make([]*openwallet.RawTransactionWithError, 0)
-	rawTxs, err := decoder.CreateSummaryRawTransaction(wrapper, sumRawTx)
-	if err != nil {
-		return nil, err
-	}
-	for _, tx := range rawTxs {
-		raTxWithErr = append(raTxWithErr, &openwallet.RawTransactionWithError{
-			RawTx: tx,
-			Error: nil,
-		})
+	if sumRawTx.Coin.IsContract {
+		return decoder.CreateTokenSummaryRawTransaction(wrapper, sumRawTx)
 	}
-	return raTxWithErr, nil
+	return decoder.createAESummaryRawTransaction(wrapper, sumRawTx)
 }
\ No newline at end of file
@@ -0,0 +1,796 @@
+package aeternity
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/aeternity/aepp-sdk-go/aeternity"
+	rlp "github.com/randomshinichi/rlpae"
+	"math/big"
+	"strings"
+)
+
+//idTagPrefix id类型标签对应的编码前缀
+var idTagPrefix = map[uint8]aeternity.HashPrefix{
+	aeternity.IDTagAccount:    aeternity.PrefixAccountPubkey,
+	aeternity.IDTagName:       aeternity.PrefixName,
+	aeternity.IDTagCommitment: aeternity.PrefixCommitment,
+	aeternity.IDTagOracle:     aeternity.PrefixOraclePubkey,
+	aeternity.IDTagContract:   aeternity.PrefixContractPubkey,
+	aeternity.IDTagChannel:    aeternity.PrefixChannel,
+}
+
+//decodeRLPFields 解码RLP对象，返回对象标签、版本和其余字段
+func decodeRLPFields(raw []byte) (tag uint, version uint, fields []interface{}, err error) {
+	var list []interface{}
+	if err = rlp.DecodeBytes(raw, &list); err != nil {
+		return 0, 0, nil, fmt.Errorf("rlp decode failed: %v", err)
+	}
+	if len(list) < 2 {
+		return 0, 0, nil, fmt.Errorf("rlp object is too short")
+	}
+	t, err := rlpUint(list[0])
+	if err != nil {
+		return 0, 0, nil, fmt.Errorf("object tag is invalid: %v", err)
+	}
+	v, err := rlpUint(list[1])
+	if err != nil {
+		return 0, 0, nil, fmt.Errorf("object version is invalid: %v", err)
+	}
+	return uint(t), uint(v), list[2:], nil
+}
+
+//rlpBytes RLP字段的字节数组
+func rlpBytes(v interface{}) ([]byte, error) {
+	b, ok := v.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("field is not a byte array")
+	}
+	return b, nil
+}
+
+//rlpUint RLP字段的无符号整数
+func rlpUint(v interface{}) (uint64, error) {
+	b, err := rlpBytes(v)
+	if err != nil {
+		return 0, err
+	}
+	if len(b) > 8 {
+		return 0, fmt.Errorf("integer overflows uint64")
+	}
+	return new(big.Int).SetBytes(b).Uint64(), nil
+}
+
+//rlpBigInt RLP字段的大整数
+func rlpBigInt(v interface{}) (*big.Int, error) {
+	b, err := rlpBytes(v)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+//rlpID RLP字段的id，1字节标签 + 32字节hash，返回带前缀的编码
+func rlpID(v interface{}) (string, error) {
+	b, err := rlpBytes(v)
+	if err != nil {
+		return "", err
+	}
+	if len(b) != 33 {
+		return "", fmt.Errorf("id length %d is invalid", len(b))
+	}
+	prefix, ok := idTagPrefix[b[0]]
+	if !ok {
+		return "", fmt.Errorf("id tag %d is unknown", b[0])
+	}
+	return aeternity.Encode(prefix, b[1:]), nil
+}
+
+//rlpFieldReader 按顺序读取RLP字段，记录第一个错误
+type rlpFieldReader struct {
+	fields []interface{}
+	index  int
+	err    error
+}
+
+//next 下一个字段
+func (r *rlpFieldReader) next() interface{} {
+	if r.err != nil {
+		return nil
+	}
+	if r.index >= len(r.fields) {
+		r.err = fmt.Errorf("field %d is missing", r.index)
+		return nil
+	}
+	v := r.fields[r.index]
+	r.index++
+	return v
+}
+
+//fail 记录字段错误
+func (r *rlpFieldReader) fail(err error) {
+	if r.err == nil && err != nil {
+		r.err = fmt.Errorf("field %d: %v", r.index-1, err)
+	}
+}
+
+func (r *rlpFieldReader) id() string {
+	v := r.next()
+	if r.err != nil {
+		return ""
+	}
+	id, err := rlpID(v)
+	r.fail(err)
+	return id
+}
+
+func (r *rlpFieldReader) uint() uint64 {
+	v := r.next()
+	if r.err != nil {
+		return 0
+	}
+	n, err := rlpUint(v)
+	r.fail(err)
+	return n
+}
+
+func (r *rlpFieldReader) bigInt() big.Int {
+	v := r.next()
+	if r.err != nil {
+		return big.Int{}
+	}
+	n, err := rlpBigInt(v)
+	r.fail(err)
+	if n == nil {
+		return big.Int{}
+	}
+	return *n
+}
+
+func (r *rlpFieldReader) bytes() []byte {
+	v := r.next()
+	if r.err != nil {
+		return nil
+	}
+	b, err := rlpBytes(v)
+	r.fail(err)
+	return b
+}
+
+func (r *rlpFieldReader) str() string {
+	return string(r.bytes())
+}
+
+//encoded 字节数组字段按前缀编码
+func (r *rlpFieldReader) encoded(prefix aeternity.HashPrefix) string {
+	b := r.bytes()
+	if r.err != nil {
+		return ""
+	}
+	return aeternity.Encode(prefix, b)
+}
+
+func (r *rlpFieldReader) list() []interface{} {
+	v := r.next()
+	if r.err != nil {
+		return nil
+	}
+	l, ok := v.([]interface{})
+	if !ok {
+		r.fail(fmt.Errorf("field is not a list"))
+	}
+	return l
+}
+
+//ids id列表字段
+func (r *rlpFieldReader) ids() []string {
+	ids := make([]string, 0)
+	for _, v := range r.list() {
+		id, err := rlpID(v)
+		if err != nil {
+			r.fail(err)
+			return nil
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+//ctVersion 合约的虚拟机版本和ABI版本，ABI版本为最后2个字节
+func (r *rlpFieldReader) ctVersion() (vmVersion, abiVersion uint16) {
+	b := r.bytes()
+	if r.err != nil {
+		return 0, 0
+	}
+	if len(b) < 2 {
+		r.fail(fmt.Errorf("contract version is invalid"))
+		return 0, 0
+	}
+	return uint16(new(big.Int).SetBytes(b[:len(b)-2]).Uint64()), uint16(new(big.Int).SetBytes(b[len(b)-2:]).Uint64())
+}
+
+//done 检查字段已读完
+func (r *rlpFieldReader) done() error {
+	if r.err == nil && r.index != len(r.fields) {
+		r.err = fmt.Errorf("has %d fields, expected %d", len(r.fields), r.index)
+	}
+	return r.err
+}
+
+//decodeSignedTx 解码已签名的交易单，返回签名和未签名的交易单
+func decodeSignedTx(raw []byte) (signatures [][]byte, txRaw []byte, err error) {
+	tag, _, fields, err := decodeRLPFields(raw)
+	if err != nil {
+		return nil, nil, err
+	}
+	if tag != aeternity.ObjectTagSignedTransaction {
+		return nil, nil, fmt.Errorf("object tag %d is not signed transaction", tag)
+	}
+	if len(fields) != 2 {
+		return nil, nil, fmt.Errorf("signed transaction is invalid")
+	}
+	sigList, ok := fields[0].([]interface{})
+	if !ok {
+		return nil, nil, fmt.Errorf("signatures of signed transaction are invalid")
+	}
+	for _, s := range sigList {
+		sig, sigErr := rlpBytes(s)
+		if sigErr != nil {
+			return nil, nil, fmt.Errorf("signature of signed transaction is invalid")
+		}
+		signatures = append(signatures, sig)
+	}
+	txRaw, err = rlpBytes(fields[1])
+	if err != nil {
+		return nil, nil, fmt.Errorf("transaction of signed transaction is invalid")
+	}
+	return signatures, txRaw, nil
+}
+
+//txTypeNames 交易单对象标签对应的类型名称
+var txTypeNames = map[uint]string{
+	aeternity.ObjectTagSignedTransaction:               "SignedTx",
+	aeternity.ObjectTagSpendTransaction:                "SpendTx",
+	aeternity.ObjectTagOracleRegisterTransaction:       "OracleRegisterTx",
+	aeternity.ObjectTagOracleQueryTransaction:          "OracleQueryTx",
+	aeternity.ObjectTagOracleResponseTransaction:       "OracleRespondTx",
+	aeternity.ObjectTagOracleExtendTransaction:         "OracleExtendTx",
+	aeternity.ObjectTagNameServiceClaimTransaction:     "NameClaimTx",
+	aeternity.ObjectTagNameServicePreclaimTransaction:  "NamePreclaimTx",
+	aeternity.ObjectTagNameServiceUpdateTransaction:    "NameUpdateTx",
+	aeternity.ObjectTagNameServiceRevokeTransaction:    "NameRevokeTx",
+	aeternity.ObjectTagNameServiceTransferTransaction:  "NameTransferTx",
+	aeternity.ObjectTagContractCreateTransaction:       "ContractCreateTx",
+	aeternity.ObjectTagContractCallTransaction:         "ContractCallTx",
+	aeternity.ObjectTagChannelCreateTransaction:        "ChannelCreateTx",
+	aeternity.ObjectTagChannelDepositTransaction:       "ChannelDepositTx",
+	aeternity.ObjectTagChannelWithdrawTransaction:      "ChannelWithdrawTx",
+	aeternity.ObjectTagChannelForceProgressTransaction: "ChannelForceProgressTx",
+	aeternity.ObjectTagChannelCloseMutualTransaction:   "ChannelCloseMutualTx",
+	aeternity.ObjectTagChannelCloseSoloTransaction:     "ChannelCloseSoloTx",
+	aeternity.ObjectTagChannelSlashTransaction:         "ChannelSlashTx",
+	aeternity.ObjectTagChannelSettleTransaction:        "ChannelSettleTx",
+	aeternity.ObjectTagChannelOffChainTransaction:      "ChannelOffChainTx",
+	aeternity.ObjectTagChannelSnapshotTransaction:      "ChannelSnapshotSoloTx",
+	ObjectTagGAAttachTransaction:                       "GAAttachTx",
+	ObjectTagGAMetaTransaction:                         "GAMetaTx",
+	ObjectTagPayingForTransaction:                      "PayingForTx",
+}
+
+//DecodedTx 解码后的交易单
+type DecodedTx struct {
+	Tag        uint
+	Type       string
+	Version    uint
+	Hash       string      `json:",omitempty"` //已签名交易单的th_哈希
+	Signatures []string    `json:",omitempty"` //已签名交易单的sg_签名
+	Tx         interface{} //交易单内容，已签名交易单为内部交易单的*DecodedTx
+	Raw        []byte      `json:"-"`
+}
+
+//RLP 交易单的RLP编码
+func (tx *DecodedTx) RLP() ([]byte, error) {
+	return tx.Raw, nil
+}
+
+//JSON 交易单的JSON格式
+func (tx *DecodedTx) JSON() (string, error) {
+	b, err := json.Marshal(tx)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+//IsBase64Tx 交易单是否为tx_编码
+func IsBase64Tx(encoded string) bool {
+	return strings.HasPrefix(strings.TrimSpace(encoded), string(aeternity.PrefixTransaction))
+}
+
+//DecodeRawTx 解码tx_编码或十六进制编码的交易单，返回RLP编码
+func DecodeRawTx(encoded string) ([]byte, error) {
+	var (
+		raw []byte
+		err error
+	)
+	encoded = strings.TrimSpace(encoded)
+	if IsBase64Tx(encoded) {
+		raw, err = aeternity.Decode(encoded)
+	} else {
+		raw, err = hex.DecodeString(strings.TrimPrefix(encoded, "0x"))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("transaction is neither tx_ nor hex encoded: %v", err)
+	}
+	return raw, nil
+}
+
+//TxHexToBase64 十六进制编码的交易单转为tx_编码
+func TxHexToBase64(txHex string) (string, error) {
+	raw, err := DecodeRawTx(txHex)
+	if err != nil {
+		return "", err
+	}
+	return aeternity.Encode(aeternity.PrefixTransaction, raw), nil
+}
+
+//TxBase64ToHex tx_编码的交易单转为十六进制编码
+func TxBase64ToHex(tx string) (string, error) {
+	raw, err := DecodeRawTx(tx)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(raw), nil
+}
+
+//encodeRawTx 编码交易单，base64为true时为tx_编码，否则为十六进制编码
+func encodeRawTx(raw []byte, base64 bool) string {
+	if base64 {
+		return aeternity.Encode(aeternity.PrefixTransaction, raw)
+	}
+	return hex.EncodeToString(raw)
+}
+
+//DecodeTransaction 解码tx_编码或十六进制编码的交易单
+func DecodeTransaction(encoded string) (*DecodedTx, error) {
+	raw, err := DecodeRawTx(encoded)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeRLPTransaction(raw)
+}
+
+//InspectTransaction 解码tx_编码或十六进制编码的交易单，返回缩进的JSON，用于查看交易单内容
+func InspectTransaction(encoded string) (string, error) {
+	decoded, err := DecodeTransaction(encoded)
+	if err != nil {
+		return "", err
+	}
+	b, err := json.MarshalIndent(decoded, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+//DecodeRLPTransaction 解码RLP编码的交易单，支持已签名交易单和所有交易单类型
+func DecodeRLPTransaction(raw []byte) (*DecodedTx, error) {
+
+	tag, version, fields, err := decodeRLPFields(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	typeName, ok := txTypeNames[tag]
+	if !ok {
+		return nil, fmt.Errorf("object tag %d is not a transaction", tag)
+	}
+
+	decoded := &DecodedTx{
+		Tag:     tag,
+		Type:    typeName,
+		Version: version,
+		Raw:     raw,
+	}
+
+	if tag == aeternity.ObjectTagSignedTransaction {
+		signatures, txRaw, err := decodeSignedTx(raw)
+		if err != nil {
+			return nil, err
+		}
+		for _, sig := range signatures {
+			decoded.Signatures = append(decoded.Signatures, aeternity.Encode(aeternity.PrefixSignature, sig))
+		}
+		decoded.Hash = CalcTxHash(raw)
+		decoded.Tx, err = DecodeRLPTransaction(txRaw)
+		if err != nil {
+			return nil, fmt.Errorf("transaction of signed transaction: %v", err)
+		}
+		return decoded, nil
+	}
+
+	r := &rlpFieldReader{fields: fields}
+	decoded.Tx, err = decodeTxContent(tag, version, r)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.done(); err != nil {
+		return nil, fmt.Errorf("%s %v", typeName, err)
+	}
+
+	return decoded, nil
+}
+
+//decodeTxContent 按对象标签解码交易单的字段
+func decodeTxContent(tag, version uint, r *rlpFieldReader) (interface{}, error) {
+
+	//只有GAMetaTx、ChannelCreateTx和ChannelOffChainTx支持版本2
+	if version != 1 && !(version == 2 && (tag == ObjectTagGAMetaTransaction ||
+		tag == aeternity.ObjectTagChannelCreateTransaction ||
+		tag == aeternity.ObjectTagChannelOffChainTransaction)) {
+		return nil, fmt.Errorf("version %d of %s is not supported", version, txTypeNames[tag])
+	}
+
+	switch tag {
+	case aeternity.ObjectTagSpendTransaction:
+		return decodeSpendTx(r), nil
+	case aeternity.ObjectTagContractCallTransaction:
+		return decodeContractCallTx(r), nil
+	case aeternity.ObjectTagContractCreateTransaction:
+		tx := &aeternity.ContractCreateTx{}
+		tx.OwnerID = r.id()
+		tx.AccountNonce = r.uint()
+		tx.Code = r.encoded(aeternity.PrefixContractByteArray)
+		tx.VMVersion, tx.AbiVersion = r.ctVersion()
+		tx.Fee = r.bigInt()
+		tx.TTL = r.uint()
+		tx.Deposit = r.bigInt()
+		tx.Amount = r.bigInt()
+		tx.Gas = r.bigInt()
+		tx.GasPrice = r.bigInt()
+		tx.CallData = r.encoded(aeternity.PrefixContractByteArray)
+		return tx, nil
+	case aeternity.ObjectTagNameServicePreclaimTransaction:
+		tx := &aeternity.NamePreclaimTx{}
+		tx.AccountID = r.id()
+		tx.AccountNonce = r.uint()
+		tx.CommitmentID = r.id()
+		tx.Fee = r.bigInt()
+		tx.TTL = r.uint()
+		return tx, nil
+	case aeternity.ObjectTagNameServiceClaimTransaction:
+		tx := &aeternity.NameClaimTx{}
+		tx.AccountID = r.id()
+		tx.AccountNonce = r.uint()
+		tx.Name = r.str()
+		tx.NameSalt = r.bigInt()
+		tx.Fee = r.bigInt()
+		tx.TTL = r.uint()
+		return tx, nil
+	case aeternity.ObjectTagNameServiceUpdateTransaction:
+		tx := &NameUpdateTx{}
+		tx.AccountID = r.id()
+		tx.AccountNonce = r.uint()
+		tx.NameID = r.id()
+		tx.NameTTL = r.uint()
+		tx.Pointers = decodeNamePointers(r)
+		tx.ClientTTL = r.uint()
+		tx.Fee = r.bigInt()
+		tx.TTL = r.uint()
+		return tx, nil
+	case aeternity.ObjectTagNameServiceRevokeTransaction:
+		tx := &aeternity.NameRevokeTx{}
+		tx.AccountID = r.id()
+		tx.AccountNonce = r.uint()
+		tx.NameID = r.id()
+		tx.Fee = r.bigInt()
+		tx.TTL = r.uint()
+		return tx, nil
+	case aeternity.ObjectTagNameServiceTransferTransaction:
+		tx := &aeternity.NameTransferTx{}
+		tx.AccountID = r.id()
+		tx.AccountNonce = r.uint()
+		tx.NameID = r.id()
+		tx.RecipientID = r.id()
+		tx.Fee = r.bigInt()
+		tx.TTL = r.uint()
+		return tx, nil
+	case aeternity.ObjectTagOracleRegisterTransaction:
+		tx := &aeternity.OracleRegisterTx{}
+		tx.AccountID = r.id()
+		tx.AccountNonce = r.uint()
+		tx.QuerySpec = r.str()
+		tx.ResponseSpec = r.str()
+		tx.QueryFee = r.bigInt()
+		tx.OracleTTLType = r.uint()
+		tx.OracleTTLValue = r.uint()
+		tx.Fee = r.bigInt()
+		tx.TTL = r.uint()
+		tx.AbiVersion = uint16(r.uint())
+		return tx, nil
+	case aeternity.ObjectTagOracleQueryTransaction:
+		tx := &aeternity.OracleQueryTx{}
+		tx.SenderID = r.id()
+		tx.AccountNonce = r.uint()
+		tx.OracleID = r.id()
+		tx.Query = r.str()
+		tx.QueryFee = r.bigInt()
+		tx.QueryTTLType = r.uint()
+		tx.QueryTTLValue = r.uint()
+		tx.ResponseTTLType = r.uint()
+		tx.ResponseTTLValue = r.uint()
+		tx.Fee = r.bigInt()
+		tx.TTL = r.uint()
+		return tx, nil
+	case aeternity.ObjectTagOracleResponseTransaction:
+		tx := &aeternity.OracleRespondTx{}
+		tx.OracleID = r.id()
+		tx.AccountNonce = r.uint()
+		tx.QueryID = r.encoded(aeternity.PrefixOracleQueryID)
+		tx.Response = r.str()
+		tx.ResponseTTLType = r.uint()
+		tx.ResponseTTLValue = r.uint()
+		tx.Fee = r.bigInt()
+		tx.TTL = r.uint()
+		return tx, nil
+	case aeternity.ObjectTagOracleExtendTransaction:
+		tx := &aeternity.OracleExtendTx{}
+		tx.OracleID = r.id()
+		tx.AccountNonce = r.uint()
+		tx.OracleTTLType = r.uint()
+		tx.OracleTTLValue = r.uint()
+		tx.Fee = r.bigInt()
+		tx.TTL = r.uint()
+		return tx, nil
+	case aeternity.ObjectTagChannelCreateTransaction:
+		tx := &ChannelCreateTx{}
+		tx.InitiatorID = r.id()
+		tx.InitiatorAmount = r.bigInt()
+		tx.ResponderID = r.id()
+		tx.ResponderAmount = r.bigInt()
+		tx.ChannelReserve = r.bigInt()
+		tx.LockPeriod = r.uint()
+		tx.TTL = r.uint()
+		tx.Fee = r.bigInt()
+		tx.DelegateIDs = r.ids()
+		//版本2分为发起方和响应方的委托列表
+		if version == 2 {
+			tx.DelegateIDs = append(tx.DelegateIDs, r.ids()...)
+		}
+		tx.StateHash = r.encoded(aeternity.PrefixState)
+		tx.Nonce = r.uint()
+		return tx, nil
+	case aeternity.ObjectTagChannelDepositTransaction:
+		tx := &ChannelDepositTx{}
+		tx.ChannelID = r.id()
+		tx.FromID = r.id()
+		tx.Amount = r.bigInt()
+		tx.TTL = r.uint()
+		tx.Fee = r.bigInt()
+		tx.StateHash = r.encoded(aeternity.PrefixState)
+		tx.Round = r.uint()
+		tx.Nonce = r.uint()
+		return tx, nil
+	case aeternity.ObjectTagChannelWithdrawTransaction:
+		tx := &ChannelWithdrawTx{}
+		tx.ChannelID = r.id()
+		tx.ToID = r.id()
+		tx.Amount = r.bigInt()
+		tx.TTL = r.uint()
+		tx.Fee = r.bigInt()
+		tx.StateHash = r.encoded(aeternity.PrefixState)
+		tx.Round = r.uint()
+		tx.Nonce = r.uint()
+		return tx, nil
+	case aeternity.ObjectTagChannelForceProgressTransaction:
+		tx := &ChannelForceProgressTx{}
+		tx.ChannelID = r.id()
+		tx.FromID = r.id()
+		tx.Payload = r.encoded(aeternity.PrefixTransaction)
+		tx.Round = r.uint()
+		tx.Update = hex.EncodeToString(r.bytes())
+		tx.StateHash = r.encoded(aeternity.PrefixState)
+		tx.OffChainTrees = r.encoded(aeternity.PrefixStateTrees)
+		tx.TTL = r.uint()
+		tx.Fee = r.bigInt()
+		tx.Nonce = r.uint()
+		return tx, nil
+	case aeternity.ObjectTagChannelCloseMutualTransaction:
+		tx := &ChannelCloseMutualTx{}
+		tx.ChannelID = r.id()
+		tx.FromID = r.id()
+		tx.InitiatorAmountFinal = r.bigInt()
+		tx.ResponderAmountFinal = r.bigInt()
+		tx.TTL = r.uint()
+		tx.Fee = r.bigInt()
+		tx.Nonce = r.uint()
+		return tx, nil
+	case aeternity.ObjectTagChannelCloseSoloTransaction:
+		tx := &ChannelCloseSoloTx{}
+		tx.ChannelID = r.id()
+		tx.FromID = r.id()
+		tx.Payload = r.encoded(aeternity.PrefixTransaction)
+		tx.Poi = r.encoded(aeternity.PrefixProofOfInclusion)
+		tx.TTL = r.uint()
+		tx.Fee = r.bigInt()
+		tx.Nonce = r.uint()
+		return tx, nil
+	case aeternity.ObjectTagChannelSlashTransaction:
+		tx := &ChannelSlashTx{}
+		tx.ChannelID = r.id()
+		tx.FromID = r.id()
+		tx.Payload = r.encoded(aeternity.PrefixTransaction)
+		tx.Poi = r.encoded(aeternity.PrefixProofOfInclusion)
+		tx.TTL = r.uint()
+		tx.Fee = r.bigInt()
+		tx.Nonce = r.uint()
+		return tx, nil
+	case aeternity.ObjectTagChannelSettleTransaction:
+		tx := &ChannelSettleTx{}
+		tx.ChannelID = r.id()
+		tx.FromID = r.id()
+		tx.InitiatorAmountFinal = r.bigInt()
+		tx.ResponderAmountFinal = r.bigInt()
+		tx.TTL = r.uint()
+		tx.Fee = r.bigInt()
+		tx.Nonce = r.uint()
+		return tx, nil
+	case aeternity.ObjectTagChannelSnapshotTransaction:
+		tx := &ChannelSnapshotSoloTx{}
+		tx.ChannelID = r.id()
+		tx.FromID = r.id()
+		tx.Payload = r.encoded(aeternity.PrefixTransaction)
+		tx.TTL = r.uint()
+		tx.Fee = r.bigInt()
+		tx.Nonce = r.uint()
+		return tx, nil
+	case aeternity.ObjectTagChannelOffChainTransaction:
+		tx := &ChannelOffChainTx{}
+		tx.ChannelID = r.id()
+		tx.Round = r.uint()
+		//版本1在状态哈希前还有状态更新列表，版本2去掉了
+		if version == 1 {
+			r.list()
+		}
+		tx.StateHash = r.encoded(aeternity.PrefixState)
+		return tx, nil
+	case ObjectTagGAAttachTransaction:
+		tx := &GAAttachTx{}
+		tx.OwnerID = r.id()
+		tx.AccountNonce = r.uint()
+		tx.Code = r.encoded(aeternity.PrefixContractByteArray)
+		tx.AuthFunc = hex.EncodeToString(r.bytes())
+		tx.VMVersion, tx.AbiVersion = r.ctVersion()
+		tx.Fee = r.bigInt()
+		tx.TTL = r.uint()
+		tx.Gas = r.bigInt()
+		tx.GasPrice = r.bigInt()
+		tx.CallData = r.encoded(aeternity.PrefixContractByteArray)
+		return tx, nil
+	case ObjectTagGAMetaTransaction:
+		tx := &GAMetaTx{}
+		tx.GAID = r.id()
+		tx.AuthData = r.encoded(aeternity.PrefixContractByteArray)
+		tx.AbiVersion = uint16(r.uint())
+		tx.Fee = r.bigInt()
+		tx.Gas = r.bigInt()
+		tx.GasPrice = r.bigInt()
+		//版本2去掉了ttl
+		if version == 1 {
+			tx.TTL = r.uint()
+		}
+		innerRaw := r.bytes()
+		if r.err != nil {
+			return tx, nil
+		}
+		innerTx, err := DecodeRLPTransaction(innerRaw)
+		if err != nil {
+			return nil, fmt.Errorf("inner transaction of GAMetaTx: %v", err)
+		}
+		tx.Tx = innerTx
+		return tx, nil
+	case ObjectTagPayingForTransaction:
+		tx := &PayingForTx{}
+		tx.PayerID = r.id()
+		tx.Nonce = r.uint()
+		tx.Fee = r.bigInt()
+		tx.Tx = r.bytes()
+		if r.err != nil {
+			return tx, nil
+		}
+		innerTx, err := DecodeRLPTransaction(tx.Tx)
+		if err != nil {
+			return nil, fmt.Errorf("inner transaction of PayingForTx: %v", err)
+		}
+		tx.InnerTx = innerTx
+		return tx, nil
+	default:
+		return nil, fmt.Errorf("object tag %d is not supported", tag)
+	}
+}
+
+//NameUpdateTx 更新域名指针，指针按RLP中的顺序保存。
+//SDK的NameUpdateTx编码时会反转指针顺序，这里先反转一次，重新编码得到相同的交易单
+type NameUpdateTx struct {
+	aeternity.NameUpdateTx
+}
+
+//RLP 交易单的RLP编码
+func (tx *NameUpdateTx) RLP() ([]byte, error) {
+	sdkTx := tx.NameUpdateTx
+	sdkTx.Pointers = make([]*aeternity.NamePointer, len(tx.Pointers))
+	for i, pointer := range tx.Pointers {
+		sdkTx.Pointers[len(tx.Pointers)-1-i] = pointer
+	}
+	return sdkTx.RLP()
+}
+
+//decodeNamePointers 按RLP中的顺序解码NameUpdateTx的指针
+func decodeNamePointers(r *rlpFieldReader) []*aeternity.NamePointer {
+	list := r.list()
+	pointers := make([]*aeternity.NamePointer, len(list))
+	for i, v := range list {
+		pointer, ok := v.([]interface{})
+		if !ok || len(pointer) != 2 {
+			r.fail(fmt.Errorf("name pointer is invalid"))
+			return nil
+		}
+		key, err := rlpBytes(pointer[0])
+		if err != nil {
+			r.fail(err)
+			return nil
+		}
+		id, err := rlpID(pointer[1])
+		if err != nil {
+			r.fail(err)
+			return nil
+		}
+		pointers[i] = aeternity.NewNamePointer(string(key), id)
+	}
+	return pointers
+}
+
+//decodeSpendTx 解码SpendTx的字段
+func decodeSpendTx(r *rlpFieldReader) *aeternity.SpendTx {
+	tx := &aeternity.SpendTx{}
+	tx.SenderID = r.id()
+	tx.RecipientID = r.id()
+	tx.Amount = r.bigInt()
+	tx.Fee = r.bigInt()
+	tx.TTL = r.uint()
+	tx.Nonce = r.uint()
+	tx.Payload = r.str()
+	return tx
+}
+
+//decodeContractCallTx 解码ContractCallTx的字段
+func decodeContractCallTx(r *rlpFieldReader) *aeternity.ContractCallTx {
+	tx := &aeternity.ContractCallTx{}
+	tx.CallerID = r.id()
+	tx.AccountNonce = r.uint()
+	tx.ContractID = r.id()
+	tx.AbiVersion = uint16(r.uint())
+	tx.Fee = r.bigInt()
+	tx.TTL = r.uint()
+	tx.Amount = r.bigInt()
+	tx.Gas = r.bigInt()
+	tx.GasPrice = r.bigInt()
+	tx.CallData = r.encoded(aeternity.PrefixContractByteArray)
+	return tx
+}
+
+//decodeUnsignedTx 解码未签名的交易单
+func decodeUnsignedTx(raw []byte) (aeternity.Tx, error) {
+	decoded, err := DecodeRLPTransaction(raw)
+	if err != nil {
+		return nil, err
+	}
+	if decoded.Tag == aeternity.ObjectTagSignedTransaction {
+		return nil, fmt.Errorf("transaction is signed")
+	}
+	tx, ok := decoded.Tx.(aeternity.Tx)
+	if !ok {
+		return nil, fmt.Errorf("%s can not be encoded", decoded.Type)
+	}
+	return tx, nil
+}
@@ -0,0 +1,206 @@
+package aeternity
+
+import (
+	"encoding/hex"
+	"github.com/aeternity/aepp-sdk-go/aeternity"
+	"math/big"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeUnsignedTx(t *testing.T) {
+
+	sender := "ak_qcqXt6ySgRPvBkNwEpNMvaKWzrhPZsoBHLvgg68qg9vRht62y"
+	contract := "ct_2U1usf3A8ZNUcZLkZe5rEoBTxk7eJvk9fcbRDNqmRiwXCHAYN"
+
+	spendTx := aeternity.NewSpendTx(sender, sender, *big.NewInt(1000), *big.NewInt(20000000000000), "memo", 500, 7)
+	txRaw, _ := spendTx.RLP()
+	signedTx, _ := createSignedTransaction(txRaw, [][]byte{make([]byte, signatureLength)})
+
+	signatures, unsigned, err := decodeSignedTx(signedTx)
+	if err != nil || len(signatures) != 1 || !reflect.DeepEqual(unsigned, txRaw) {
+		t.Errorf("decodeSignedTx = %v, %x, %v", signatures, unsigned, err)
+	}
+
+	decoded, err := decodeUnsignedTx(txRaw)
+	if err != nil {
+		t.Errorf("decodeUnsignedTx error: %v", err)
+		return
+	}
+	if !reflect.DeepEqual(decoded, &spendTx) {
+		t.Errorf("decodeUnsignedTx = %+v, want %+v", decoded, spendTx)
+	}
+
+	callData, _ := aex9ACI.EncodeCall("transfer", sender, big.NewInt(100))
+	callTx := aeternity.NewContractCallTx(sender, 3, contract, *big.NewInt(0), *big.NewInt(50000), *big.NewInt(1000000000), fateABIVersion, callData, *big.NewInt(20000000000000), 500)
+	txRaw, _ = callTx.RLP()
+	decoded, err = decodeUnsignedTx(txRaw)
+	if err != nil {
+		t.Errorf("decodeUnsignedTx error: %v", err)
+		return
+	}
+	decodedCall := decoded.(*aeternity.ContractCallTx)
+	if decodedCall.CallerID != sender || decodedCall.ContractID != contract || decodedCall.CallData != callData ||
+		decodedCall.Gas.Cmp(&callTx.Gas) != 0 || decodedCall.Fee.Cmp(&callTx.Fee) != 0 || decodedCall.AccountNonce != 3 {
+		t.Errorf("decodeUnsignedTx = %+v, want %+v", decodedCall, callTx)
+	}
+
+	if _, err := decodeUnsignedTx(signedTx); err == nil {
+		t.Errorf("decodeUnsignedTx of signed transaction should fail")
+	}
+}
+
+func TestDecodeRLPTransaction(t *testing.T) {
+
+	account := "ak_qcqXt6ySgRPvBkNwEpNMvaKWzrhPZsoBHLvgg68qg9vRht62y"
+	fee := *big.NewInt(20000000000000)
+
+	nameUpdateTx := aeternity.NewNameUpdateTx(account, "nm_2sFnPHi5ziAqhdApSpRBsYdomCahtmk3YGNZKYUTtUNpVSMccC", []string{account, "ok_qcqXt6ySgRPvBkNwEpNMvaKWzrhPZsoBHLvgg68qg9vRht62y"}, 50000, 3600, fee, 500, 8)
+	callData, _ := aex9ACI.EncodeCall("transfer", account, big.NewInt(100))
+	contractCreateTx := aeternity.NewContractCreateTx(account, 9, callData, 5, 3, *big.NewInt(0), *big.NewInt(0), *big.NewInt(50000), *big.NewInt(1000000000), fee, 500, callData)
+	oracleRegisterTx := aeternity.NewOracleRegisterTx(account, 10, "query", "response", *big.NewInt(100), 0, 100, 0, fee, 500)
+
+	txs := []aeternity.Tx{&nameUpdateTx, &contractCreateTx, &oracleRegisterTx}
+	for _, tx := range txs {
+		txRaw, _ := tx.RLP()
+		decoded, err := DecodeRLPTransaction(txRaw)
+		if err != nil {
+			t.Errorf("DecodeRLPTransaction %T error: %v", tx, err)
+			continue
+		}
+		reRaw, _ := decoded.Tx.(aeternity.Tx).RLP()
+		if !reflect.DeepEqual(reRaw, txRaw) {
+			t.Errorf("DecodeRLPTransaction %s does not encode to the same RLP", decoded.Type)
+		}
+	}
+
+	//状态通道的交易单SDK没有定义，按字段顺序构造
+	channelID := aeternity.Encode(aeternity.PrefixChannel, make([]byte, 32))
+	cID, _ := buildIDTag(aeternity.IDTagChannel, channelID)
+	aID, _ := buildIDTag(aeternity.IDTagAccount, account)
+	depositRaw, _ := buildRLPMessage(aeternity.ObjectTagChannelDepositTransaction, 1, cID, aID, *big.NewInt(1000), uint64(0), fee, make([]byte, 32), uint64(2), uint64(11))
+	decoded, err := DecodeRLPTransaction(depositRaw)
+	if err != nil {
+		t.Errorf("DecodeRLPTransaction ChannelDepositTx error: %v", err)
+		return
+	}
+	deposit, ok := decoded.Tx.(*ChannelDepositTx)
+	if !ok || deposit.ChannelID != channelID || deposit.FromID != account || deposit.Amount.Int64() != 1000 || deposit.Round != 2 || deposit.Nonce != 11 {
+		t.Errorf("DecodeRLPTransaction ChannelDepositTx = %+v", decoded.Tx)
+	}
+
+	//链上的ChannelOffChainTx是版本2，没有状态更新列表
+	offChainRaw, _ := buildRLPMessage(aeternity.ObjectTagChannelOffChainTransaction, 2, cID, uint64(5), make([]byte, 32))
+	decoded, err = DecodeRLPTransaction(offChainRaw)
+	if err != nil {
+		t.Errorf("DecodeRLPTransaction ChannelOffChainTx error: %v", err)
+		return
+	}
+	offChain, ok := decoded.Tx.(*ChannelOffChainTx)
+	if !ok || offChain.ChannelID != channelID || offChain.Round != 5 || offChain.StateHash != aeternity.Encode(aeternity.PrefixState, make([]byte, 32)) {
+		t.Errorf("DecodeRLPTransaction ChannelOffChainTx = %+v", decoded.Tx)
+	}
+
+	//字段数量不对
+	badRaw, _ := buildRLPMessage(aeternity.ObjectTagChannelDepositTransaction, 1, cID, aID, *big.NewInt(1000))
+	if _, err := DecodeRLPTransaction(badRaw); err == nil {
+		t.Errorf("DecodeRLPTransaction of short ChannelDepositTx should fail")
+	}
+}
+
+func TestDecodeNameUpdateTxPointers(t *testing.T) {
+
+	account := "ak_qcqXt6ySgRPvBkNwEpNMvaKWzrhPZsoBHLvgg68qg9vRht62y"
+	other := "ak_2a1j2Mk9YSmC1gioUq4PWRm3bsv887MbuRVwyv4KaUGoR1eiKi"
+	third := "ak_2iBPH7HUz3cSDVEUWiHg76MZJ6tZooVNBmmxcgVK6VV8KAE688"
+
+	//SDK编码时反转指针，RLP中的顺序是third、other、account
+	nameUpdateTx := aeternity.NewNameUpdateTx(account, "nm_2sFnPHi5ziAqhdApSpRBsYdomCahtmk3YGNZKYUTtUNpVSMccC", []string{account, other, third}, 50000, 3600, *big.NewInt(20000000000000), 500, 8)
+	txRaw, _ := nameUpdateTx.RLP()
+	decoded, err := DecodeRLPTransaction(txRaw)
+	if err != nil {
+		t.Errorf("DecodeRLPTransaction error: %v", err)
+		return
+	}
+	tx, ok := decoded.Tx.(*NameUpdateTx)
+	if !ok || len(tx.Pointers) != 3 {
+		t.Errorf("DecodeRLPTransaction = %+v", decoded.Tx)
+		return
+	}
+	want := []string{third, other, account}
+	for i, pointer := range tx.Pointers {
+		if *pointer.ID != want[i] {
+			t.Errorf("pointer %d = %s, want %s", i, *pointer.ID, want[i])
+		}
+	}
+
+	reRaw, err := tx.RLP()
+	if err != nil || !reflect.DeepEqual(reRaw, txRaw) {
+		t.Errorf("NameUpdateTx does not encode to the same RLP: %v", err)
+	}
+}
+
+func TestDecodeTransaction(t *testing.T) {
+
+	sender := "ak_qcqXt6ySgRPvBkNwEpNMvaKWzrhPZsoBHLvgg68qg9vRht62y"
+	spendTx := aeternity.NewSpendTx(sender, sender, *big.NewInt(1000), *big.NewInt(20000000000000), "memo", 500, 7)
+	txRaw, _ := spendTx.RLP()
+	signedTx, _ := createSignedTransaction(txRaw, [][]byte{make([]byte, signatureLength)})
+	payingForTx, _ := NewPayingForTx(sender, 8, nil, signedTx)
+	payingForRaw, _ := payingForTx.RLP()
+	signedPayingFor, _ := createSignedTransaction(payingForRaw, [][]byte{make([]byte, signatureLength)})
+
+	for _, encoded := range []string{aeternity.Encode(aeternity.PrefixTransaction, signedPayingFor), "0x" + hex.EncodeToString(signedPayingFor)} {
+		decoded, err := DecodeTransaction(encoded)
+		if err != nil {
+			t.Errorf("DecodeTransaction error: %v", err)
+			continue
+		}
+		if decoded.Type != "SignedTx" || len(decoded.Signatures) != 1 || decoded.Hash != CalcTxHash(signedPayingFor) {
+			t.Errorf("DecodeTransaction = %+v", decoded)
+			continue
+		}
+		payingFor, ok := decoded.Tx.(*DecodedTx).Tx.(*PayingForTx)
+		if !ok || payingFor.PayerID != sender || payingFor.Nonce != 8 {
+			t.Errorf("DecodeTransaction inner = %+v", decoded.Tx)
+			continue
+		}
+		inner := payingFor.InnerTx.(*DecodedTx).Tx.(*DecodedTx).Tx.(*aeternity.SpendTx)
+		if !reflect.DeepEqual(inner, &spendTx) {
+			t.Errorf("DecodeTransaction spend = %+v, want %+v", inner, spendTx)
+		}
+	}
+
+	if _, err := InspectTransaction("tx_invalid"); err == nil {
+		t.Errorf("InspectTransaction of invalid transaction should fail")
+	}
+}
+
+func TestTxEncoding(t *testing.T) {
+
+	sender := "ak_qcqXt6ySgRPvBkNwEpNMvaKWzrhPZsoBHLvgg68qg9vRht62y"
+	spendTx := aeternity.NewSpendTx(sender, sender, *big.NewInt(1000), *big.NewInt(20000000000000), "memo", 500, 7)
+	txRaw, _ := spendTx.RLP()
+	txHex := hex.EncodeToString(txRaw)
+	txBase64 := aeternity.Encode(aeternity.PrefixTransaction, txRaw)
+
+	if s, err := TxHexToBase64(txHex); err != nil || s != txBase64 {
+		t.Errorf("TxHexToBase64 = %s, %v, want %s", s, err, txBase64)
+	}
+	if s, err := TxBase64ToHex(txBase64); err != nil || s != txHex {
+		t.Errorf("TxBase64ToHex = %s, %v, want %s", s, err, txHex)
+	}
+	for _, encoded := range []string{txHex, "0x" + txHex, txBase64} {
+		if raw, err := DecodeRawTx(encoded); err != nil || !reflect.DeepEqual(raw, txRaw) {
+			t.Errorf("DecodeRawTx(%s) = %x, %v", encoded, raw, err)
+		}
+	}
+	if encodeRawTx(txRaw, true) != txBase64 || encodeRawTx(txRaw, false) != txHex {
+		t.Errorf("encodeRawTx does not match")
+	}
+
+	//校验和错误
+	if _, err := DecodeRawTx(txBase64[:len(txBase64)-1] + "A"); err == nil {
+		t.Errorf("DecodeRawTx of invalid checksum should fail")
+	}
+}
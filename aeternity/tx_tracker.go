@@ -0,0 +1,358 @@
+package aeternity
+
+import (
+	"fmt"
+	"github.com/asdine/storm"
+	"github.com/asdine/storm/q"
+	"github.com/blocktree/openwallet/openwallet"
+	"github.com/blocktree/openwallet/timer"
+	"strings"
+	"sync"
+	"time"
+)
+
+//已提交交易单的状态变化事件
+const (
+	trackEventMined     = "mined"
+	trackEventFinalized = "finalized"
+	trackEventDropped   = "dropped"
+)
+
+//TxLifecycleObserver 已提交交易单的状态观察者
+type TxLifecycleObserver interface {
+	//TxMined 交易单已打包进microblock
+	TxMined(tx *TrackedTransaction)
+	//TxFinalized 交易单所在keyblock之后已产生足够的keyblock
+	TxFinalized(tx *TrackedTransaction)
+	//TxDropped 交易单被节点丢弃或ttl过期，不会再上链
+	TxDropped(tx *TrackedTransaction)
+}
+
+//txLocation 节点返回的交易单位置
+type txLocation struct {
+	Found       bool   //节点是否有该交易单
+	BlockHash   string //所在的microblock
+	BlockHeight int64  //所在的keyblock高度，-1表示在交易池中
+}
+
+//TxTracker 已提交交易单的跟踪器，定时查询节点，交易单上链、最终确认或被丢弃时通知观察者
+//跟踪记录保存在本地数据库，程序重启后继续跟踪
+type TxTracker struct {
+	wm           *WalletManager
+	mu           sync.RWMutex
+	dbMu         sync.Mutex //跟踪记录的读写锁，跟踪器和卡住交易单服务都会修改记录
+	observers    map[TxLifecycleObserver]bool
+	trackTask    *timer.TaskTimer
+	PeriodOfTask time.Duration
+}
+
+//NewTxTracker 创建交易单跟踪器
+func NewTxTracker(wm *WalletManager) *TxTracker {
+	return &TxTracker{
+		wm:           wm,
+		observers:    make(map[TxLifecycleObserver]bool),
+		PeriodOfTask: time.Duration(wm.Config.TrackPeriod) * time.Second,
+	}
+}
+
+//openDB 本地数据库
+func (tt *TxTracker) openDB() (*storm.DB, error) {
+	return tt.wm.openDB()
+}
+
+//AddObserver 添加观察者
+func (tt *TxTracker) AddObserver(obj TxLifecycleObserver) error {
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+
+	if obj == nil {
+		return nil
+	}
+	tt.observers[obj] = true
+	return nil
+}
+
+//RemoveObserver 移除观察者
+func (tt *TxTracker) RemoveObserver(obj TxLifecycleObserver) error {
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+
+	delete(tt.observers, obj)
+	return nil
+}
+
+//Track 跟踪已广播的交易单
+func (tt *TxTracker) Track(rawTx *openwallet.RawTransaction) error {
+
+	if len(rawTx.TxID) == 0 {
+		return fmt.Errorf("transaction id is empty")
+	}
+
+	tracked := &TrackedTransaction{
+		TxID:       rawTx.TxID,
+		Nonce:      rawTx.GetExtParam().Get("nonce").Uint(),
+		TTL:        rawTx.GetExtParam().Get("ttl").Uint(),
+		RawHex:     rawTx.RawHex,
+		AccountID:  rawTx.Account.AccountID,
+		Status:     TrackStatusPending,
+		SubmitTime: time.Now().Unix(),
+		Coin:       rawTx.Coin,
+		TxFrom:     rawTx.TxFrom,
+		TxTo:       rawTx.TxTo,
+		TxAmount:   rawTx.TxAmount,
+		Fees:       rawTx.Fees,
+		Memo:       rawTx.GetExtParam().Get("memo").String(),
+	}
+	if len(rawTx.TxFrom) > 0 {
+		tracked.Address = strings.Split(rawTx.TxFrom[0], ":")[0]
+	}
+	if payingFor, _ := getPayingForInfo(rawTx); payingFor != nil {
+		tracked.PayerAddress = payingFor.Payer
+		tracked.PayerNonce = payingFor.Nonce
+	}
+	tracked.UpdateTime = tracked.SubmitTime
+	tracked.LastActionTime = tracked.SubmitTime
+
+	tt.dbMu.Lock()
+	defer tt.dbMu.Unlock()
+
+	db, err := tt.openDB()
+	if err != nil {
+		return err
+	}
+
+	//重复提交的交易单保留原跟踪记录
+	var existed TrackedTransaction
+	if err := db.One("TxID", tracked.TxID, &existed); err == nil {
+		return nil
+	}
+
+	return db.Save(tracked)
+}
+
+//modify 读取跟踪记录，由fn修改后保存，fn返回false时不保存
+func (tt *TxTracker) modify(txid string, fn func(tracked *TrackedTransaction) bool) (*TrackedTransaction, error) {
+
+	tt.dbMu.Lock()
+	defer tt.dbMu.Unlock()
+
+	db, err := tt.openDB()
+	if err != nil {
+		return nil, err
+	}
+
+	var tracked TrackedTransaction
+	err = db.One("TxID", txid, &tracked)
+	if err != nil {
+		return nil, err
+	}
+
+	if !fn(&tracked) {
+		return &tracked, nil
+	}
+	tracked.UpdateTime = time.Now().Unix()
+
+	return &tracked, db.Save(&tracked)
+}
+
+//markReplaced 交易单已被相同nonce的交易单替换，不再跟踪
+func (tt *TxTracker) markReplaced(txid, replacedBy string) error {
+	_, err := tt.modify(txid, func(tracked *TrackedTransaction) bool {
+		if tracked.IsTerminal() {
+			return false
+		}
+		tracked.Status = TrackStatusReplaced
+		tracked.ReplacedBy = replacedBy
+		return true
+	})
+	return err
+}
+
+//GetTrackedTransaction 查询跟踪中的交易单
+func (tt *TxTracker) GetTrackedTransaction(txid string) (*TrackedTransaction, error) {
+
+	db, err := tt.openDB()
+	if err != nil {
+		return nil, err
+	}
+
+	var tracked TrackedTransaction
+	err = db.One("TxID", txid, &tracked)
+	if err != nil {
+		return nil, err
+	}
+	return &tracked, nil
+}
+
+//Run 启动定时跟踪，由调用方启动，加载配置不会启动。修改查询间隔后需要Stop再Run
+func (tt *TxTracker) Run() error {
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+
+	if tt.trackTask != nil && tt.trackTask.Running() {
+		return nil
+	}
+	tt.trackTask = timer.NewTask(tt.PeriodOfTask, tt.poll)
+	tt.trackTask.Start()
+	return nil
+}
+
+//Stop 停止定时跟踪
+func (tt *TxTracker) Stop() error {
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+
+	if tt.trackTask != nil {
+		tt.trackTask.Stop()
+		tt.trackTask = nil
+	}
+	return nil
+}
+
+//poll 查询所有未结束的交易单
+func (tt *TxTracker) poll() {
+
+	height, err := tt.wm.Blockscanner.GetBlockHeight()
+	if err != nil {
+		tt.wm.Log.Errorf("get block height failed: %v", err)
+		return
+	}
+
+	db, err := tt.openDB()
+	if err != nil {
+		tt.wm.Log.Errorf("open db failed: %v", err)
+		return
+	}
+
+	var trackedArray []*TrackedTransaction
+	err = db.Select(q.In("Status", []string{TrackStatusPending, TrackStatusMined})).Find(&trackedArray)
+	if err != nil && err != storm.ErrNotFound {
+		tt.wm.Log.Errorf("load tracked transactions failed: %v", err)
+		return
+	}
+
+	for _, tracked := range trackedArray {
+		if err := tt.update(tracked, height); err != nil {
+			tt.wm.Log.Errorf("track transaction %s failed: %v", tracked.TxID, err)
+		}
+	}
+}
+
+//update 查询交易单的位置，保存新的状态并通知观察者
+func (tt *TxTracker) update(tracked *TrackedTransaction, height uint64) error {
+
+	found, blockHash, blockHeight, err := tt.wm.GetTransactionLocation(tracked.TxID)
+	if err != nil {
+		return err
+	}
+
+	var events []string
+	tracked, err = tt.modify(tracked.TxID, func(t *TrackedTransaction) bool {
+		events = nextTrackStatus(t, txLocation{
+			Found:       found,
+			BlockHash:   blockHash,
+			BlockHeight: blockHeight,
+		}, height, tt.wm.Config.FinalConfirmations)
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, event := range events {
+		tt.wm.Log.Infof("transaction %s %s at height %d", tracked.TxID, event, height)
+		if event == trackEventDropped {
+			tt.releaseNonce(tracked)
+		}
+		tt.notify(event, tracked)
+	}
+
+	return nil
+}
+
+//releaseNonce 被丢弃的交易单不再占用nonce，代付交易单还要释放代付地址的nonce
+func (tt *TxTracker) releaseNonce(tracked *TrackedTransaction) {
+	if len(tracked.Address) > 0 {
+		if err := tt.wm.NonceManager.ReleaseNonce(tracked.Address, tracked.Nonce); err != nil {
+			tt.wm.Log.Errorf("release nonce %d of address %s failed: %v", tracked.Nonce, tracked.Address, err)
+		}
+	}
+	if len(tracked.PayerAddress) > 0 {
+		if err := tt.wm.NonceManager.ReleaseNonce(tracked.PayerAddress, tracked.PayerNonce); err != nil {
+			tt.wm.Log.Errorf("release nonce %d of address %s failed: %v", tracked.PayerNonce, tracked.PayerAddress, err)
+		}
+	}
+}
+
+//notify 通知观察者
+func (tt *TxTracker) notify(event string, tracked *TrackedTransaction) {
+	tt.mu.RLock()
+	defer tt.mu.RUnlock()
+
+	for o := range tt.observers {
+		switch event {
+		case trackEventMined:
+			o.TxMined(tracked)
+		case trackEventFinalized:
+			o.TxFinalized(tracked)
+		case trackEventDropped:
+			o.TxDropped(tracked)
+		}
+	}
+}
+
+//nextTrackStatus 按节点返回的位置和当前keyblock高度更新交易单的状态，返回产生的事件
+//microblock分叉时已打包的交易单可能回到交易池，此时状态回到pending，再次打包时重新产生mined事件
+func nextTrackStatus(tracked *TrackedTransaction, location txLocation, height, finalConfirmations uint64) []string {
+
+	events := make([]string, 0)
+
+	if tracked.IsTerminal() {
+		return events
+	}
+
+	//节点查询不到，可能是节点暂时没有同步交易池，只有已过ttl才视为被丢弃，
+	//避免释放nonce后交易单又上链。ttl为0的交易单不会过期
+	if !location.Found {
+		tracked.MissCount++
+		if tracked.TTL > 0 && height > tracked.TTL {
+			tracked.Status = TrackStatusDropped
+			events = append(events, trackEventDropped)
+		}
+		return events
+	}
+	tracked.MissCount = 0
+
+	//在交易池中
+	if location.BlockHeight < 0 {
+		tracked.BlockHash = ""
+		tracked.BlockHeight = 0
+		tracked.Confirmations = 0
+		tracked.Status = TrackStatusPending
+		if tracked.TTL > 0 && height > tracked.TTL {
+			tracked.Status = TrackStatusDropped
+			events = append(events, trackEventDropped)
+		}
+		return events
+	}
+
+	if tracked.Status == TrackStatusPending || tracked.BlockHash != location.BlockHash {
+		tracked.Status = TrackStatusMined
+		tracked.BlockHash = location.BlockHash
+		tracked.BlockHeight = uint64(location.BlockHeight)
+		events = append(events, trackEventMined)
+	}
+
+	if height > tracked.BlockHeight {
+		tracked.Confirmations = height - tracked.BlockHeight
+	} else {
+		tracked.Confirmations = 0
+	}
+
+	if tracked.Confirmations >= finalConfirmations {
+		tracked.Status = TrackStatusFinalized
+		events = append(events, trackEventFinalized)
+	}
+
+	return events
+}
@@ -0,0 +1,161 @@
+package aeternity
+
+import (
+	"fmt"
+	"github.com/astaxie/beego/config"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestNextTrackStatus(t *testing.T) {
+
+	tracked := &TrackedTransaction{TxID: "th_test", TTL: 150, Status: TrackStatusPending}
+
+	//在交易池中
+	events := nextTrackStatus(tracked, txLocation{Found: true, BlockHeight: -1}, 100, 3)
+	if len(events) != 0 || tracked.Status != TrackStatusPending {
+		t.Errorf("pending: events = %v, status = %s", events, tracked.Status)
+	}
+
+	//已打包
+	events = nextTrackStatus(tracked, txLocation{Found: true, BlockHash: "mh_1", BlockHeight: 101}, 101, 3)
+	if !reflect.DeepEqual(events, []string{trackEventMined}) || tracked.Status != TrackStatusMined {
+		t.Errorf("mined: events = %v, status = %s", events, tracked.Status)
+	}
+
+	//microblock分叉，回到交易池
+	events = nextTrackStatus(tracked, txLocation{Found: true, BlockHeight: -1}, 102, 3)
+	if len(events) != 0 || tracked.Status != TrackStatusPending || tracked.BlockHash != "" {
+		t.Errorf("fork: events = %v, status = %s", events, tracked.Status)
+	}
+
+	//重新打包后达到最终确认
+	events = nextTrackStatus(tracked, txLocation{Found: true, BlockHash: "mh_2", BlockHeight: 102}, 105, 3)
+	if !reflect.DeepEqual(events, []string{trackEventMined, trackEventFinalized}) || tracked.Status != TrackStatusFinalized {
+		t.Errorf("finalized: events = %v, status = %s", events, tracked.Status)
+	}
+	if tracked.Confirmations != 3 || tracked.BlockHeight != 102 {
+		t.Errorf("finalized: confirmations = %d, height = %d", tracked.Confirmations, tracked.BlockHeight)
+	}
+
+	//最终状态不再变化
+	events = nextTrackStatus(tracked, txLocation{Found: false}, 200, 3)
+	if len(events) != 0 || tracked.Status != TrackStatusFinalized {
+		t.Errorf("terminal: events = %v, status = %s", events, tracked.Status)
+	}
+}
+
+func TestNextTrackStatus_Dropped(t *testing.T) {
+
+	//连续查询不到，ttl未过期时继续跟踪
+	tracked := &TrackedTransaction{TxID: "th_test", TTL: 150, Status: TrackStatusPending}
+	for i := 1; i <= 5; i++ {
+		if events := nextTrackStatus(tracked, txLocation{Found: false}, 100, 3); len(events) != 0 || tracked.Status != TrackStatusPending {
+			t.Errorf("miss %d: events = %v, status = %s", i, events, tracked.Status)
+		}
+	}
+	if tracked.MissCount != 5 {
+		t.Errorf("miss count = %d", tracked.MissCount)
+	}
+
+	//查询不到并且ttl已过期
+	events := nextTrackStatus(tracked, txLocation{Found: false}, 151, 3)
+	if !reflect.DeepEqual(events, []string{trackEventDropped}) || tracked.Status != TrackStatusDropped {
+		t.Errorf("missing: events = %v, status = %s", events, tracked.Status)
+	}
+
+	//ttl为0的交易单不会过期
+	tracked = &TrackedTransaction{TxID: "th_test", Status: TrackStatusPending}
+	if events := nextTrackStatus(tracked, txLocation{Found: false}, 1000, 3); len(events) != 0 {
+		t.Errorf("no ttl: events = %v", events)
+	}
+
+	//在交易池中但ttl已过期
+	tracked = &TrackedTransaction{TxID: "th_test", TTL: 150, Status: TrackStatusPending}
+	events = nextTrackStatus(tracked, txLocation{Found: true, BlockHeight: -1}, 151, 3)
+	if !reflect.DeepEqual(events, []string{trackEventDropped}) || tracked.Status != TrackStatusDropped {
+		t.Errorf("expired: events = %v, status = %s", events, tracked.Status)
+	}
+}
+
+func TestTxTracker_DroppedReleaseNonce(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "tracker")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	//节点查询不到交易单
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"reason":"Transaction not found"}`, http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	wm := NewWalletManager()
+	wm.Config.dbPath = dir
+	wm.client = NewClient(server.URL, false)
+
+	sender := "ak_qcqXt6ySgRPvBkNwEpNMvaKWzrhPZsoBHLvgg68qg9vRht62y"
+	payer := "ak_2a1j2Mk9YSmC1gioUq4PWRm3bsv887MbuRVwyv4KaUGoR1eiKi"
+
+	db, err := wm.openDB()
+	if err != nil {
+		t.Fatalf("openDB error: %v", err)
+	}
+	tracked := &TrackedTransaction{
+		TxID:         "th_test",
+		Address:      sender,
+		Nonce:        4,
+		TTL:          150,
+		PayerAddress: payer,
+		PayerNonce:   9,
+		Status:       TrackStatusPending,
+	}
+	for _, obj := range []interface{}{tracked, NewNonceReservation(sender, 4, 150), NewNonceReservation(payer, 9, 150)} {
+		if err := db.Save(obj); err != nil {
+			t.Fatalf("Save error: %v", err)
+		}
+	}
+
+	//ttl过期后被丢弃，发送地址和代付地址的nonce都要释放
+	if err := wm.TxTracker.update(tracked, 151); err != nil {
+		t.Fatalf("update error: %v", err)
+	}
+	for _, address := range []string{sender, payer} {
+		reservations, err := wm.NonceManager.GetReservations(address)
+		if err != nil || len(reservations) != 0 {
+			t.Errorf("reservations of %s = %v, %v, want none", address, reservations, err)
+		}
+	}
+}
+
+func TestLoadAssetsConfigDoesNotStartServices(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	c, err := config.NewConfigData("ini", []byte(fmt.Sprintf("dataDir = %s\ntrackPeriod = 5\nreplaceStuckTx = true\n", dir)))
+	if err != nil {
+		t.Fatalf("NewConfigData error: %v", err)
+	}
+
+	//加载配置只读取参数，不启动后台查询节点的服务
+	wm := NewWalletManager()
+	if err := wm.LoadAssetsConfig(c); err != nil {
+		t.Fatalf("LoadAssetsConfig error: %v", err)
+	}
+	if wm.TxTracker.trackTask != nil || wm.StuckTxService.stuckTask != nil {
+		t.Errorf("LoadAssetsConfig should not start the tracker services")
+	}
+	if wm.TxTracker.PeriodOfTask.Seconds() != 5 || wm.StuckTxService.PeriodOfTask.Seconds() != 5 {
+		t.Errorf("period of task = %v, %v, want 5s", wm.TxTracker.PeriodOfTask, wm.StuckTxService.PeriodOfTask)
+	}
+}
@@ -0,0 +1,155 @@
+package aeternity
+
+import (
+	"math/big"
+)
+
+//以下交易单类型SDK没有定义，只用于解码
+
+const (
+	//ObjectTagGAAttachTransaction GAAttachTx的RLP标签
+	ObjectTagGAAttachTransaction uint = 80
+	//ObjectTagGAMetaTransaction GAMetaTx的RLP标签
+	ObjectTagGAMetaTransaction uint = 81
+)
+
+//ChannelCreateTx 创建状态通道
+type ChannelCreateTx struct {
+	InitiatorID     string
+	InitiatorAmount big.Int
+	ResponderID     string
+	ResponderAmount big.Int
+	ChannelReserve  big.Int
+	LockPeriod      uint64
+	TTL             uint64
+	Fee             big.Int
+	DelegateIDs     []string
+	StateHash       string
+	Nonce           uint64
+}
+
+//ChannelDepositTx 向状态通道存入
+type ChannelDepositTx struct {
+	ChannelID string
+	FromID    string
+	Amount    big.Int
+	TTL       uint64
+	Fee       big.Int
+	StateHash string
+	Round     uint64
+	Nonce     uint64
+}
+
+//ChannelWithdrawTx 从状态通道取出
+type ChannelWithdrawTx struct {
+	ChannelID string
+	ToID      string
+	Amount    big.Int
+	TTL       uint64
+	Fee       big.Int
+	StateHash string
+	Round     uint64
+	Nonce     uint64
+}
+
+//ChannelForceProgressTx 链上强制推进状态通道
+type ChannelForceProgressTx struct {
+	ChannelID     string
+	FromID        string
+	Payload       string
+	Round         uint64
+	Update        string
+	StateHash     string
+	OffChainTrees string
+	TTL           uint64
+	Fee           big.Int
+	Nonce         uint64
+}
+
+//ChannelCloseMutualTx 双方协商关闭状态通道
+type ChannelCloseMutualTx struct {
+	ChannelID            string
+	FromID               string
+	InitiatorAmountFinal big.Int
+	ResponderAmountFinal big.Int
+	TTL                  uint64
+	Fee                  big.Int
+	Nonce                uint64
+}
+
+//ChannelCloseSoloTx 单方关闭状态通道
+type ChannelCloseSoloTx struct {
+	ChannelID string
+	FromID    string
+	Payload   string
+	Poi       string
+	TTL       uint64
+	Fee       big.Int
+	Nonce     uint64
+}
+
+//ChannelSlashTx 单方关闭期间提交更新的状态
+type ChannelSlashTx struct {
+	ChannelID string
+	FromID    string
+	Payload   string
+	Poi       string
+	TTL       uint64
+	Fee       big.Int
+	Nonce     uint64
+}
+
+//ChannelSettleTx 结算状态通道
+type ChannelSettleTx struct {
+	ChannelID            string
+	FromID               string
+	InitiatorAmountFinal big.Int
+	ResponderAmountFinal big.Int
+	TTL                  uint64
+	Fee                  big.Int
+	Nonce                uint64
+}
+
+//ChannelSnapshotSoloTx 单方提交状态通道快照
+type ChannelSnapshotSoloTx struct {
+	ChannelID string
+	FromID    string
+	Payload   string
+	TTL       uint64
+	Fee       big.Int
+	Nonce     uint64
+}
+
+//ChannelOffChainTx 状态通道的链下交易单
+type ChannelOffChainTx struct {
+	ChannelID string
+	Round     uint64
+	StateHash string
+}
+
+//GAAttachTx 账户绑定通用账户(Generalized Account)的授权合约
+type GAAttachTx struct {
+	OwnerID      string
+	AccountNonce uint64
+	Code         string
+	AuthFunc     string
+	VMVersion    uint16
+	AbiVersion   uint16
+	Fee          big.Int
+	TTL          uint64
+	Gas          big.Int
+	GasPrice     big.Int
+	CallData     string
+}
+
+//GAMetaTx 通用账户发起的交易单，Tx为经过授权合约验证的内部交易单
+type GAMetaTx struct {
+	GAID       string
+	AuthData   string
+	AbiVersion uint16
+	Fee        big.Int
+	Gas        big.Int
+	GasPrice   big.Int
+	TTL        uint64 //版本1才有
+	Tx         *DecodedTx
+}
@@ -0,0 +1,174 @@
+package aeternity
+
+import (
+	"bytes"
+	"encoding/hex"
+	"github.com/aeternity/aepp-sdk-go/aeternity"
+	"github.com/blocktree/openwallet/common"
+	"github.com/blocktree/openwallet/openwallet"
+	"math/big"
+	"strings"
+)
+
+//verifyFailed 验证交易单失败的错误
+func verifyFailed(format string, a ...interface{}) *openwallet.Error {
+	return openwallet.Errorf(openwallet.ErrVerifyRawTransactionFailed, format, a...)
+}
+
+//checkSignatureMessage 签名消息必须是待签名的交易单消息
+func checkSignatureMessage(keySignature *openwallet.KeySignature, expected []byte) error {
+	message, err := hex.DecodeString(keySignature.Message)
+	if err != nil || !bytes.Equal(message, expected) {
+		return verifyFailed("signature message does not match the transaction")
+	}
+	return nil
+}
+
+//checkSigner 签名公钥必须对应交易单的发送地址
+func checkSigner(keySignature *openwallet.KeySignature, sender string) error {
+	if keySignature.Address == nil {
+		return verifyFailed("signature address is empty")
+	}
+	publicKey, err := hex.DecodeString(keySignature.Address.PublicKey)
+	if err != nil || len(publicKey) != 32 {
+		return verifyFailed("public key of signature address [%s] is invalid", keySignature.Address.Address)
+	}
+	signer := aeternity.Encode(aeternity.PrefixAccountPubkey, publicKey)
+	if signer != sender {
+		return verifyFailed("signer [%s] is not the sender [%s] of transaction", signer, sender)
+	}
+	if len(keySignature.Address.Address) > 0 && keySignature.Address.Address != sender {
+		return verifyFailed("signature address [%s] is not the sender [%s] of transaction", keySignature.Address.Address, sender)
+	}
+	return nil
+}
+
+//splitTxAddress 拆分TxFrom和TxTo记录的地址和数量
+func splitTxAddress(s string) (address, amount string) {
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 {
+		return parts[0], ""
+	}
+	return parts[0], parts[len(parts)-1]
+}
+
+//checkTransactionFields 检查解码后的交易单和rawTx记录的发送地址、接收地址、数量、手续费、nonce和备注一致，
+//payingForFee不为nil时为代付交易单的手续费，内部交易单的手续费必须为0，返回交易单的发送地址
+func (decoder *TransactionDecoder) checkTransactionFields(rawTx *openwallet.RawTransaction, tx aeternity.Tx, payingForFee *big.Int) (string, error) {
+
+	var (
+		sender, recipient string
+		nonce, ttl        uint64
+		amount, fee       *big.Int
+		decimals          = decoder.wm.Decimal()
+	)
+
+	if len(rawTx.To) != 1 || len(rawTx.TxFrom) != 1 || len(rawTx.TxTo) != 1 {
+		return "", verifyFailed("transaction must have one sender and one receiver")
+	}
+	var destination, amountStr string
+	for k, v := range rawTx.To {
+		destination, amountStr = k, v
+	}
+
+	switch t := tx.(type) {
+	case *aeternity.SpendTx:
+		if rawTx.Coin.IsContract {
+			return "", verifyFailed("spend transaction can not transfer token")
+		}
+		sender, recipient, nonce, ttl = t.SenderID, t.RecipientID, t.Nonce, t.TTL
+		amount, fee = &t.Amount, &t.Fee
+
+		//转账备注必须和payload一致
+		payload, err := ParseMemo(rawTx.GetExtParam().Get("memo").String())
+		if err != nil {
+			return "", verifyFailed("%v", err)
+		}
+		if !bytes.Equal(payload, []byte(t.Payload)) {
+			return "", verifyFailed("payload of transaction does not match the memo")
+		}
+	case *aeternity.ContractCallTx:
+		if !rawTx.Coin.IsContract {
+			return "", verifyFailed("contract call transaction can only transfer token")
+		}
+		if t.ContractID != rawTx.Coin.Contract.Address {
+			return "", verifyFailed("contract [%s] of transaction is not [%s]", t.ContractID, rawTx.Coin.Contract.Address)
+		}
+		if t.Amount.Sign() != 0 {
+			return "", verifyFailed("token transfer can not send %s", decoder.wm.Symbol())
+		}
+		function, args, err := aex9ACI.DecodeCall(t.CallData)
+		if err != nil || function != "transfer" || len(args) != 2 {
+			return "", verifyFailed("call data of transaction is not a token transfer")
+		}
+		callAmount, ok := args[1].(*big.Int)
+		if !ok {
+			return "", verifyFailed("call data of transaction is not a token transfer")
+		}
+		tokenDecimals, err := decoder.wm.ContractDecoder.GetTokenDecimals(rawTx.Coin.Contract)
+		if err != nil {
+			return "", openwallet.Errorf(openwallet.ErrCallFullNodeAPIFailed, "get token decimals failed: %v", err)
+		}
+		decimals = tokenDecimals
+		sender, nonce, ttl = t.CallerID, t.AccountNonce, t.TTL
+		recipient, _ = args[0].(string)
+		amount = callAmount
+		//代币转账的手续费 = fee + 燃料上限 * 燃料价格
+		fee = new(big.Int).Mul(&t.Gas, &t.GasPrice)
+		fee.Add(fee, &t.Fee)
+		if payingForFee != nil && t.Fee.Sign() != 0 {
+			return "", verifyFailed("fee of inner transaction must be 0")
+		}
+	default:
+		return "", verifyFailed("transaction type %T is not supported", tx)
+	}
+
+	//代付交易单的手续费由代付地址支付，包含内部合约调用的燃料费
+	if payingForFee != nil {
+		if _, ok := tx.(*aeternity.SpendTx); ok && fee.Sign() != 0 {
+			return "", verifyFailed("fee of inner transaction must be 0")
+		}
+		fee = payingForCost(payingForFee, tx)
+	}
+
+	if from, _ := splitTxAddress(rawTx.TxFrom[0]); from != sender {
+		return "", verifyFailed("sender [%s] of transaction is not [%s]", sender, from)
+	}
+
+	to, toAmount := splitTxAddress(rawTx.TxTo[0])
+	if recipient != destination || recipient != to {
+		return "", verifyFailed("receiver [%s] of transaction is not [%s]", recipient, destination)
+	}
+
+	if common.StringNumToBigIntWithExp(amountStr, decimals).Cmp(amount) != 0 ||
+		common.StringNumToBigIntWithExp(toAmount, decimals).Cmp(amount) != 0 {
+		return "", verifyFailed("amount [%s] of transaction is not [%s]", common.BigIntToDecimals(amount, decimals).String(), amountStr)
+	}
+
+	if common.StringNumToBigIntWithExp(rawTx.Fees, decoder.wm.Decimal()).Cmp(fee) != 0 {
+		return "", verifyFailed("fees [%s] of transaction is not [%s]", common.BigIntToDecimals(fee, decoder.wm.Decimal()).String(), rawTx.Fees)
+	}
+
+	if n := rawTx.GetExtParam().Get("nonce"); n.Exists() && n.Uint() != nonce {
+		return "", verifyFailed("nonce [%d] of transaction is not [%d]", nonce, n.Uint())
+	}
+	if t := rawTx.GetExtParam().Get("ttl"); t.Exists() && t.Uint() != ttl {
+		return "", verifyFailed("ttl [%d] of transaction is not [%d]", ttl, t.Uint())
+	}
+
+	//账户的实际转账数量：接收地址不属于账户时为转账数量，属于账户时为0，AE转账还要加上手续费
+	sent := new(big.Int)
+	if !rawTx.Coin.IsContract && payingForFee == nil {
+		sent.Set(fee)
+	}
+	sentWithAmount := new(big.Int).Add(sent, amount)
+	txAmount := common.StringNumToBigIntWithExp(strings.TrimPrefix(rawTx.TxAmount, "-"), decimals)
+	if !strings.HasPrefix(rawTx.TxAmount, "-") && txAmount.Sign() != 0 {
+		return "", verifyFailed("account amount [%s] of transaction is invalid", rawTx.TxAmount)
+	}
+	if txAmount.Cmp(sentWithAmount) != 0 && txAmount.Cmp(sent) != 0 {
+		return "", verifyFailed("account amount [%s] of transaction does not match the transaction", rawTx.TxAmount)
+	}
+
+	return sender, nil
+}
@@ -0,0 +1,81 @@
+package aeternity
+
+import (
+	"encoding/hex"
+	"github.com/aeternity/aepp-sdk-go/aeternity"
+	"github.com/blocktree/openwallet/openwallet"
+	"math/big"
+	"testing"
+)
+
+func TestCheckTransactionFields(t *testing.T) {
+
+	decoder := NewTransactionDecoder(NewWalletManager())
+	sender := "ak_qcqXt6ySgRPvBkNwEpNMvaKWzrhPZsoBHLvgg68qg9vRht62y"
+	recipient := "ak_11111111111111111111111111111111273Yts"
+
+	spendTx := aeternity.NewSpendTx(sender, recipient, *big.NewInt(1000000000000000000), *big.NewInt(20000000000000), "memo", 500, 7)
+
+	newRawTx := func() *openwallet.RawTransaction {
+		rawTx := &openwallet.RawTransaction{
+			Coin:     openwallet.Coin{Symbol: "AE"},
+			To:       map[string]string{recipient: "1"},
+			Fees:     "0.00002",
+			TxAmount: "-1.000020000000000000",
+			TxFrom:   []string{sender + ":1"},
+			TxTo:     []string{recipient + ":1"},
+		}
+		rawTx.SetExtParam("memo", "memo")
+		rawTx.SetExtParam("nonce", 7)
+		rawTx.SetExtParam("ttl", 500)
+		return rawTx
+	}
+
+	from, err := decoder.checkTransactionFields(newRawTx(), &spendTx, nil)
+	if err != nil || from != sender {
+		t.Errorf("checkTransactionFields = %s, %v", from, err)
+	}
+
+	tampers := map[string]func(rawTx *openwallet.RawTransaction){
+		"receiver": func(rawTx *openwallet.RawTransaction) { rawTx.To = map[string]string{sender: "1"} },
+		"amount":   func(rawTx *openwallet.RawTransaction) { rawTx.TxTo = []string{recipient + ":0.5"} },
+		"fees":     func(rawTx *openwallet.RawTransaction) { rawTx.Fees = "0.00001" },
+		"sender":   func(rawTx *openwallet.RawTransaction) { rawTx.TxFrom = []string{recipient + ":1"} },
+		"memo":     func(rawTx *openwallet.RawTransaction) { rawTx.SetExtParam("memo", "other") },
+		"nonce":    func(rawTx *openwallet.RawTransaction) { rawTx.SetExtParam("nonce", 8) },
+		"txAmount": func(rawTx *openwallet.RawTransaction) { rawTx.TxAmount = "-0.5" },
+	}
+	for name, tamper := range tampers {
+		rawTx := newRawTx()
+		tamper(rawTx)
+		if _, err := decoder.checkTransactionFields(rawTx, &spendTx, nil); err == nil {
+			t.Errorf("checkTransactionFields with tampered %s should fail", name)
+		}
+	}
+}
+
+func TestCheckSigner(t *testing.T) {
+
+	account, err := aeternity.AccountFromHexString("e6a91d633c77cf5771329d3354b3bcef1bc5e032c43d70b6d35af923ce1eb74dcea7ade470c9f99d9d4e400880a86f1d49bb444b62f11a9ebb64bbcfeb73fef3")
+	if err != nil {
+		t.Errorf("AccountFromHexString error: %v", err)
+		return
+	}
+
+	keySignature := &openwallet.KeySignature{
+		Address: &openwallet.Address{
+			Address:   account.Address,
+			PublicKey: hex.EncodeToString(account.SigningKey[32:]),
+		},
+		Message: hex.EncodeToString([]byte("ae_mainnet")),
+	}
+	if err := checkSigner(keySignature, account.Address); err != nil {
+		t.Errorf("checkSigner error: %v", err)
+	}
+	if err := checkSigner(keySignature, "ak_qcqXt6ySgRPvBkNwEpNMvaKWzrhPZsoBHLvgg68qg9vRht62y"); err == nil {
+		t.Errorf("checkSigner with other sender should fail")
+	}
+	if err := checkSignatureMessage(keySignature, []byte("ae_uat")); err == nil {
+		t.Errorf("checkSignatureMessage with other message should fail")
+	}
+}
@@ -0,0 +1,356 @@
+package aeternity_fate
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+//ACI类型种类
+const (
+	KindInt         = "int"
+	KindBool        = "bool"
+	KindString      = "string"
+	KindBits        = "bits"
+	KindUnit        = "unit"
+	KindAddress     = "address"
+	KindContract    = "contract"
+	KindOracle      = "oracle"
+	KindOracleQuery = "oracle_query"
+	KindBytes       = "bytes"
+	KindList        = "list"
+	KindMap         = "map"
+	KindOption      = "option"
+	KindTuple       = "tuple"
+	KindRecord      = "record"
+	KindVariant     = "variant"
+	KindRef         = "ref" //引用type_defs定义的类型
+	KindVar         = "var" //类型参数，例如'a
+)
+
+//ACIType ACI中的类型描述
+type ACIType struct {
+	Kind   string
+	Name   string      //ref的类型名，var的参数名，contract的合约名
+	Size   int         //bytes的长度，0表示不定长
+	Params []*ACIType  //list, map, option, tuple, ref的类型参数
+	Fields []*ACIField //record的字段，variant的构造器
+}
+
+//ACIField record的字段或variant的构造器，构造器的参数在Type.Params
+type ACIField struct {
+	Name string
+	Type *ACIType
+}
+
+//ACIArgument 方法参数
+type ACIArgument struct {
+	Name string   `json:"name"`
+	Type *ACIType `json:"type"`
+}
+
+//ACIFunction 合约方法
+type ACIFunction struct {
+	Name      string         `json:"name"`
+	Arguments []*ACIArgument `json:"arguments"`
+	Returns   *ACIType       `json:"returns"`
+	Stateful  bool           `json:"stateful"`
+	Payable   bool           `json:"payable"`
+}
+
+//ACITypeDef type_defs中定义的类型
+type ACITypeDef struct {
+	Name string
+	Vars []string
+	Type *ACIType
+}
+
+//ACI 合约的调用接口，由编译器生成的aci json解析得到
+type ACI struct {
+	Name      string
+	Functions map[string]*ACIFunction
+	TypeDefs  map[string]*ACITypeDef //带命名空间的类型名，例如FungibleToken.meta_info
+	Event     *ACIType               //事件的variant类型，没有事件为nil
+}
+
+//basicKinds 字符串形式的基本类型
+var basicKinds = map[string]*ACIType{
+	"int":       {Kind: KindInt},
+	"bool":      {Kind: KindBool},
+	"string":    {Kind: KindString},
+	"bits":      {Kind: KindBits},
+	"unit":      {Kind: KindUnit},
+	"address":   {Kind: KindAddress},
+	"hash":      {Kind: KindBytes, Size: 32},
+	"signature": {Kind: KindBytes, Size: 64},
+}
+
+//UnmarshalJSON 解析ACI的类型，类型可以是字符串，或只有一个键的对象
+func (t *ACIType) UnmarshalJSON(data []byte) error {
+
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		return t.parseName(name)
+	}
+
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return fmt.Errorf("aci type %s is invalid", string(data))
+	}
+	if len(obj) != 1 {
+		return fmt.Errorf("aci type %s should have exactly one key", string(data))
+	}
+
+	for key, value := range obj {
+		switch key {
+		case KindBytes:
+			t.Kind = KindBytes
+			//bytes的长度是整数，不定长的bytes为"any"
+			if err := json.Unmarshal(value, &t.Size); err != nil {
+				t.Size = 0
+			}
+			return nil
+		case KindRecord:
+			t.Kind = KindRecord
+			var fields []*ACIArgument
+			if err := json.Unmarshal(value, &fields); err != nil {
+				return err
+			}
+			for _, f := range fields {
+				t.Fields = append(t.Fields, &ACIField{Name: f.Name, Type: f.Type})
+			}
+			return nil
+		case KindVariant:
+			t.Kind = KindVariant
+			var constructors []map[string][]*ACIType
+			if err := json.Unmarshal(value, &constructors); err != nil {
+				return err
+			}
+			for _, c := range constructors {
+				for name, args := range c {
+					t.Fields = append(t.Fields, &ACIField{Name: name, Type: &ACIType{Kind: KindTuple, Params: args}})
+				}
+			}
+			return nil
+		case KindList, KindMap, KindOption, KindTuple, KindOracle, KindOracleQuery:
+			t.Kind = key
+		default:
+			//带类型参数的引用，例如{"FungibleToken.t": ["int"]}
+			t.Kind = KindRef
+			t.Name = key
+		}
+		if err := json.Unmarshal(value, &t.Params); err != nil {
+			return err
+		}
+	}
+
+	return t.checkParams()
+}
+
+//parseName 解析字符串形式的类型
+func (t *ACIType) parseName(name string) error {
+	if basic, ok := basicKinds[name]; ok {
+		*t = *basic
+		return nil
+	}
+	switch {
+	case strings.HasPrefix(name, "'"):
+		t.Kind = KindVar
+	case strings.Contains(name, "."):
+		t.Kind = KindRef
+	case name == "":
+		return fmt.Errorf("aci type name is empty")
+	default:
+		//其他名字是合约类型
+		t.Kind = KindContract
+	}
+	t.Name = name
+	return nil
+}
+
+//checkParams 检查类型参数的个数
+func (t *ACIType) checkParams() error {
+	expect := -1
+	switch t.Kind {
+	case KindList, KindOption:
+		expect = 1
+	case KindMap, KindOracle, KindOracleQuery:
+		expect = 2
+	}
+	if expect >= 0 && len(t.Params) != expect {
+		return fmt.Errorf("aci type %s expects %d type parameters", t.Kind, expect)
+	}
+	return nil
+}
+
+//String 类型的Sophia表示
+func (t *ACIType) String() string {
+	params := func() string {
+		s := make([]string, 0, len(t.Params))
+		for _, p := range t.Params {
+			s = append(s, p.String())
+		}
+		return strings.Join(s, ", ")
+	}
+	switch t.Kind {
+	case KindBytes:
+		if t.Size == 0 {
+			return "bytes()"
+		}
+		return fmt.Sprintf("bytes(%d)", t.Size)
+	case KindList, KindMap, KindOption, KindOracle, KindOracleQuery:
+		return fmt.Sprintf("%s(%s)", t.Kind, params())
+	case KindTuple:
+		return fmt.Sprintf("(%s)", params())
+	case KindRef:
+		if len(t.Params) > 0 {
+			return fmt.Sprintf("%s(%s)", t.Name, params())
+		}
+		return t.Name
+	case KindVar, KindContract:
+		return t.Name
+	case KindRecord, KindVariant:
+		s := make([]string, 0, len(t.Fields))
+		for _, f := range t.Fields {
+			s = append(s, f.Name+" : "+f.Type.String())
+		}
+		return fmt.Sprintf("%s{%s}", t.Kind, strings.Join(s, ", "))
+	default:
+		return t.Kind
+	}
+}
+
+//aciContract aci json中的合约或命名空间
+type aciContract struct {
+	Name      string         `json:"name"`
+	Kind      string         `json:"kind"`
+	Functions []*ACIFunction `json:"functions"`
+	Event     *ACIType       `json:"event"`
+	TypeDefs  []struct {
+		Name    string   `json:"name"`
+		TypeDef *ACIType `json:"typedef"`
+		Vars    []struct {
+			Name string `json:"name"`
+		} `json:"vars"`
+	} `json:"type_defs"`
+}
+
+type aciItem struct {
+	Contract  *aciContract `json:"contract"`
+	Namespace *aciContract `json:"namespace"`
+}
+
+//NewACI 解析编译器生成的aci json
+//支持aci数组，单个{"contract": ...}对象，以及http编译器返回的{"encoded_aci": ...}
+func NewACI(aciJSON []byte) (*ACI, error) {
+
+	var items []*aciItem
+	if err := json.Unmarshal(aciJSON, &items); err != nil {
+		var wrapper struct {
+			aciItem
+			EncodedACI *aciItem `json:"encoded_aci"`
+		}
+		if err := json.Unmarshal(aciJSON, &wrapper); err != nil {
+			return nil, fmt.Errorf("aci json is invalid: %v", err)
+		}
+		if wrapper.EncodedACI != nil {
+			items = []*aciItem{wrapper.EncodedACI}
+		} else {
+			items = []*aciItem{&wrapper.aciItem}
+		}
+	}
+
+	aci := &ACI{
+		Functions: make(map[string]*ACIFunction),
+		TypeDefs:  make(map[string]*ACITypeDef),
+	}
+
+	//主合约为kind是contract_main的合约，没有标记时为最后一个合约
+	var main *aciContract
+	for _, item := range items {
+		c := item.Contract
+		if c == nil {
+			c = item.Namespace
+		}
+		if c == nil {
+			continue
+		}
+		for _, td := range c.TypeDefs {
+			def := &ACITypeDef{Name: c.Name + "." + td.Name, Type: td.TypeDef}
+			for _, v := range td.Vars {
+				def.Vars = append(def.Vars, v.Name)
+			}
+			aci.TypeDefs[def.Name] = def
+		}
+		if item.Contract != nil && (main == nil || main.Kind != "contract_main") {
+			main = item.Contract
+		}
+	}
+
+	if main == nil {
+		return nil, fmt.Errorf("aci json has no contract")
+	}
+
+	aci.Name = main.Name
+	aci.Event = main.Event
+	for _, f := range main.Functions {
+		aci.Functions[f.Name] = f
+	}
+
+	return aci, nil
+}
+
+//Function 查找合约方法
+func (aci *ACI) Function(name string) (*ACIFunction, error) {
+	f, ok := aci.Functions[name]
+	if !ok {
+		return nil, fmt.Errorf("contract %s has no function %s", aci.Name, name)
+	}
+	return f, nil
+}
+
+//resolve 展开引用类型，直到得到非引用类型
+func (aci *ACI) resolve(t *ACIType) (*ACIType, error) {
+	for depth := 0; t.Kind == KindRef; depth++ {
+		if depth > 64 {
+			return nil, fmt.Errorf("aci type %s is recursive", t.String())
+		}
+		def, ok := aci.TypeDefs[t.Name]
+		if !ok {
+			return nil, fmt.Errorf("aci type %s is undefined", t.Name)
+		}
+		if len(def.Vars) != len(t.Params) {
+			return nil, fmt.Errorf("aci type %s expects %d type parameters", t.Name, len(def.Vars))
+		}
+		bound := make(map[string]*ACIType, len(def.Vars))
+		for i, name := range def.Vars {
+			bound[name] = t.Params[i]
+		}
+		t = substitute(def.Type, bound)
+	}
+	if t.Kind == KindVar {
+		return nil, fmt.Errorf("aci type variable %s is unbound", t.Name)
+	}
+	return t, nil
+}
+
+//substitute 替换类型中的类型参数
+func substitute(t *ACIType, bound map[string]*ACIType) *ACIType {
+	if t.Kind == KindVar {
+		if b, ok := bound[t.Name]; ok {
+			return b
+		}
+		return t
+	}
+	if len(t.Params) == 0 && len(t.Fields) == 0 {
+		return t
+	}
+	c := &ACIType{Kind: t.Kind, Name: t.Name, Size: t.Size}
+	for _, p := range t.Params {
+		c.Params = append(c.Params, substitute(p, bound))
+	}
+	for _, f := range t.Fields {
+		c.Fields = append(c.Fields, &ACIField{Name: f.Name, Type: substitute(f.Type, bound)})
+	}
+	return c
+}
@@ -0,0 +1,239 @@
+package aeternity_fate
+
+import (
+	"github.com/aeternity/aepp-sdk-go/aeternity"
+	"math/big"
+	"reflect"
+	"testing"
+)
+
+const testACI = `[
+  {"namespace": {"name": "ListInternal", "type_defs": []}},
+  {"contract": {
+    "name": "FungibleToken",
+    "kind": "contract_main",
+    "payable": false,
+    "event": {"variant": [
+      {"Transfer": ["address", "address", "int"]},
+      {"Allowance": ["address", "address", "int"]},
+      {"Message": ["address", "string"]}
+    ]},
+    "functions": [
+      {"name": "meta_info", "arguments": [], "returns": "FungibleToken.meta_info", "stateful": false, "payable": false},
+      {"name": "balance", "arguments": [{"name": "account", "type": "address"}], "returns": {"option": ["int"]}, "stateful": false, "payable": false},
+      {"name": "balances", "arguments": [], "returns": "FungibleToken.balances", "stateful": false, "payable": false},
+      {"name": "transfer", "arguments": [{"name": "recipient", "type": "address"}, {"name": "value", "type": "int"}], "returns": {"tuple": []}, "stateful": true, "payable": false},
+      {"name": "set_status", "arguments": [{"name": "status", "type": "FungibleToken.status"}], "returns": {"FungibleToken.pair": ["int", "bool"]}, "stateful": true, "payable": false},
+      {"name": "set_hash", "arguments": [{"name": "h", "type": "hash"}, {"name": "tags", "type": {"list": ["string"]}}], "returns": "unit", "stateful": true, "payable": false}
+    ],
+    "type_defs": [
+      {"name": "meta_info", "typedef": {"record": [{"name": "name", "type": "string"}, {"name": "symbol", "type": "string"}, {"name": "decimals", "type": "int"}]}, "vars": []},
+      {"name": "balances", "typedef": {"map": ["address", "int"]}, "vars": []},
+      {"name": "status", "typedef": {"variant": [{"Active": []}, {"Paused": ["string"]}, {"Limited": ["int", {"option": ["address"]}]}]}, "vars": []},
+      {"name": "pair", "typedef": {"tuple": ["'a", "'b"]}, "vars": [{"name": "'a"}, {"name": "'b"}]}
+    ]
+  }}
+]`
+
+func testNewACI(t *testing.T) *ACI {
+	aci, err := NewACI([]byte(testACI))
+	if err != nil {
+		t.Fatalf("NewACI error: %v", err)
+	}
+	return aci
+}
+
+func TestNewACI(t *testing.T) {
+	aci := testNewACI(t)
+	if aci.Name != "FungibleToken" {
+		t.Errorf("aci name = %s", aci.Name)
+	}
+	if len(aci.Functions) != 6 || len(aci.TypeDefs) != 4 {
+		t.Errorf("aci has %d functions and %d type defs", len(aci.Functions), len(aci.TypeDefs))
+	}
+	f, err := aci.Function("set_status")
+	if err != nil {
+		t.Errorf("Function error: %v", err)
+		return
+	}
+	if f.Returns.String() != "FungibleToken.pair(int, bool)" {
+		t.Errorf("set_status returns %s", f.Returns.String())
+	}
+
+	//http编译器返回的格式
+	if _, err := NewACI([]byte(`{"encoded_aci": {"contract": {"name": "C", "functions": [], "type_defs": []}}}`)); err != nil {
+		t.Errorf("NewACI encoded_aci error: %v", err)
+	}
+	if _, err := NewACI([]byte(`[{"namespace": {"name": "N", "type_defs": []}}]`)); err == nil {
+		t.Errorf("NewACI without contract should fail")
+	}
+}
+
+func TestACI_EncodeCall(t *testing.T) {
+
+	aci := testNewACI(t)
+
+	callData, err := aci.EncodeCall("transfer", testZeroAddress, "1000000000000000000")
+	if err != nil {
+		t.Errorf("EncodeCall error: %v", err)
+		return
+	}
+	expect, _ := EncodeCallData("transfer", Address(testZeroAddress), new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil))
+	if callData != expect {
+		t.Errorf("EncodeCall = %s, want %s", callData, expect)
+	}
+
+	name, args, err := aci.DecodeCall(callData)
+	if err != nil {
+		t.Errorf("DecodeCall error: %v", err)
+		return
+	}
+	if name != "transfer" || args[0] != testZeroAddress || args[1].(*big.Int).String() != "1000000000000000000" {
+		t.Errorf("DecodeCall = %s %v", name, args)
+	}
+
+	//参数类型错误
+	if _, err := aci.EncodeCall("transfer", "ct_11111111111111111111111111111111273Yts", 1); err == nil {
+		t.Errorf("EncodeCall with contract address should fail")
+	}
+	if _, err := aci.EncodeCall("transfer", testZeroAddress); err == nil {
+		t.Errorf("EncodeCall with missing argument should fail")
+	}
+	if _, err := aci.EncodeCall("set_hash", []byte{1, 2, 3}, []string{}); err == nil {
+		t.Errorf("EncodeCall with short hash should fail")
+	}
+}
+
+func TestACI_Variant(t *testing.T) {
+
+	aci := testNewACI(t)
+
+	tests := []*Constructor{
+		{Name: "Active", Args: []interface{}{}},
+		{Name: "Paused", Args: []interface{}{"maintenance"}},
+		{Name: "Limited", Args: []interface{}{big.NewInt(100), testZeroAddress}},
+		{Name: "Limited", Args: []interface{}{big.NewInt(100), nil}},
+	}
+
+	for _, c := range tests {
+		callData, err := aci.EncodeCall("set_status", c)
+		if err != nil {
+			t.Errorf("EncodeCall(%s) error: %v", c.Name, err)
+			continue
+		}
+		_, args, err := aci.DecodeCall(callData)
+		if err != nil {
+			t.Errorf("DecodeCall(%s) error: %v", c.Name, err)
+			continue
+		}
+		if !reflect.DeepEqual(args[0], c) {
+			t.Errorf("variant round trip %#v = %#v", c, args[0])
+		}
+	}
+
+	//无参数构造器可以用名字表示
+	callData, err := aci.EncodeCall("set_status", "Active")
+	if err != nil {
+		t.Errorf("EncodeCall error: %v", err)
+		return
+	}
+	_, _, err = aci.DecodeCall(callData)
+	if err != nil {
+		t.Errorf("DecodeCall error: %v", err)
+	}
+
+	//带类型参数的返回值
+	returnValue, _ := EncodeValue(Tuple{big.NewInt(7), true})
+	result, err := aci.DecodeResult("set_status", returnValue)
+	if err != nil {
+		t.Errorf("DecodeResult error: %v", err)
+		return
+	}
+	if !reflect.DeepEqual(result, []interface{}{big.NewInt(7), true}) {
+		t.Errorf("DecodeResult = %#v", result)
+	}
+}
+
+func TestACI_DecodeResult(t *testing.T) {
+
+	aci := testNewACI(t)
+
+	//record
+	returnValue, _ := EncodeValue(Tuple{"Wrapped Aeternity", "WAE", big.NewInt(18)})
+	result, err := aci.DecodeResult("meta_info", returnValue)
+	if err != nil {
+		t.Errorf("DecodeResult(meta_info) error: %v", err)
+		return
+	}
+	expect := map[string]interface{}{"name": "Wrapped Aeternity", "symbol": "WAE", "decimals": big.NewInt(18)}
+	if !reflect.DeepEqual(result, expect) {
+		t.Errorf("DecodeResult(meta_info) = %#v", result)
+	}
+
+	//option
+	returnValue, _ = EncodeValue(&Variant{Arities: []byte{0, 1}, Tag: 0, Values: Tuple{}})
+	result, err = aci.DecodeResult("balance", returnValue)
+	if err != nil || result != nil {
+		t.Errorf("DecodeResult(balance) = %v, %v", result, err)
+	}
+	returnValue, _ = EncodeValue(&Variant{Arities: []byte{0, 1}, Tag: 1, Values: Tuple{big.NewInt(500)}})
+	result, err = aci.DecodeResult("balance", returnValue)
+	if err != nil || result.(*big.Int).Int64() != 500 {
+		t.Errorf("DecodeResult(balance) = %v, %v", result, err)
+	}
+
+	//map
+	returnValue, _ = EncodeValue(&Map{Entries: []*MapEntry{{Key: Address(testZeroAddress), Value: big.NewInt(1)}}})
+	result, err = aci.DecodeResult("balances", returnValue)
+	if err != nil {
+		t.Errorf("DecodeResult(balances) error: %v", err)
+		return
+	}
+	if !reflect.DeepEqual(result, map[string]interface{}{testZeroAddress: big.NewInt(1)}) {
+		t.Errorf("DecodeResult(balances) = %#v", result)
+	}
+
+	//类型不匹配
+	returnValue, _ = EncodeValue("WAE")
+	if _, err := aci.DecodeResult("balances", returnValue); err == nil {
+		t.Errorf("DecodeResult with mismatched type should fail")
+	}
+}
+
+func TestACI_DecodeEvent(t *testing.T) {
+
+	aci := testNewACI(t)
+
+	to := "ak_qcqXt6ySgRPvBkNwEpNMvaKWzrhPZsoBHLvgg68qg9vRht62y"
+	pub, err := aeternity.Decode(to)
+	if err != nil {
+		t.Fatalf("Decode error: %v", err)
+	}
+
+	topics := []*big.Int{EventHash("Transfer"), big.NewInt(0), new(big.Int).SetBytes(pub), big.NewInt(1000)}
+	event, err := aci.DecodeEvent(topics, "")
+	if err != nil {
+		t.Errorf("DecodeEvent error: %v", err)
+		return
+	}
+	if event.Name != "Transfer" || !reflect.DeepEqual(event.Args, []interface{}{testZeroAddress, to, big.NewInt(1000)}) {
+		t.Errorf("DecodeEvent = %s %#v", event.Name, event.Args)
+	}
+
+	data := aeternity.Encode(aeternity.PrefixContractByteArray, []byte("hello"))
+	event, err = aci.DecodeEvent([]*big.Int{EventHash("Message"), new(big.Int).SetBytes(pub)}, data)
+	if err != nil {
+		t.Errorf("DecodeEvent error: %v", err)
+		return
+	}
+	if event.Name != "Message" || !reflect.DeepEqual(event.Args, []interface{}{to, "hello"}) {
+		t.Errorf("DecodeEvent = %s %#v", event.Name, event.Args)
+	}
+
+	if _, err := aci.DecodeEvent([]*big.Int{EventHash("Burn")}, ""); err == nil {
+		t.Errorf("DecodeEvent with unknown event should fail")
+	}
+	if _, err := aci.DecodeEvent(topics[:3], ""); err == nil {
+		t.Errorf("DecodeEvent with missing topic should fail")
+	}
+}
@@ -0,0 +1,669 @@
+package aeternity_fate
+
+import (
+	"encoding/hex"
+	"fmt"
+	"github.com/aeternity/aepp-sdk-go/aeternity"
+	"math/big"
+	"reflect"
+	"strings"
+)
+
+//Constructor 变体类型的构造器和参数
+type Constructor struct {
+	Name string
+	Args []interface{}
+}
+
+//Event 解码后的合约事件
+type Event struct {
+	Name string
+	Args []interface{}
+}
+
+//EncodeCall 按ACI编码合约调用的calldata，参数为Go类型，返回cb_编码
+func (aci *ACI) EncodeCall(function string, args ...interface{}) (string, error) {
+	f, err := aci.Function(function)
+	if err != nil {
+		return "", err
+	}
+	if len(args) != len(f.Arguments) {
+		return "", fmt.Errorf("function %s expects %d arguments, got %d", function, len(f.Arguments), len(args))
+	}
+	values := make([]interface{}, 0, len(args))
+	for i, arg := range f.Arguments {
+		v, err := aci.ToFATE(arg.Type, args[i])
+		if err != nil {
+			return "", fmt.Errorf("function %s argument %s: %v", function, arg.Name, err)
+		}
+		values = append(values, v)
+	}
+	return EncodeCallData(function, values...)
+}
+
+//DecodeCall 按ACI解码calldata，返回方法名和Go类型的参数
+func (aci *ACI) DecodeCall(callData string) (string, []interface{}, error) {
+	functionID, values, err := DecodeCallData(callData)
+	if err != nil {
+		return "", nil, err
+	}
+	for name, f := range aci.Functions {
+		if string(FunctionID(name)) != string(functionID) {
+			continue
+		}
+		if len(values) != len(f.Arguments) {
+			return "", nil, fmt.Errorf("function %s expects %d arguments, got %d", name, len(f.Arguments), len(values))
+		}
+		args := make([]interface{}, 0, len(values))
+		for i, arg := range f.Arguments {
+			v, err := aci.FromFATE(arg.Type, values[i])
+			if err != nil {
+				return "", nil, fmt.Errorf("function %s argument %s: %v", name, arg.Name, err)
+			}
+			args = append(args, v)
+		}
+		return name, args, nil
+	}
+	return "", nil, fmt.Errorf("contract %s has no function with id %s", aci.Name, hex.EncodeToString(functionID))
+}
+
+//DecodeResult 按ACI解码方法的cb_返回值
+func (aci *ACI) DecodeResult(function, returnValue string) (interface{}, error) {
+	f, err := aci.Function(function)
+	if err != nil {
+		return nil, err
+	}
+	value, err := DecodeValue(returnValue)
+	if err != nil {
+		return nil, err
+	}
+	return aci.FromFATE(f.Returns, value)
+}
+
+//DecodeEvent 按ACI解码事件日志，topics[0]为事件名的哈希，
+//可索引的参数依次在其余topics中，string参数在data中，data为cb_编码
+func (aci *ACI) DecodeEvent(topics []*big.Int, data string) (*Event, error) {
+
+	if aci.Event == nil {
+		return nil, fmt.Errorf("contract %s has no events", aci.Name)
+	}
+	if len(topics) == 0 {
+		return nil, fmt.Errorf("event has no topics")
+	}
+
+	eventType, err := aci.resolve(aci.Event)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range eventType.Fields {
+		if EventHash(c.Name).Cmp(topics[0]) != 0 {
+			continue
+		}
+
+		event := &Event{Name: c.Name}
+		indexed := topics[1:]
+		for _, p := range c.Type.Params {
+			t, err := aci.resolve(p)
+			if err != nil {
+				return nil, err
+			}
+			if isEventPayload(t) {
+				payload, err := aeternity.Decode(data)
+				if err != nil {
+					return nil, err
+				}
+				if t.Kind == KindString {
+					event.Args = append(event.Args, string(payload))
+				} else {
+					event.Args = append(event.Args, payload)
+				}
+				continue
+			}
+			if len(indexed) == 0 {
+				return nil, fmt.Errorf("event %s has too few topics", c.Name)
+			}
+			v, err := topicToValue(t, indexed[0])
+			if err != nil {
+				return nil, fmt.Errorf("event %s: %v", c.Name, err)
+			}
+			event.Args = append(event.Args, v)
+			indexed = indexed[1:]
+		}
+		if len(indexed) > 0 {
+			return nil, fmt.Errorf("event %s has too many topics", c.Name)
+		}
+		return event, nil
+	}
+
+	return nil, fmt.Errorf("contract %s has no event with hash %s", aci.Name, topics[0].String())
+}
+
+//isEventPayload 不能放入topic的参数放在事件的data中
+func isEventPayload(t *ACIType) bool {
+	return t.Kind == KindString || (t.Kind == KindBytes && (t.Size == 0 || t.Size > 32))
+}
+
+//topicToValue 可索引参数的topic转为Go类型，topic是256位无符号整数
+func topicToValue(t *ACIType, topic *big.Int) (interface{}, error) {
+	word := make([]byte, 32)
+	b := topic.Bytes()
+	if len(b) > 32 {
+		return nil, fmt.Errorf("topic is longer than 32 bytes")
+	}
+	copy(word[32-len(b):], b)
+
+	switch t.Kind {
+	case KindInt:
+		//负数以补码存放
+		n := new(big.Int).Set(topic)
+		if word[0]&0x80 != 0 {
+			n.Sub(n, new(big.Int).Lsh(big.NewInt(1), 256))
+		}
+		return n, nil
+	case KindBool:
+		return topic.Sign() != 0, nil
+	case KindAddress:
+		return aeternity.Encode(aeternity.PrefixAccountPubkey, word), nil
+	case KindContract:
+		return aeternity.Encode(aeternity.PrefixContractPubkey, word), nil
+	case KindOracle:
+		return aeternity.Encode(aeternity.PrefixOraclePubkey, word), nil
+	case KindOracleQuery:
+		return aeternity.Encode(aeternity.PrefixOracleQueryID, word), nil
+	case KindBytes:
+		return word[32-t.Size:], nil
+	case KindBits:
+		return topic, nil
+	default:
+		return nil, fmt.Errorf("type %s can not be indexed", t.String())
+	}
+}
+
+//ToFATE Go类型按ACI类型转为FATE数据
+//int接受整数类型、*big.Int和十进制字符串；地址类型接受带前缀的字符串；
+//bytes接受[]byte和十六进制字符串；list和tuple接受切片；map接受Go的map或*Map；
+//option以nil表示None；record接受map[string]interface{}或按字段顺序的切片；
+//variant接受*Constructor、Constructor或无参数构造器的名字
+func (aci *ACI) ToFATE(t *ACIType, value interface{}) (interface{}, error) {
+
+	t, err := aci.resolve(t)
+	if err != nil {
+		return nil, err
+	}
+
+	switch t.Kind {
+	case KindInt:
+		return toBigInt(value)
+	case KindBits:
+		n, err := toBigInt(value)
+		if err != nil {
+			return nil, err
+		}
+		return Bits{n}, nil
+	case KindBool:
+		b, ok := value.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%T is not a bool", value)
+		}
+		return b, nil
+	case KindString:
+		switch v := value.(type) {
+		case string:
+			return v, nil
+		case []byte:
+			return string(v), nil
+		}
+		return nil, fmt.Errorf("%T is not a string", value)
+	case KindAddress:
+		s, err := toEncoded(value, aeternity.PrefixAccountPubkey)
+		return Address(s), err
+	case KindContract:
+		s, err := toEncoded(value, aeternity.PrefixContractPubkey)
+		return ContractAddress(s), err
+	case KindOracle:
+		s, err := toEncoded(value, aeternity.PrefixOraclePubkey)
+		return OracleAddress(s), err
+	case KindOracleQuery:
+		s, err := toEncoded(value, aeternity.PrefixOracleQueryID)
+		return OracleQueryID(s), err
+	case KindBytes:
+		b, err := toBytes(value)
+		if err != nil {
+			return nil, err
+		}
+		if t.Size > 0 && len(b) != t.Size {
+			return nil, fmt.Errorf("bytes(%d) got %d bytes", t.Size, len(b))
+		}
+		return Bytes(b), nil
+	case KindUnit:
+		return Tuple{}, nil
+	case KindList:
+		elements, err := toSlice(value)
+		if err != nil {
+			return nil, err
+		}
+		list := make(List, 0, len(elements))
+		for _, e := range elements {
+			v, err := aci.ToFATE(t.Params[0], e)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return list, nil
+	case KindTuple:
+		elements, err := toSlice(value)
+		if err != nil {
+			return nil, err
+		}
+		return aci.toFATETuple(t.Params, elements)
+	case KindMap:
+		return aci.toFATEMap(t, value)
+	case KindOption:
+		if isNil(value) {
+			return &Variant{Arities: []byte{0, 1}, Tag: 0, Values: Tuple{}}, nil
+		}
+		v, err := aci.ToFATE(t.Params[0], value)
+		if err != nil {
+			return nil, err
+		}
+		return &Variant{Arities: []byte{0, 1}, Tag: 1, Values: Tuple{v}}, nil
+	case KindRecord:
+		return aci.toFATERecord(t, value)
+	case KindVariant:
+		return aci.toFATEVariant(t, value)
+	default:
+		return nil, fmt.Errorf("unsupported aci type %s", t.String())
+	}
+}
+
+func (aci *ACI) toFATETuple(types []*ACIType, elements []interface{}) (Tuple, error) {
+	if len(elements) != len(types) {
+		return nil, fmt.Errorf("tuple expects %d elements, got %d", len(types), len(elements))
+	}
+	tuple := make(Tuple, 0, len(elements))
+	for i, e := range elements {
+		v, err := aci.ToFATE(types[i], e)
+		if err != nil {
+			return nil, err
+		}
+		tuple = append(tuple, v)
+	}
+	return tuple, nil
+}
+
+func (aci *ACI) toFATEMap(t *ACIType, value interface{}) (*Map, error) {
+	m := &Map{}
+	add := func(k, v interface{}) error {
+		key, err := aci.ToFATE(t.Params[0], k)
+		if err != nil {
+			return err
+		}
+		val, err := aci.ToFATE(t.Params[1], v)
+		if err != nil {
+			return err
+		}
+		m.Entries = append(m.Entries, &MapEntry{Key: key, Value: val})
+		return nil
+	}
+	if fm, ok := value.(*Map); ok {
+		for _, e := range fm.Entries {
+			if err := add(e.Key, e.Value); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	}
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Map {
+		return nil, fmt.Errorf("%T is not a map", value)
+	}
+	for _, k := range rv.MapKeys() {
+		if err := add(k.Interface(), rv.MapIndex(k).Interface()); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func (aci *ACI) toFATERecord(t *ACIType, value interface{}) (Tuple, error) {
+	types := make([]*ACIType, 0, len(t.Fields))
+	for _, f := range t.Fields {
+		types = append(types, f.Type)
+	}
+	if fields, ok := value.(map[string]interface{}); ok {
+		elements := make([]interface{}, 0, len(t.Fields))
+		for _, f := range t.Fields {
+			v, ok := fields[f.Name]
+			if !ok {
+				return nil, fmt.Errorf("record field %s is missing", f.Name)
+			}
+			elements = append(elements, v)
+		}
+		if len(fields) != len(t.Fields) {
+			return nil, fmt.Errorf("record expects %d fields, got %d", len(t.Fields), len(fields))
+		}
+		return aci.toFATETuple(types, elements)
+	}
+	elements, err := toSlice(value)
+	if err != nil {
+		return nil, fmt.Errorf("%T is not a record", value)
+	}
+	return aci.toFATETuple(types, elements)
+}
+
+func (aci *ACI) toFATEVariant(t *ACIType, value interface{}) (*Variant, error) {
+	var c Constructor
+	switch v := value.(type) {
+	case *Constructor:
+		c = *v
+	case Constructor:
+		c = v
+	case string:
+		c = Constructor{Name: v}
+	default:
+		return nil, fmt.Errorf("%T is not a variant constructor", value)
+	}
+	arities := make([]byte, 0, len(t.Fields))
+	for _, f := range t.Fields {
+		arities = append(arities, byte(len(f.Type.Params)))
+	}
+	for i, f := range t.Fields {
+		if f.Name != c.Name {
+			continue
+		}
+		values, err := aci.toFATETuple(f.Type.Params, c.Args)
+		if err != nil {
+			return nil, fmt.Errorf("constructor %s: %v", c.Name, err)
+		}
+		return &Variant{Arities: arities, Tag: byte(i), Values: values}, nil
+	}
+	return nil, fmt.Errorf("variant has no constructor %s", c.Name)
+}
+
+//FromFATE FATE数据按ACI类型转为Go类型
+//int和bits为*big.Int，地址类型为带前缀的字符串，bytes为[]byte，list和tuple为[]interface{}，
+//option的None为nil，record为map[string]interface{}，variant为*Constructor，unit为nil；
+//map的键是int、string、bool、地址或bytes时为map[string]interface{}，键为十进制、原文、前缀地址或十六进制，
+//其他键类型的map为*Map
+func (aci *ACI) FromFATE(t *ACIType, value interface{}) (interface{}, error) {
+
+	t, err := aci.resolve(t)
+	if err != nil {
+		return nil, err
+	}
+
+	mismatch := func() error {
+		return fmt.Errorf("fate value %T is not %s", value, t.String())
+	}
+
+	switch t.Kind {
+	case KindInt:
+		n, ok := value.(*big.Int)
+		if !ok {
+			return nil, mismatch()
+		}
+		return n, nil
+	case KindBits:
+		b, ok := value.(Bits)
+		if !ok {
+			return nil, mismatch()
+		}
+		return b.Int, nil
+	case KindBool:
+		b, ok := value.(bool)
+		if !ok {
+			return nil, mismatch()
+		}
+		return b, nil
+	case KindString:
+		s, ok := value.(string)
+		if !ok {
+			return nil, mismatch()
+		}
+		return s, nil
+	case KindAddress:
+		a, ok := value.(Address)
+		if !ok {
+			return nil, mismatch()
+		}
+		return string(a), nil
+	case KindContract:
+		a, ok := value.(ContractAddress)
+		if !ok {
+			return nil, mismatch()
+		}
+		return string(a), nil
+	case KindOracle:
+		a, ok := value.(OracleAddress)
+		if !ok {
+			return nil, mismatch()
+		}
+		return string(a), nil
+	case KindOracleQuery:
+		a, ok := value.(OracleQueryID)
+		if !ok {
+			return nil, mismatch()
+		}
+		return string(a), nil
+	case KindBytes:
+		b, ok := value.(Bytes)
+		if !ok || (t.Size > 0 && len(b) != t.Size) {
+			return nil, mismatch()
+		}
+		return []byte(b), nil
+	case KindUnit:
+		if tuple, ok := value.(Tuple); !ok || len(tuple) != 0 {
+			return nil, mismatch()
+		}
+		return nil, nil
+	case KindList:
+		list, ok := value.(List)
+		if !ok {
+			return nil, mismatch()
+		}
+		result := make([]interface{}, 0, len(list))
+		for _, e := range list {
+			v, err := aci.FromFATE(t.Params[0], e)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, v)
+		}
+		return result, nil
+	case KindTuple:
+		tuple, ok := value.(Tuple)
+		if !ok {
+			return nil, mismatch()
+		}
+		return aci.fromFATETuple(t.Params, tuple)
+	case KindMap:
+		m, ok := value.(*Map)
+		if !ok {
+			return nil, mismatch()
+		}
+		return aci.fromFATEMap(t, m)
+	case KindOption:
+		v, ok := value.(*Variant)
+		if !ok || len(v.Arities) != 2 || v.Arities[0] != 0 || v.Arities[1] != 1 {
+			return nil, mismatch()
+		}
+		if v.Tag == 0 {
+			return nil, nil
+		}
+		return aci.FromFATE(t.Params[0], v.Values[0])
+	case KindRecord:
+		tuple, ok := value.(Tuple)
+		if !ok || len(tuple) != len(t.Fields) {
+			return nil, mismatch()
+		}
+		record := make(map[string]interface{}, len(t.Fields))
+		for i, f := range t.Fields {
+			v, err := aci.FromFATE(f.Type, tuple[i])
+			if err != nil {
+				return nil, fmt.Errorf("record field %s: %v", f.Name, err)
+			}
+			record[f.Name] = v
+		}
+		return record, nil
+	case KindVariant:
+		v, ok := value.(*Variant)
+		if !ok || len(v.Arities) != len(t.Fields) {
+			return nil, mismatch()
+		}
+		f := t.Fields[v.Tag]
+		args, err := aci.fromFATETuple(f.Type.Params, v.Values)
+		if err != nil {
+			return nil, fmt.Errorf("constructor %s: %v", f.Name, err)
+		}
+		return &Constructor{Name: f.Name, Args: args}, nil
+	default:
+		return nil, fmt.Errorf("unsupported aci type %s", t.String())
+	}
+}
+
+func (aci *ACI) fromFATETuple(types []*ACIType, tuple Tuple) ([]interface{}, error) {
+	if len(tuple) != len(types) {
+		return nil, fmt.Errorf("tuple expects %d elements, got %d", len(types), len(tuple))
+	}
+	result := make([]interface{}, 0, len(tuple))
+	for i, e := range tuple {
+		v, err := aci.FromFATE(types[i], e)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, v)
+	}
+	return result, nil
+}
+
+func (aci *ACI) fromFATEMap(t *ACIType, m *Map) (interface{}, error) {
+	keyType, err := aci.resolve(t.Params[0])
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]*MapEntry, 0, len(m.Entries))
+	for _, e := range m.Entries {
+		k, err := aci.FromFATE(keyType, e.Key)
+		if err != nil {
+			return nil, err
+		}
+		v, err := aci.FromFATE(t.Params[1], e.Value)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, &MapEntry{Key: k, Value: v})
+	}
+	switch keyType.Kind {
+	case KindInt, KindString, KindBool, KindAddress, KindContract, KindOracle, KindOracleQuery, KindBytes:
+		result := make(map[string]interface{}, len(entries))
+		for _, e := range entries {
+			result[mapKeyString(e.Key)] = e.Value
+		}
+		return result, nil
+	default:
+		return &Map{Entries: entries}, nil
+	}
+}
+
+func mapKeyString(key interface{}) string {
+	switch k := key.(type) {
+	case *big.Int:
+		return k.String()
+	case []byte:
+		return hex.EncodeToString(k)
+	default:
+		return fmt.Sprintf("%v", k)
+	}
+}
+
+func isNil(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Interface:
+		return rv.IsNil()
+	}
+	return false
+}
+
+func toBigInt(value interface{}) (*big.Int, error) {
+	switch v := value.(type) {
+	case *big.Int:
+		if v == nil {
+			return nil, fmt.Errorf("integer is nil")
+		}
+		return v, nil
+	case big.Int:
+		return &v, nil
+	case string:
+		n, ok := new(big.Int).SetString(v, 10)
+		if !ok {
+			return nil, fmt.Errorf("%s is not a decimal integer", v)
+		}
+		return n, nil
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return big.NewInt(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return new(big.Int).SetUint64(rv.Uint()), nil
+	}
+	return nil, fmt.Errorf("%T is not an integer", value)
+}
+
+func toEncoded(value interface{}, prefix aeternity.HashPrefix) (string, error) {
+	s := reflect.ValueOf(value)
+	if s.Kind() != reflect.String {
+		return "", fmt.Errorf("%T is not a %s address", value, prefix)
+	}
+	addr := s.String()
+	if !strings.HasPrefix(addr, string(prefix)) {
+		return "", fmt.Errorf("%s is not a %s address", addr, prefix)
+	}
+	if _, err := aeternity.Decode(addr); err != nil {
+		return "", err
+	}
+	return addr, nil
+}
+
+func toBytes(value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case []byte:
+		return v, nil
+	case Bytes:
+		return v, nil
+	case string:
+		b, err := hex.DecodeString(strings.TrimPrefix(v, "0x"))
+		if err != nil {
+			return nil, fmt.Errorf("%s is not a hex string", v)
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("%T is not bytes", value)
+}
+
+func toSlice(value interface{}) ([]interface{}, error) {
+	switch v := value.(type) {
+	case []interface{}:
+		return v, nil
+	case Tuple:
+		return v, nil
+	case List:
+		return v, nil
+	}
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, fmt.Errorf("%T is not a slice", value)
+	}
+	elements := make([]interface{}, 0, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		elements = append(elements, rv.Index(i).Interface())
+	}
+	return elements, nil
+}
+
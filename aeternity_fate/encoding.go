@@ -0,0 +1,561 @@
+package aeternity_fate
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/aeternity/aepp-sdk-go/aeternity"
+	"github.com/blocktree/go-owcrypt"
+	rlp "github.com/randomshinichi/rlpae"
+	"math/big"
+	"sort"
+)
+
+//FATE 数据类型标签，参考aebytecode的aeb_fate_encoding
+const (
+	tagSmallInt    = 0x00 //0bSXXXXXX0 小整数
+	tagTrue        = 0xff
+	tagFalse       = 0x7f
+	tagLongString  = 0x01
+	tagShortString = 0x01 //0bXXXXXX01 短字符串
+	tagShortList   = 0x03 //0bXXXX0011 短列表
+	tagLongList    = 0x1f
+	tagMap         = 0x2f
+	tagLongTuple   = 0x0b
+	tagShortTuple  = 0x0b //0bXXXX1011 短元组
+	tagEmptyTuple  = 0x3f
+	tagPosBits     = 0x4f
+	tagNegBits     = 0xcf
+	tagPosBigInt   = 0x6f
+	tagNegBigInt   = 0xef
+	tagEmptyString = 0x5f
+	tagObject      = 0x9f
+	tagVariant     = 0xaf
+
+	objectAddress  = 0x00
+	objectBytes    = 0x01
+	objectContract = 0x02
+	objectOracle   = 0x03
+	objectOracleQ  = 0x04
+	objectChannel  = 0x05
+)
+
+//Address ak_账户地址
+type Address string
+
+//ContractAddress ct_合约地址
+type ContractAddress string
+
+//OracleAddress ok_预言机地址
+type OracleAddress string
+
+//OracleQueryID oq_预言机查询ID
+type OracleQueryID string
+
+//ChannelAddress ch_状态通道地址
+type ChannelAddress string
+
+//Bytes 定长字节数组，例如hash、signature
+type Bytes []byte
+
+//Bits 位图
+type Bits struct {
+	*big.Int
+}
+
+//Tuple 元组
+type Tuple []interface{}
+
+//List 列表
+type List []interface{}
+
+//MapEntry 映射的键值对
+type MapEntry struct {
+	Key   interface{}
+	Value interface{}
+}
+
+//Map 映射，Entries按键排序
+type Map struct {
+	Entries []*MapEntry
+}
+
+//Variant 变体类型，Arities为每个构造器的参数个数，Tag为构造器序号
+type Variant struct {
+	Arities []byte
+	Tag     byte
+	Values  Tuple
+}
+
+//FunctionID 合约方法ID，方法名blake2b哈希的前4字节
+func FunctionID(name string) []byte {
+	return owcrypt.Hash([]byte(name), 32, owcrypt.HASH_ALG_BLAKE2B)[:4]
+}
+
+//EventHash 合约事件的topic，事件名blake2b哈希的整数值
+func EventHash(name string) *big.Int {
+	return new(big.Int).SetBytes(owcrypt.Hash([]byte(name), 32, owcrypt.HASH_ALG_BLAKE2B))
+}
+
+//EncodeCallData 编码合约调用的calldata，参数为FATE数据，返回cb_编码
+func EncodeCallData(function string, args ...interface{}) (string, error) {
+	data, err := Serialize(Tuple{FunctionID(function), Tuple(args)})
+	if err != nil {
+		return "", err
+	}
+	return aeternity.Encode(aeternity.PrefixContractByteArray, data), nil
+}
+
+//DecodeCallData 解码cb_编码的calldata，返回方法ID和参数
+func DecodeCallData(callData string) ([]byte, Tuple, error) {
+	value, err := DecodeValue(callData)
+	if err != nil {
+		return nil, nil, err
+	}
+	call, ok := value.(Tuple)
+	if !ok || len(call) != 2 {
+		return nil, nil, fmt.Errorf("calldata is not a tuple of function id and arguments")
+	}
+	functionID, ok := call[0].(string)
+	if !ok || len(functionID) != 4 {
+		return nil, nil, fmt.Errorf("calldata function id is invalid")
+	}
+	args, ok := call[1].(Tuple)
+	if !ok {
+		return nil, nil, fmt.Errorf("calldata arguments is not a tuple")
+	}
+	return []byte(functionID), args, nil
+}
+
+//EncodeValue 编码FATE数据，返回cb_编码
+func EncodeValue(value interface{}) (string, error) {
+	data, err := Serialize(value)
+	if err != nil {
+		return "", err
+	}
+	return aeternity.Encode(aeternity.PrefixContractByteArray, data), nil
+}
+
+//DecodeValue 解码cb_编码的FATE数据
+func DecodeValue(encoded string) (interface{}, error) {
+	data, err := aeternity.Decode(encoded)
+	if err != nil {
+		return nil, err
+	}
+	return Deserialize(data)
+}
+
+//Deserialize 解码FATE数据，数据必须完整
+func Deserialize(data []byte) (interface{}, error) {
+	value, rest, err := deserialize(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("fate value has %d trailing bytes", len(rest))
+	}
+	return value, nil
+}
+
+//rlpInt 整数的rlp编码，与erlang的binary:encode_unsigned一致，0编码为<<0>>
+func rlpInt(n *big.Int) []byte {
+	b := n.Bytes()
+	if len(b) == 0 {
+		b = []byte{0}
+	}
+	enc, _ := rlp.EncodeToBytes(b)
+	return enc
+}
+
+func serializeInt(n *big.Int) []byte {
+	abs := new(big.Int).Abs(n)
+	if abs.Cmp(big.NewInt(64)) < 0 {
+		b := byte(abs.Int64()) << 1
+		if n.Sign() < 0 {
+			b |= 0x80
+		}
+		return []byte{b}
+	}
+	tag := byte(tagPosBigInt)
+	if n.Sign() < 0 {
+		tag = tagNegBigInt
+	}
+	return append([]byte{tag}, rlpInt(abs.Sub(abs, big.NewInt(64)))...)
+}
+
+func serializeString(s []byte) []byte {
+	size := len(s)
+	switch {
+	case size == 0:
+		return []byte{tagEmptyString}
+	case size < 64:
+		return append([]byte{byte(size<<2) | tagShortString}, s...)
+	default:
+		b := append([]byte{tagLongString}, rlpInt(big.NewInt(int64(size-64)))...)
+		return append(b, s...)
+	}
+}
+
+func serializeElements(b []byte, elements []interface{}) ([]byte, error) {
+	for _, e := range elements {
+		eb, err := Serialize(e)
+		if err != nil {
+			return nil, err
+		}
+		b = append(b, eb...)
+	}
+	return b, nil
+}
+
+func serializeTuple(elements []interface{}) ([]byte, error) {
+	size := len(elements)
+	switch {
+	case size == 0:
+		return []byte{tagEmptyTuple}, nil
+	case size < 16:
+		return serializeElements([]byte{byte(size<<4) | tagShortTuple}, elements)
+	default:
+		return serializeElements(append([]byte{tagLongTuple}, rlpInt(big.NewInt(int64(size-16)))...), elements)
+	}
+}
+
+func serializeList(elements []interface{}) ([]byte, error) {
+	size := len(elements)
+	if size < 16 {
+		return serializeElements([]byte{byte(size<<4) | tagShortList}, elements)
+	}
+	return serializeElements(append([]byte{tagLongList}, rlpInt(big.NewInt(int64(size-16)))...), elements)
+}
+
+func serializeMap(m *Map) ([]byte, error) {
+	type entry struct {
+		key   []byte
+		value []byte
+		order interface{}
+	}
+	entries := make([]*entry, 0, len(m.Entries))
+	for _, e := range m.Entries {
+		kb, err := Serialize(e.Key)
+		if err != nil {
+			return nil, err
+		}
+		vb, err := Serialize(e.Value)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, &entry{key: kb, value: vb, order: e.Key})
+	}
+	//键按FATE数据的顺序排序
+	sort.SliceStable(entries, func(i, j int) bool {
+		return compare(entries[i].order, entries[j].order, entries[i].key, entries[j].key) < 0
+	})
+	b := append([]byte{tagMap}, rlpInt(big.NewInt(int64(len(entries))))...)
+	for _, e := range entries {
+		b = append(b, e.key...)
+		b = append(b, e.value...)
+	}
+	return b, nil
+}
+
+//compare 比较两个同类型的FATE数据，整数按数值比较，其他类型按编码字节比较
+func compare(a, b interface{}, ab, bb []byte) int {
+	ai, aok := a.(*big.Int)
+	bi, bok := b.(*big.Int)
+	if aok && bok {
+		return ai.Cmp(bi)
+	}
+	as, aok := a.(string)
+	bs, bok := b.(string)
+	if aok && bok {
+		return bytes.Compare([]byte(as), []byte(bs))
+	}
+	return bytes.Compare(ab, bb)
+}
+
+func serializeObject(objectType byte, encoded string) ([]byte, error) {
+	pub, err := aeternity.Decode(encoded)
+	if err != nil {
+		return nil, err
+	}
+	enc, _ := rlp.EncodeToBytes(pub)
+	return append([]byte{tagObject, objectType}, enc...), nil
+}
+
+//Serialize 编码FATE数据
+//支持的Go类型：bool, int, int64, uint64, *big.Int, string, Address, ContractAddress, OracleAddress,
+//OracleQueryID, ChannelAddress, Bytes, Bits, Tuple, List, *Map, *Variant，[]byte按string编码，[]interface{}按Tuple编码
+func Serialize(value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case bool:
+		if v {
+			return []byte{tagTrue}, nil
+		}
+		return []byte{tagFalse}, nil
+	case int:
+		return serializeInt(big.NewInt(int64(v))), nil
+	case int64:
+		return serializeInt(big.NewInt(v)), nil
+	case uint64:
+		return serializeInt(new(big.Int).SetUint64(v)), nil
+	case *big.Int:
+		return serializeInt(v), nil
+	case string:
+		return serializeString([]byte(v)), nil
+	case []byte:
+		return serializeString(v), nil
+	case Address:
+		return serializeObject(objectAddress, string(v))
+	case ContractAddress:
+		return serializeObject(objectContract, string(v))
+	case OracleAddress:
+		return serializeObject(objectOracle, string(v))
+	case OracleQueryID:
+		return serializeObject(objectOracleQ, string(v))
+	case ChannelAddress:
+		return serializeObject(objectChannel, string(v))
+	case Bytes:
+		return append([]byte{tagObject, objectBytes}, serializeString(v)...), nil
+	case Bits:
+		if v.Sign() < 0 {
+			return append([]byte{tagNegBits}, rlpInt(new(big.Int).Neg(v.Int))...), nil
+		}
+		return append([]byte{tagPosBits}, rlpInt(v.Int)...), nil
+	case Tuple:
+		return serializeTuple(v)
+	case []interface{}:
+		return serializeTuple(v)
+	case List:
+		return serializeList(v)
+	case *Map:
+		return serializeMap(v)
+	case *Variant:
+		if int(v.Tag) >= len(v.Arities) {
+			return nil, fmt.Errorf("fate variant tag %d out of range", v.Tag)
+		}
+		if int(v.Arities[v.Tag]) != len(v.Values) {
+			return nil, fmt.Errorf("fate variant tag %d expects %d values", v.Tag, v.Arities[v.Tag])
+		}
+		arities, _ := rlp.EncodeToBytes(v.Arities)
+		b := append([]byte{tagVariant}, arities...)
+		b = append(b, v.Tag)
+		values, err := serializeTuple(v.Values)
+		if err != nil {
+			return nil, err
+		}
+		return append(b, values...), nil
+	default:
+		return nil, fmt.Errorf("unsupported fate type: %T", value)
+	}
+}
+
+//deserializeRLPInt 读取rlp编码的整数
+func deserializeRLPInt(data []byte) (*big.Int, []byte, error) {
+	content, rest, err := rlp.SplitString(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	return new(big.Int).SetBytes(content), rest, nil
+}
+
+//deserializeSize 读取rlp编码的长度，加上短类型的最大长度
+func deserializeSize(data []byte, offset int64) (int, []byte, error) {
+	size, rest, err := deserializeRLPInt(data)
+	if err != nil {
+		return 0, nil, err
+	}
+	size.Add(size, big.NewInt(offset))
+	if !size.IsInt64() || size.Int64() > int64(len(rest)) {
+		return 0, nil, fmt.Errorf("fate size %s is out of range", size.String())
+	}
+	return int(size.Int64()), rest, nil
+}
+
+func deserializeElements(data []byte, size int) ([]interface{}, []byte, error) {
+	elements := make([]interface{}, 0, size)
+	for i := 0; i < size; i++ {
+		e, rest, err := deserialize(data)
+		if err != nil {
+			return nil, nil, err
+		}
+		elements = append(elements, e)
+		data = rest
+	}
+	return elements, data, nil
+}
+
+func deserializeBytes(data []byte, size int) ([]byte, []byte, error) {
+	if len(data) < size {
+		return nil, nil, fmt.Errorf("fate string is too short")
+	}
+	return data[:size], data[size:], nil
+}
+
+func deserializeObject(data []byte) (interface{}, []byte, error) {
+	if len(data) == 0 {
+		return nil, nil, fmt.Errorf("fate object is too short")
+	}
+	objectType := data[0]
+	if objectType == objectBytes {
+		value, rest, err := deserialize(data[1:])
+		if err != nil {
+			return nil, nil, err
+		}
+		s, ok := value.(string)
+		if !ok {
+			return nil, nil, fmt.Errorf("fate bytes is not a string")
+		}
+		return Bytes(s), rest, nil
+	}
+	content, rest, err := rlp.SplitString(data[1:])
+	if err != nil {
+		return nil, nil, err
+	}
+	//aeternity.Encode会在参数后追加校验码，复制一份避免覆盖后续数据
+	content = append([]byte{}, content...)
+	switch objectType {
+	case objectAddress:
+		return Address(aeternity.Encode(aeternity.PrefixAccountPubkey, content)), rest, nil
+	case objectContract:
+		return ContractAddress(aeternity.Encode(aeternity.PrefixContractPubkey, content)), rest, nil
+	case objectOracle:
+		return OracleAddress(aeternity.Encode(aeternity.PrefixOraclePubkey, content)), rest, nil
+	case objectOracleQ:
+		return OracleQueryID(aeternity.Encode(aeternity.PrefixOracleQueryID, content)), rest, nil
+	case objectChannel:
+		return ChannelAddress(aeternity.Encode(aeternity.PrefixChannel, content)), rest, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported fate object type: %d", objectType)
+	}
+}
+
+func deserializeVariant(data []byte) (interface{}, []byte, error) {
+	arities, rest, err := rlp.SplitString(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(rest) == 0 {
+		return nil, nil, fmt.Errorf("fate variant is too short")
+	}
+	tag := rest[0]
+	if int(tag) >= len(arities) {
+		return nil, nil, fmt.Errorf("fate variant tag %d out of range", tag)
+	}
+	values, rest, err := deserialize(rest[1:])
+	if err != nil {
+		return nil, nil, err
+	}
+	tuple, ok := values.(Tuple)
+	if !ok || len(tuple) != int(arities[tag]) {
+		return nil, nil, fmt.Errorf("fate variant values is not a tuple of %d elements", arities[tag])
+	}
+	return &Variant{Arities: arities, Tag: tag, Values: tuple}, rest, nil
+}
+
+func deserializeMap(data []byte) (interface{}, []byte, error) {
+	size, rest, err := deserializeRLPInt(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !size.IsInt64() || size.Int64()*2 > int64(len(rest)) {
+		return nil, nil, fmt.Errorf("fate map size %s is out of range", size.String())
+	}
+	elements, rest, err := deserializeElements(rest, int(size.Int64())*2)
+	if err != nil {
+		return nil, nil, err
+	}
+	m := &Map{Entries: make([]*MapEntry, 0, len(elements)/2)}
+	for i := 0; i < len(elements); i += 2 {
+		m.Entries = append(m.Entries, &MapEntry{Key: elements[i], Value: elements[i+1]})
+	}
+	return m, rest, nil
+}
+
+//deserialize 解码FATE数据，返回值和剩余字节
+func deserialize(data []byte) (interface{}, []byte, error) {
+
+	if len(data) == 0 {
+		return nil, nil, fmt.Errorf("fate data is empty")
+	}
+
+	tag := data[0]
+	data = data[1:]
+
+	switch {
+	case tag == tagTrue:
+		return true, data, nil
+	case tag == tagFalse:
+		return false, data, nil
+	case tag == tagEmptyTuple:
+		return Tuple{}, data, nil
+	case tag == tagEmptyString:
+		return "", data, nil
+	case tag == tagPosBigInt, tag == tagNegBigInt:
+		n, rest, err := deserializeRLPInt(data)
+		if err != nil {
+			return nil, nil, err
+		}
+		n.Add(n, big.NewInt(64))
+		if tag == tagNegBigInt {
+			n.Neg(n)
+		}
+		return n, rest, nil
+	case tag == tagPosBits, tag == tagNegBits:
+		n, rest, err := deserializeRLPInt(data)
+		if err != nil {
+			return nil, nil, err
+		}
+		if tag == tagNegBits {
+			n.Neg(n)
+		}
+		return Bits{n}, rest, nil
+	case tag&0x01 == tagSmallInt:
+		n := big.NewInt(int64(tag&0x7e) >> 1)
+		if tag&0x80 != 0 {
+			n.Neg(n)
+		}
+		return n, data, nil
+	case tag == tagLongString:
+		size, rest, err := deserializeSize(data, 64)
+		if err != nil {
+			return nil, nil, err
+		}
+		s, rest, err := deserializeBytes(rest, size)
+		if err != nil {
+			return nil, nil, err
+		}
+		return string(s), rest, nil
+	case tag&0x03 == tagShortString:
+		s, rest, err := deserializeBytes(data, int(tag>>2))
+		if err != nil {
+			return nil, nil, err
+		}
+		return string(s), rest, nil
+	case tag == tagLongTuple:
+		size, rest, err := deserializeSize(data, 16)
+		if err != nil {
+			return nil, nil, err
+		}
+		elements, rest, err := deserializeElements(rest, size)
+		return Tuple(elements), rest, err
+	case tag&0x0f == tagShortTuple:
+		elements, rest, err := deserializeElements(data, int(tag>>4))
+		return Tuple(elements), rest, err
+	case tag == tagLongList:
+		size, rest, err := deserializeSize(data, 16)
+		if err != nil {
+			return nil, nil, err
+		}
+		elements, rest, err := deserializeElements(rest, size)
+		return List(elements), rest, err
+	case tag&0x0f == tagShortList:
+		elements, rest, err := deserializeElements(data, int(tag>>4))
+		return List(elements), rest, err
+	case tag == tagMap:
+		return deserializeMap(data)
+	case tag == tagObject:
+		return deserializeObject(data)
+	case tag == tagVariant:
+		return deserializeVariant(data)
+	default:
+		return nil, nil, fmt.Errorf("unsupported fate tag: 0x%x", tag)
+	}
+}
@@ -0,0 +1,158 @@
+package aeternity_fate
+
+import (
+	"encoding/hex"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testZeroAddress = "ak_11111111111111111111111111111111273Yts"
+
+func TestSerialize(t *testing.T) {
+
+	bigInt, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+
+	tests := []struct {
+		value interface{}
+		hex   string
+	}{
+		{0, "00"},
+		{1, "02"},
+		{-1, "82"},
+		{63, "7e"},
+		{-63, "fe"},
+		{64, "6f00"},
+		{-64, "ef00"},
+		{1000, "6f8203a8"},
+		{bigInt, "6f8d018ee90ff6c373e0ee4e3f0a92"},
+		{true, "ff"},
+		{false, "7f"},
+		{"", "5f"},
+		{"a", "0561"},
+		{strings.Repeat("a", 64), "0100" + strings.Repeat("61", 64)},
+		{Tuple{}, "3f"},
+		{Tuple{1, 2}, "2b0204"},
+		{List{}, "03"},
+		{List{1, 2}, "230204"},
+		{&Map{Entries: []*MapEntry{{Key: big.NewInt(2), Value: 4}, {Key: big.NewInt(1), Value: 2}}}, "2f0202040408"},
+		{&Variant{Arities: []byte{0, 1}, Tag: 0, Values: Tuple{}}, "af820001003f"},
+		{&Variant{Arities: []byte{0, 1}, Tag: 1, Values: Tuple{1}}, "af820001011b02"},
+		{Address(testZeroAddress), "9f00a0" + strings.Repeat("00", 32)},
+		{Bytes{0x01, 0x02}, "9f01090102"},
+	}
+
+	for _, test := range tests {
+		b, err := Serialize(test.value)
+		if err != nil {
+			t.Errorf("Serialize(%v) error: %v", test.value, err)
+			continue
+		}
+		if hex.EncodeToString(b) != test.hex {
+			t.Errorf("Serialize(%v) = %x, want %s", test.value, b, test.hex)
+		}
+	}
+}
+
+func TestDeserialize(t *testing.T) {
+
+	tests := []struct {
+		hex   string
+		value interface{}
+	}{
+		{"00", big.NewInt(0)},
+		{"82", big.NewInt(-1)},
+		{"6f8203a8", big.NewInt(1000)},
+		{"ef00", big.NewInt(-64)},
+		{"ff", true},
+		{"5f", ""},
+		{"0561", "a"},
+		{"2b0204", Tuple{big.NewInt(1), big.NewInt(2)}},
+		{"230204", List{big.NewInt(1), big.NewInt(2)}},
+		{"2f010204", &Map{Entries: []*MapEntry{{Key: big.NewInt(1), Value: big.NewInt(2)}}}},
+		{"af820001011b02", &Variant{Arities: []byte{0, 1}, Tag: 1, Values: Tuple{big.NewInt(1)}}},
+		{"9f00a0" + strings.Repeat("00", 32), Address(testZeroAddress)},
+		{"9f01090102", Bytes{0x01, 0x02}},
+	}
+
+	for _, test := range tests {
+		data, _ := hex.DecodeString(test.hex)
+		value, err := Deserialize(data)
+		if err != nil {
+			t.Errorf("Deserialize(%s) error: %v", test.hex, err)
+			continue
+		}
+		if !reflect.DeepEqual(value, test.value) {
+			t.Errorf("Deserialize(%s) = %#v, want %#v", test.hex, value, test.value)
+		}
+	}
+
+	//不完整的数据
+	for _, invalid := range []string{"", "05", "2b02", "6f", "af820001021b02", "0200"} {
+		data, _ := hex.DecodeString(invalid)
+		if _, err := Deserialize(data); err == nil {
+			t.Errorf("Deserialize(%s) should fail", invalid)
+		}
+	}
+}
+
+func TestEncodeCallData(t *testing.T) {
+
+	callData, err := EncodeCallData("init")
+	if err != nil {
+		t.Errorf("EncodeCallData error: %v", err)
+		return
+	}
+	if callData != "cb_KxFE1kQfP4oEp9E=" {
+		t.Errorf("EncodeCallData(init) = %s", callData)
+	}
+
+	callData, err = EncodeCallData("transfer", Address(testZeroAddress), 100)
+	if err != nil {
+		t.Errorf("EncodeCallData error: %v", err)
+		return
+	}
+	functionID, args, err := DecodeCallData(callData)
+	if err != nil {
+		t.Errorf("DecodeCallData error: %v", err)
+		return
+	}
+	if !reflect.DeepEqual(functionID, FunctionID("transfer")) {
+		t.Errorf("DecodeCallData function id = %x", functionID)
+	}
+	if !reflect.DeepEqual(args, Tuple{Address(testZeroAddress), big.NewInt(100)}) {
+		t.Errorf("DecodeCallData args = %#v", args)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+
+	values := []interface{}{
+		big.NewInt(-123456789),
+		new(big.Int).Lsh(big.NewInt(1), 300),
+		strings.Repeat("x", 300),
+		List{"a", "b", Tuple{true, false}},
+		Tuple{big.NewInt(1), big.NewInt(2), big.NewInt(3), big.NewInt(4), big.NewInt(5), big.NewInt(6), big.NewInt(7), big.NewInt(8),
+			big.NewInt(9), big.NewInt(10), big.NewInt(11), big.NewInt(12), big.NewInt(13), big.NewInt(14), big.NewInt(15), big.NewInt(16)},
+		&Map{Entries: []*MapEntry{{Key: "a", Value: List{}}, {Key: "b", Value: List{big.NewInt(1)}}}},
+		&Variant{Arities: []byte{1, 0, 2}, Tag: 2, Values: Tuple{"x", Address(testZeroAddress)}},
+		Bits{big.NewInt(-5)},
+	}
+
+	for _, value := range values {
+		encoded, err := EncodeValue(value)
+		if err != nil {
+			t.Errorf("EncodeValue(%v) error: %v", value, err)
+			continue
+		}
+		decoded, err := DecodeValue(encoded)
+		if err != nil {
+			t.Errorf("DecodeValue(%s) error: %v", encoded, err)
+			continue
+		}
+		if !reflect.DeepEqual(decoded, value) {
+			t.Errorf("round trip %#v = %#v", value, decoded)
+		}
+	}
+}
@@ -163,6 +163,48 @@ func TestTransfer_AE(t *testing.T) {
 	}
 }
 
+func TestTransfer_Token(t *testing.T) {
+
+	tm := testInitWalletManager()
+	walletID := "WKnpZFZbcDtn6xM6FAh6aVSiU342H8Pbcp"
+	accountID := "3kjTyuy8dt2RUcokpbg27ioBHBehh8THKz9FxsrrDZS6"
+	to := "ak_qcqXt6ySgRPvBkNwEpNMvaKWzrhPZsoBHLvgg68qg9vRht62y"
+
+	contract := openwallet.SmartContract{
+		Address:  "ct_J3zBY8xxjsRr3QojETNw48Eb38fjvEuJKkQ6KzECvubvEcvCa",
+		Symbol:   "AE",
+		Name:     "Wrapped Aeternity",
+		Token:    "WAE",
+		Decimals: 18,
+	}
+
+	testGetAssetsAccountBalance(tm, walletID, accountID)
+
+	testGetAssetsAccountTokenBalance(tm, walletID, accountID, contract)
+
+	rawTx, err := testCreateTransactionStep(tm, walletID, accountID, to, "0.01", "", &contract)
+	if err != nil {
+		return
+	}
+
+	log.Std.Info("rawTx: %+v", rawTx)
+
+	_, err = testSignTransactionStep(tm, rawTx)
+	if err != nil {
+		return
+	}
+
+	_, err = testVerifyTransactionStep(tm, rawTx)
+	if err != nil {
+		return
+	}
+
+	_, err = testSubmitTransactionStep(tm, rawTx)
+	if err != nil {
+		return
+	}
+}
+
 func TestSummary_AE(t *testing.T) {
 	tm := testInitWalletManager()
 	walletID := "WKnpZFZbcDtn6xM6FAh6aVSiU342H8Pbcp"